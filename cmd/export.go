@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/scnon/md-doc/utils"
+	"github.com/spf13/cobra"
+)
+
+var exportOpts utils.ExportOptions
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export a repo as a static site",
+	Long:  "Render every document of a repo at a ref into a static site with assets, search index and sitemap",
+	RunE:  runExport,
+}
+
+var exportPDFCmd = &cobra.Command{
+	Use:   "pdf [path]",
+	Short: "Export a document or a directory as pdf",
+	Long:  "Render a document, or the documents of a directory in sidebar order, into one pdf written to --out",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runExportPDF,
+}
+
+var exportEPUBCmd = &cobra.Command{
+	Use:   "epub [path]",
+	Short: "Export the repo or a directory as epub",
+	Long:  "Package the documents of the repo, or of a directory, in sidebar order into an epub book written to --out",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runExportEPUB,
+}
+
+func init() {
+	exportPDFCmd.Flags().StringVar(&utils.PDFFontDir, "font-dir", "", "directory with DejaVu fonts")
+	exportCmd.AddCommand(exportPDFCmd)
+	exportCmd.AddCommand(exportEPUBCmd)
+
+	exportCmd.PersistentFlags().StringVar(&exportOpts.Repo, "repo", "", "repo to export")
+	exportCmd.PersistentFlags().StringVar(&exportOpts.Ref, "ref", "HEAD", "branch, tag or commit to export")
+	exportCmd.PersistentFlags().StringVar(&exportOpts.Out, "out", "", "output directory")
+	exportCmd.Flags().StringVar(&exportOpts.BaseURL, "base-url", "", "url the site is published at, used by sitemap.xml")
+	exportCmd.MarkPersistentFlagRequired("repo")
+	exportCmd.MarkPersistentFlagRequired("out")
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	return utils.ExportSite(exportOpts)
+}
+
+func runExportPDF(cmd *cobra.Command, args []string) error {
+	target := ""
+	if len(args) > 0 {
+		target = args[0]
+	}
+
+	_, cleanup, err := utils.CheckoutRef(exportOpts.Repo, exportOpts.Ref)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	file, err := os.Create(exportOpts.Out)
+	if err != nil {
+		return err
+	}
+	if err := utils.ExportPDF(file, exportOpts.Repo, target); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func runExportEPUB(cmd *cobra.Command, args []string) error {
+	target := ""
+	if len(args) > 0 {
+		target = args[0]
+	}
+
+	_, cleanup, err := utils.CheckoutRef(exportOpts.Repo, exportOpts.Ref)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	file, err := os.Create(exportOpts.Out)
+	if err != nil {
+		return err
+	}
+	if err := utils.ExportEPUB(file, exportOpts.Repo, target); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/scnon/md-doc/storage"
+	"github.com/scnon/md-doc/utils"
+	"github.com/spf13/cobra"
+)
+
+var migrateStatus bool
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Migrate the database to the latest schema",
+	Long:  "Apply the pending schema migrations of the database, the server also applies them when it starts",
+	Args:  cobra.NoArgs,
+	RunE:  runMigrate,
+}
+
+func init() {
+	migrateCmd.Flags().BoolVar(&migrateStatus, "status", false, "list the migrations and whether they are applied, without applying any")
+}
+
+func runMigrate(cmd *cobra.Command, args []string) error {
+	store, err := utils.OpenStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if migrateStatus {
+		version, err := store.Version()
+		if err != nil {
+			return err
+		}
+		for _, m := range storage.Migrations() {
+			state := "pending"
+			if m.Version <= version {
+				state = "applied"
+			}
+			fmt.Printf("%3d  %-8s %s\n", m.Version, state, m.Name)
+		}
+		return nil
+	}
+
+	applied, err := store.Migrate()
+	for _, m := range applied {
+		fmt.Printf("applied %d: %s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		fmt.Println("already up to date")
+	}
+	return nil
+}
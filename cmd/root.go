@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"github.com/scnon/md-doc/utils"
 	"github.com/spf13/cobra"
 )
 
@@ -13,7 +14,15 @@ var rootCmd = &cobra.Command{
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&utils.DBDriver, "db-driver", utils.DBDriver, "database for users, comments and proposals, sqlite or mysql")
+	rootCmd.PersistentFlags().StringVar(&utils.DBPath, "db", utils.DBPath, "sqlite database file")
+	rootCmd.PersistentFlags().StringVar(&utils.DBDSN, "db-dsn", "", "mysql data source name, built from the MYSQL_* variables when empty")
+
 	rootCmd.AddCommand(serverCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(migrateCmd)
+	rootCmd.AddCommand(tokenCmd)
+	rootCmd.AddCommand(settingsCmd)
 }
 
 func Execute() error {
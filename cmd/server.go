@@ -2,10 +2,12 @@ package cmd
 
 import (
 	"os/exec"
+	"path/filepath"
 
 	"github.com/labstack/echo/v4"
 	"github.com/scnon/md-doc/internal"
 	"github.com/scnon/md-doc/logic"
+	"github.com/scnon/md-doc/utils"
 	"github.com/spf13/cobra"
 )
 
@@ -16,9 +18,32 @@ var serverCmd = &cobra.Command{
 	RunE:    runServer,
 }
 
+func init() {
+	serverCmd.Flags().StringVar(&utils.LightTheme, "light-theme", utils.LightTheme, "chroma style for light color scheme")
+	serverCmd.Flags().StringVar(&utils.DarkTheme, "dark-theme", utils.DarkTheme, "chroma style for dark color scheme")
+	serverCmd.Flags().BoolVar(&utils.DevMode, "dev", false, "reload templates on every request")
+	serverCmd.Flags().IntVar(&utils.RenderCacheSize, "render-cache-size", utils.RenderCacheSize, "rendered documents kept in memory")
+	serverCmd.Flags().Int64Var(&utils.SourceSizeLimit, "source-size-limit", utils.SourceSizeLimit, "largest source file shown highlighted, in bytes")
+	serverCmd.Flags().StringVar(&utils.PDFFontDir, "pdf-font-dir", "", "directory with DejaVu fonts for pdf export")
+	serverCmd.Flags().StringVar(&utils.RenderCacheDir, "render-cache-dir", "", "directory for the on-disk render cache")
+	serverCmd.Flags().StringVar(&utils.UserHeader, "user-header", "", "header the authenticating proxy sets to the user name, enables editing")
+	serverCmd.Flags().StringVar(&utils.UserEmailHeader, "user-email-header", "", "header the authenticating proxy sets to the user email")
+	serverCmd.Flags().Int64Var(&utils.UploadSizeLimit, "upload-size-limit", utils.UploadSizeLimit, "largest image that can be uploaded, in bytes")
+}
+
 func runServer(cmd *cobra.Command, args []string) error {
+	if err := utils.LoadTemplates(); err != nil {
+		return err
+	}
+	// migrations run before serving
+	if _, err := utils.GetStore(); err != nil {
+		return err
+	}
+
 	e := echo.New()
 	e.Debug = false
+	e.Use(logic.SameOrigin)
+	e.Use(logic.ReadAccess)
 
 	internal.InitConfig(internal.Config{
 		AuthPassEnvVar: "",
@@ -30,15 +55,45 @@ func runServer(cmd *cobra.Command, args []string) error {
 		ReceivePack:    true,
 		RoutePrefix:    "",
 		CommandFunc:    func(*exec.Cmd) {},
+		ReceiveFunc: func(dir string) {
+			go utils.SyncRepo(filepath.Base(dir))
+		},
 	})
 
 	e.GET("/", logic.ListHandler)
+	e.GET("/search", logic.SearchPageHandler)
+	e.GET("/static/chroma/:style", logic.ChromaCSSHandler)
 	e.Static("/static", "./static")
 
 	e.Any("/repo/:repo/:action", echo.WrapHandler(internal.Handler()))
 
 	e.Any("/doc/:repo/*", logic.DocHandler)
+	e.GET("/raw/:repo/*", logic.RawHandler)
+	e.GET("/asset/:repo/*", logic.AssetHandler)
+	e.GET("/export/:repo/*", logic.ExportHandler)
+	e.GET("/edit/:repo/*", logic.EditHandler)
+	e.GET("/new/:repo/*", logic.NewHandler)
 	e.POST("/api/doc/search", logic.SearchHander)
+	e.POST("/api/doc/save", logic.SaveHandler)
+	e.POST("/api/doc/create", logic.CreateHandler)
+	e.POST("/api/doc/move", logic.MoveHandler)
+	e.POST("/api/doc/delete", logic.DeleteHandler)
+	e.POST("/api/doc/upload", logic.UploadHandler)
+	e.GET("/proposals/:repo", logic.ProposalsHandler)
+	e.GET("/proposal/:repo/:id", logic.ProposalHandler)
+	e.POST("/api/proposal/comment", logic.CommentProposalHandler)
+	e.POST("/api/proposal/approve", logic.ApproveProposalHandler)
+	e.POST("/api/proposal/merge", logic.MergeProposalHandler)
+	e.POST("/api/proposal/close", logic.CloseProposalHandler)
+	e.GET("/api/comments/:repo/*", logic.CommentsHandler)
+	e.GET("/api/comment/mentions", logic.MentionsHandler)
+	e.POST("/api/comment", logic.AddCommentHandler)
+	e.POST("/api/comment/resolve", logic.ResolveCommentHandler)
+	e.POST("/api/render", logic.RenderApiHandler)
+	e.GET("/api/openapi.json", logic.OpenAPIHandler)
+	e.GET("/api/repos/:repo/tree", logic.TreeApiHandler)
+	e.GET("/api/repos/:repo/docs/*", logic.DocApiHandler)
+	e.GET("/api/repos/:repo/commits", logic.CommitsApiHandler)
 
 	return e.Start(":80")
 }
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/scnon/md-doc/utils"
+	"github.com/spf13/cobra"
+)
+
+var settingsCmd = &cobra.Command{
+	Use:   "settings",
+	Short: "Manage the settings of repos that a push can't change",
+}
+
+var settingsSetCmd = &cobra.Command{
+	Use:   "set <repo> <name> <value>",
+	Short: "Set a setting of a repo: " + strings.Join(utils.RepoSettings, ", "),
+	Args:  cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return utils.SetRepoSetting(args[0], args[1], args[2])
+	},
+}
+
+var settingsListCmd = &cobra.Command{
+	Use:   "list <repo>",
+	Short: "List the settings of a repo",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := utils.GetStore()
+		if err != nil {
+			return err
+		}
+		settings, err := store.Settings().List(args[0])
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(settings))
+		for name := range settings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%s = %s\n", name, settings[name])
+		}
+		return nil
+	},
+}
+
+func init() {
+	settingsCmd.AddCommand(settingsSetCmd)
+	settingsCmd.AddCommand(settingsListCmd)
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/scnon/md-doc/utils"
+	"github.com/spf13/cobra"
+)
+
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manage api tokens of users",
+}
+
+var tokenCreateCmd = &cobra.Command{
+	Use:   "create <user> <name>",
+	Short: "Create an api token, its secret is printed once",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := utils.GetStore()
+		if err != nil {
+			return err
+		}
+		secret, token, err := store.Tokens().Create(args[0], args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("token %d for %s: %s\n", token.ID, token.User, secret)
+		return nil
+	},
+}
+
+var tokenListCmd = &cobra.Command{
+	Use:   "list <user>",
+	Short: "List the api tokens of a user",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := utils.GetStore()
+		if err != nil {
+			return err
+		}
+		tokens, err := store.Tokens().List(args[0])
+		if err != nil {
+			return err
+		}
+		for _, t := range tokens {
+			used := "never used"
+			if !t.LastUsed.IsZero() {
+				used = "used " + t.LastUsed.Format("2006-01-02 15:04")
+			}
+			fmt.Printf("%d  %s  created %s, %s\n", t.ID, t.Name, t.Created.Format("2006-01-02 15:04"), used)
+		}
+		return nil
+	},
+}
+
+var tokenRevokeCmd = &cobra.Command{
+	Use:   "revoke <user> <id>",
+	Short: "Revoke an api token",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		store, err := utils.GetStore()
+		if err != nil {
+			return err
+		}
+		return store.Tokens().Delete(args[0], id)
+	},
+}
+
+func init() {
+	tokenCmd.AddCommand(tokenCreateCmd)
+	tokenCmd.AddCommand(tokenListCmd)
+	tokenCmd.AddCommand(tokenRevokeCmd)
+}
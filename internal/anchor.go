@@ -0,0 +1,228 @@
+package internal
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	// anchorContext runes around a quote are kept to tell repeats apart
+	anchorContext = 32
+	// anchorKey runes at the ends of a quote find where an edited quote is
+	anchorKey = 8
+	// anchorCandidates bounds the passages compared with an edited quote
+	anchorCandidates = 64
+	// anchorSimilarity is the least similarity an edited quote is found at
+	anchorSimilarity = 0.6
+	// contextWeight of the similarity of the text around a passage tells
+	// similar passages apart
+	contextWeight = 0.25
+)
+
+// Anchor is the text a comment points at, with the text around it
+type Anchor struct {
+	Quote  string
+	Prefix string
+	Suffix string
+}
+
+// CollapseSpace trims s and turns each run of whitespace into one space
+func CollapseSpace(s string) string {
+	return strings.Join(strings.FieldsFunc(s, unicode.IsSpace), " ")
+}
+
+// FindQuote looks for a quote in text. Of several exact occurrences the
+// one in the most similar context wins, an edited quote is matched to the
+// most similar passage. ok is false when nothing similar is left.
+func FindQuote(text string, a Anchor) (Anchor, bool) {
+	t := []rune(CollapseSpace(text))
+	q := []rune(CollapseSpace(a.Quote))
+	prefix, suffix := []rune(CollapseSpace(a.Prefix)), []rune(CollapseSpace(a.Suffix))
+	if len(q) == 0 {
+		return a, false
+	}
+
+	context := func(start, end int) float64 {
+		return similarity(prefix, runesBefore(t, start, len(prefix))) +
+			similarity(suffix, runesAfter(t, end, len(suffix)))
+	}
+
+	// exact occurrences
+	best, bestScore := -1, -1.0
+	for _, start := range runeIndexes(t, q) {
+		if score := context(start, start+len(q)); score > bestScore {
+			best, bestScore = start, score
+		}
+	}
+	if best >= 0 {
+		return anchorAt(t, best, best+len(q)), true
+	}
+
+	// passages starting or ending like the quote or its context
+	key := anchorKey
+	if key > len(q) {
+		key = len(q)
+	}
+	var starts, ends []int
+	starts = append(starts, runeIndexes(t, q[:key])...)
+	for _, i := range runeIndexes(t, q[len(q)-key:]) {
+		ends = append(ends, i+key)
+	}
+	if len(prefix) > 0 {
+		k := minInt(anchorKey, len(prefix))
+		for _, i := range runeIndexes(t, prefix[len(prefix)-k:]) {
+			starts = append(starts, i+k)
+		}
+	}
+	if len(suffix) > 0 {
+		ends = append(ends, runeIndexes(t, suffix[:minInt(anchorKey, len(suffix))])...)
+	}
+	starts, ends = limit(starts), limit(ends)
+
+	type span struct{ start, end int }
+	var spans []span
+	for _, s := range starts {
+		spans = append(spans, span{s, s + len(q)})
+		for _, e := range ends {
+			if e > s && e-s <= 2*len(q) {
+				spans = append(spans, span{s, e})
+			}
+		}
+	}
+	for _, e := range ends {
+		spans = append(spans, span{e - len(q), e})
+	}
+
+	var found span
+	bestScore = -1
+	for _, sp := range spans {
+		if sp.start < 0 || sp.end > len(t) || sp.start >= sp.end {
+			continue
+		}
+		match := similarity(q, t[sp.start:sp.end])
+		if match < anchorSimilarity {
+			continue
+		}
+		if score := match + contextWeight*context(sp.start, sp.end); score > bestScore {
+			found, bestScore = sp, score
+		}
+	}
+	if bestScore < 0 {
+		return a, false
+	}
+	// the context is trimmed, passages next to it start with its space
+	for found.start < found.end && t[found.start] == ' ' {
+		found.start++
+	}
+	for found.end > found.start && t[found.end-1] == ' ' {
+		found.end--
+	}
+	return anchorAt(t, found.start, found.end), true
+}
+
+// MatchHeading finds the heading a comment was on by its id, or by the
+// most similar text when the heading was edited
+func MatchHeading(headings []Heading, id, text string) (Heading, bool) {
+	for _, h := range headings {
+		if h.ID == id {
+			return h, true
+		}
+	}
+	var best Heading
+	bestScore := 0.0
+	for _, h := range headings {
+		if score := similarity([]rune(text), []rune(h.Text)); score > bestScore {
+			best, bestScore = h, score
+		}
+	}
+	return best, bestScore >= anchorSimilarity
+}
+
+func anchorAt(t []rune, start, end int) Anchor {
+	return Anchor{
+		Quote:  string(t[start:end]),
+		Prefix: string(runesBefore(t, start, anchorContext)),
+		Suffix: string(runesAfter(t, end, anchorContext)),
+	}
+}
+
+func runesBefore(t []rune, i, n int) []rune {
+	if n > i {
+		n = i
+	}
+	return t[i-n : i]
+}
+
+func runesAfter(t []rune, i, n int) []rune {
+	if i+n > len(t) {
+		n = len(t) - i
+	}
+	return t[i : i+n]
+}
+
+// runeIndexes lists where sub starts in t
+func runeIndexes(t, sub []rune) []int {
+	var found []int
+	if len(sub) == 0 {
+		return nil
+	}
+	for i := 0; i+len(sub) <= len(t); i++ {
+		if t[i] != sub[0] {
+			continue
+		}
+		match := true
+		for j := 1; j < len(sub); j++ {
+			if t[i+j] != sub[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			found = append(found, i)
+		}
+	}
+	return found
+}
+
+func limit(positions []int) []int {
+	if len(positions) > anchorCandidates {
+		return positions[:anchorCandidates]
+	}
+	return positions
+}
+
+// similarity is 1 for equal texts and 0 for entirely different ones, by
+// edit distance
+func similarity(a, b []rune) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	longest := len(a)
+	if len(b) > longest {
+		longest = len(b)
+	}
+	return 1 - float64(prev[len(b)])/float64(longest)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
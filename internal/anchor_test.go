@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHTMLText(t *testing.T) {
+	content := "<h1 id=\"a\">Title</h1>\n<p>Some <em>quick</em>\n  text.</p><style>p{}</style><script>x()</script><p>End</p>"
+	if got := HTMLText(content); got != "Title Some quick text.End" {
+		t.Errorf("HTMLText = %q", got)
+	}
+}
+
+func TestFindQuote(t *testing.T) {
+	anchor := Anchor{Quote: "quick brown fox", Prefix: "Intro paragraph. The ", Suffix: " jumps over the lazy dog."}
+	tests := []struct {
+		name   string
+		text   string
+		want   string
+		prefix string
+		ok     bool
+	}{
+		{"unchanged", "Intro paragraph. The quick brown fox jumps over the lazy dog. Closing words.",
+			"quick brown fox", "Intro paragraph. The ", true},
+		{"moved", "A new first paragraph.\n\nClosing words. Intro paragraph. The   quick brown fox\njumps over the lazy dog.",
+			"quick brown fox", "words. Intro paragraph. The ", true},
+		{"repeated", "A quick brown fox sleeps. Intro paragraph. The quick brown fox jumps over the lazy dog.",
+			"quick brown fox", "eps. Intro paragraph. The ", true},
+		{"edited", "Intro paragraph. The quick brawn fox jumps over the lazy dog.",
+			"quick brawn fox", "Intro paragraph. The ", true},
+		{"edited and moved", "Closing words. Intro paragraph. The quick red fox jumps over the lazy dog.",
+			"quick red fox", "words. Intro paragraph. The ", true},
+		{"deleted", "Intro paragraph. Something else entirely now. Closing words.", "", "", false},
+		{"empty", "", "", "", false},
+	}
+	for _, test := range tests {
+		got, ok := FindQuote(test.text, anchor)
+		if ok != test.ok {
+			t.Errorf("%s: found %v, want %v: %+v", test.name, ok, test.ok, got)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if got.Quote != test.want || !strings.HasSuffix(got.Prefix, test.prefix) ||
+			!strings.HasPrefix(got.Suffix, " jumps over") {
+			t.Errorf("%s: found %+v, want quote %q after %q", test.name, got, test.want, test.prefix)
+		}
+	}
+}
+
+func TestMatchHeading(t *testing.T) {
+	headings := []Heading{
+		{Level: 2, Text: "Setup", ID: "setup"},
+		{Level: 2, Text: "Install the tool", ID: "install-the-tool"},
+		{Level: 3, Text: "Usage", ID: "usage"},
+	}
+	tests := []struct {
+		name, id, text string
+		want           string
+		ok             bool
+	}{
+		{"unchanged", "usage", "Usage", "usage", true},
+		{"moved", "setup", "Setup", "setup", true},
+		{"renamed id kept", "install-the-tool", "Install a tool", "install-the-tool", true},
+		{"edited", "install-the-tools", "Install the tools", "install-the-tool", true},
+		{"deleted", "configuration", "Configuration", "", false},
+	}
+	for _, test := range tests {
+		got, ok := MatchHeading(headings, test.id, test.text)
+		if ok != test.ok || (ok && got.ID != test.want) {
+			t.Errorf("%s: %+v, %v, want %q, %v", test.name, got, ok, test.want, test.ok)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// asciidoc covers the subset our docs use: headings, paragraphs, lists,
+// listing and literal blocks, admonition paragraphs, quotes, simple
+// tables, images, links and inline formatting
+
+var (
+	adocHeading   = regexp.MustCompile(`^(={1,6})\s+(.+)$`)
+	adocAttribute = regexp.MustCompile(`^:([\w-]+):\s*(.*)$`)
+	adocBlockAttr = regexp.MustCompile(`^\[(.*)\]$`)
+	adocListItem  = regexp.MustCompile(`^(\*{1,5}|-|\.{1,5})\s+(.*)$`)
+	adocImage     = regexp.MustCompile(`^image::([^\[\s]+)\[(.*)\]$`)
+	adocAdmonish  = regexp.MustCompile(`^(NOTE|TIP|IMPORTANT|WARNING|CAUTION):\s+(.*)$`)
+	adocAttrRef   = regexp.MustCompile(`\{([\w-]+)\}`)
+
+	adocInline = []struct {
+		re   *regexp.Regexp
+		repl string
+	}{
+		{regexp.MustCompile(`image:([^\[\s]+)\[([^\]]*)\]`), `<img src="$1" alt="$2">`},
+		{regexp.MustCompile(`link:([^\[\s]+)\[([^\]]*)\]`), `<a href="$1">$2</a>`},
+		{regexp.MustCompile(`(^|[^"=])(https?://[^\[\s<]+)\[([^\]]+)\]`), `$1<a href="$2">$3</a>`},
+		{regexp.MustCompile(`(^|[^"=>])(https?://[^\[\s<]+)`), `$1<a href="$2">$2</a>`},
+		{regexp.MustCompile(`&lt;&lt;([\w-]+)(?:,([^&]+))?&gt;&gt;`), `<a href="#$1">$1</a>`},
+		{regexp.MustCompile("`([^`]+)`"), `<code>$1</code>`},
+		{regexp.MustCompile(`\*\*(.+?)\*\*`), `<strong>$1</strong>`},
+		{regexp.MustCompile(`(^|[^\w*])\*([^*\s](?:[^*]*[^*\s])?)\*([^\w*]|$)`), `$1<strong>$2</strong>$3`},
+		{regexp.MustCompile(`__(.+?)__`), `<em>$1</em>`},
+		{regexp.MustCompile(`(^|[^\w_])_([^_\s](?:[^_]*[^_\s])?)_([^\w_]|$)`), `$1<em>$2</em>$3`},
+	}
+)
+
+type asciidocRenderer struct{}
+
+type adocParser struct {
+	lines []string
+	pos   int
+	attrs map[string]string
+	opts  RenderOptions
+	out   bytes.Buffer
+}
+
+func (asciidocRenderer) Render(content []byte, opts RenderOptions) string {
+	p := &adocParser{
+		lines: strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n"),
+		attrs: map[string]string{},
+		opts:  opts,
+	}
+	p.parse()
+	return p.out.String()
+}
+
+func (asciidocRenderer) Title(content []byte) string {
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(line, "= ") {
+			return strings.TrimSpace(line[2:])
+		}
+	}
+	return ""
+}
+
+func (p *adocParser) inline(text string) string {
+	text = adocAttrRef.ReplaceAllStringFunc(text, func(ref string) string {
+		if v, ok := p.attrs[ref[1:len(ref)-1]]; ok {
+			return v
+		}
+		return ref
+	})
+	text = html.EscapeString(text)
+	for _, rule := range adocInline {
+		text = rule.re.ReplaceAllString(text, rule.repl)
+	}
+	if strings.HasSuffix(text, " +") {
+		text = strings.TrimSuffix(text, " +") + "<br>"
+	}
+	return text
+}
+
+// delimited returns the lines up to the closing delimiter
+func (p *adocParser) delimited(delim string) []string {
+	var lines []string
+	for p.pos++; p.pos < len(p.lines); p.pos++ {
+		if strings.TrimRight(p.lines[p.pos], " ") == delim {
+			p.pos++
+			return lines
+		}
+		lines = append(lines, p.lines[p.pos])
+	}
+	return lines
+}
+
+func (p *adocParser) parse() {
+	var blockAttr string
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			p.pos++
+			continue
+		case strings.HasPrefix(trimmed, "////"):
+			p.delimited(trimmed)
+			continue
+		case strings.HasPrefix(trimmed, "//"):
+			p.pos++
+			continue
+		case adocAttribute.MatchString(line):
+			m := adocAttribute.FindStringSubmatch(line)
+			p.attrs[m[1]] = m[2]
+			p.pos++
+			continue
+		case adocBlockAttr.MatchString(trimmed) && !strings.HasPrefix(trimmed, "[["):
+			blockAttr = adocBlockAttr.FindStringSubmatch(trimmed)[1]
+			p.pos++
+			continue
+		case strings.HasPrefix(trimmed, "[[") && strings.HasSuffix(trimmed, "]]"):
+			fmt.Fprintf(&p.out, "<a id=\"%s\"></a>\n", html.EscapeString(trimmed[2:len(trimmed)-2]))
+			p.pos++
+			continue
+		case adocHeading.MatchString(line):
+			m := adocHeading.FindStringSubmatch(line)
+			level := len(m[1])
+			fmt.Fprintf(&p.out, "<h%d id=\"%s\">%s</h%d>\n", level, HeadingID(m[2]), p.inline(m[2]), level)
+			p.pos++
+		case trimmed == "----" || strings.HasPrefix(trimmed, "```"):
+			p.listing(trimmed, blockAttr)
+		case trimmed == "....":
+			code := strings.Join(p.delimited(trimmed), "\n")
+			fmt.Fprintf(&p.out, "<pre>%s</pre>\n", html.EscapeString(code))
+		case trimmed == "____":
+			inner := asciidocRenderer{}.Render([]byte(strings.Join(p.delimited(trimmed), "\n")), p.opts)
+			fmt.Fprintf(&p.out, "<blockquote>\n%s</blockquote>\n", inner)
+		case trimmed == "====" && isAdmonitionKind(blockAttr):
+			inner := asciidocRenderer{}.Render([]byte(strings.Join(p.delimited(trimmed), "\n")), p.opts)
+			p.admonition(blockAttr, inner)
+		case trimmed == "|===":
+			p.table(p.delimited(trimmed))
+		case trimmed == "'''" || trimmed == "---" || trimmed == "***":
+			p.out.WriteString("<hr>\n")
+			p.pos++
+		case adocImage.MatchString(trimmed):
+			m := adocImage.FindStringSubmatch(trimmed)
+			alt := strings.SplitN(m[2], ",", 2)[0]
+			fmt.Fprintf(&p.out, "<p><img src=\"%s\" alt=\"%s\"></p>\n", html.EscapeString(m[1]), html.EscapeString(alt))
+			p.pos++
+		case adocListItem.MatchString(trimmed):
+			p.list()
+		case adocAdmonish.MatchString(trimmed):
+			m := adocAdmonish.FindStringSubmatch(trimmed)
+			lines := append([]string{m[2]}, p.paragraphLines(p.pos+1)...)
+			p.admonition(m[1], "<p>"+p.inline(strings.Join(lines, " "))+"</p>\n")
+		default:
+			lines := append([]string{trimmed}, p.paragraphLines(p.pos+1)...)
+			fmt.Fprintf(&p.out, "<p>%s</p>\n", p.inline(strings.Join(lines, "\n")))
+		}
+		blockAttr = ""
+	}
+}
+
+func isAdmonitionKind(attr string) bool {
+	switch attr {
+	case "NOTE", "TIP", "IMPORTANT", "WARNING", "CAUTION":
+		return true
+	}
+	return false
+}
+
+func (p *adocParser) admonition(kind, inner string) {
+	kind = strings.ToLower(kind)
+	fmt.Fprintf(&p.out, "<div class=\"admonition admonition-%s\">\n<p class=\"admonition-title\">%s</p>\n%s</div>\n",
+		kind, admonitionTitles[kind], inner)
+}
+
+// paragraphLines collects lines from start until a blank line or block
+func (p *adocParser) paragraphLines(start int) []string {
+	var lines []string
+	for p.pos = start; p.pos < len(p.lines); p.pos++ {
+		line := strings.TrimSpace(p.lines[p.pos])
+		if line == "" || line == "----" || line == "...." || line == "|===" || adocHeading.MatchString(line) ||
+			adocListItem.MatchString(line) || adocBlockAttr.MatchString(line) {
+			break
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func (p *adocParser) listing(delim, attr string) {
+	lang := ""
+	if strings.HasPrefix(delim, "```") {
+		lang = strings.TrimPrefix(delim, "```")
+		delim = "```"
+	}
+	parts := strings.Split(attr, ",")
+	if len(parts) > 1 && strings.TrimSpace(parts[0]) == "source" {
+		lang = strings.TrimSpace(parts[1])
+	}
+
+	code := strings.Join(p.delimited(delim), "\n") + "\n"
+	htmlHighlight(&p.out, newFormatter(p.opts.LineNumbers, nil), code, lang, "")
+	p.out.WriteString("\n")
+}
+
+func (p *adocParser) list() {
+	type level struct {
+		marker string
+		tag    string
+	}
+	var stack []level
+
+	for p.pos < len(p.lines) {
+		m := adocListItem.FindStringSubmatch(strings.TrimSpace(p.lines[p.pos]))
+		if m == nil {
+			break
+		}
+		marker := m[1]
+		tag := "ul"
+		if strings.HasPrefix(marker, ".") {
+			tag = "ol"
+		}
+
+		depth := -1
+		for i, l := range stack {
+			if l.marker == marker {
+				depth = i
+			}
+		}
+		if depth < 0 {
+			stack = append(stack, level{marker, tag})
+			fmt.Fprintf(&p.out, "<%s>\n", tag)
+		} else {
+			for len(stack) > depth+1 {
+				fmt.Fprintf(&p.out, "</li>\n</%s>\n", stack[len(stack)-1].tag)
+				stack = stack[:len(stack)-1]
+			}
+			p.out.WriteString("</li>\n")
+		}
+
+		text := append([]string{m[2]}, p.continuation(p.pos+1)...)
+		fmt.Fprintf(&p.out, "<li>%s", p.inline(strings.Join(text, " ")))
+	}
+	for len(stack) > 0 {
+		fmt.Fprintf(&p.out, "</li>\n</%s>\n", stack[len(stack)-1].tag)
+		stack = stack[:len(stack)-1]
+	}
+}
+
+// continuation collects the lines wrapped below a list item
+func (p *adocParser) continuation(start int) []string {
+	var lines []string
+	for p.pos = start; p.pos < len(p.lines); p.pos++ {
+		line := strings.TrimSpace(p.lines[p.pos])
+		if line == "" {
+			// a blank line ends the list unless another item follows
+			if p.pos+1 < len(p.lines) && adocListItem.MatchString(strings.TrimSpace(p.lines[p.pos+1])) {
+				continue
+			}
+			break
+		}
+		if adocListItem.MatchString(line) || line == "+" {
+			break
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func (p *adocParser) table(lines []string) {
+	var rows [][]string
+	var row []string
+	// a blank line after the first row makes it the header
+	header := len(lines) > 1 && strings.HasPrefix(lines[0], "|") && strings.TrimSpace(lines[1]) == ""
+	cols := 0
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "|") {
+			continue
+		}
+		cells := strings.Split(line, "|")[1:]
+		if cols == 0 {
+			cols = len(cells)
+		}
+		for _, cell := range cells {
+			row = append(row, strings.TrimSpace(cell))
+			if len(row) == cols {
+				rows = append(rows, row)
+				row = nil
+			}
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+
+	p.out.WriteString("<table>\n")
+	for i, r := range rows {
+		tag := "td"
+		if i == 0 && header {
+			tag = "th"
+			p.out.WriteString("<thead>\n")
+		}
+		p.out.WriteString("<tr>")
+		for _, cell := range r {
+			fmt.Fprintf(&p.out, "<%s>%s</%s>", tag, p.inline(cell), tag)
+		}
+		p.out.WriteString("</tr>\n")
+		if i == 0 && header {
+			p.out.WriteString("</thead>\n")
+		}
+	}
+	p.out.WriteString("</table>\n")
+}
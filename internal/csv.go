@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// MaxTableRows is the number of csv rows rendered, doc.js pages through them
+var MaxTableRows = 10000
+
+type csvRenderer struct {
+	comma rune
+}
+
+func (r csvRenderer) Render(content []byte, opts RenderOptions) string {
+	return RenderTable(content, r.comma, "")
+}
+
+func (csvRenderer) Title(content []byte) string {
+	return ""
+}
+
+// RenderTable renders delimited data as a table, header is "true",
+// "false" or empty to detect it from the data
+func RenderTable(content []byte, comma rune, header string) string {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))))
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return `<p class="render-error">Invalid table: ` + html.EscapeString(err.Error()) + "</p>\n"
+	}
+	if len(rows) == 0 {
+		return "<div class=\"csv-table\"><table></table></div>\n"
+	}
+
+	hasHeader := header == "true" || header == "" && detectHeader(rows)
+	truncated := 0
+	if n := len(rows) - MaxTableRows; n > 0 {
+		truncated = n
+		rows = rows[:MaxTableRows]
+	}
+
+	// no blank lines, the table is also embedded as a markdown html block
+	var buf bytes.Buffer
+	buf.WriteString("<div class=\"csv-table\">\n<table>\n")
+	if hasHeader {
+		writeTableRow(&buf, rows[0], "th")
+		rows = rows[1:]
+		buf.WriteString("<tbody>\n")
+	}
+	for _, row := range rows {
+		writeTableRow(&buf, row, "td")
+	}
+	if hasHeader {
+		buf.WriteString("</tbody>\n")
+	}
+	buf.WriteString("</table>\n")
+	if truncated > 0 {
+		fmt.Fprintf(&buf, "<p class=\"csv-truncated\">%d more rows not shown.</p>\n", truncated)
+	}
+	buf.WriteString("</div>\n")
+	return buf.String()
+}
+
+func writeTableRow(buf *bytes.Buffer, row []string, tag string) {
+	if tag == "th" {
+		buf.WriteString("<thead>\n")
+	}
+	buf.WriteString("<tr>")
+	for _, cell := range row {
+		fmt.Fprintf(buf, "<%s>%s</%s>", tag, html.EscapeString(cell), tag)
+	}
+	buf.WriteString("</tr>\n")
+	if tag == "th" {
+		buf.WriteString("</thead>\n")
+	}
+}
+
+// detectHeader guesses whether the first row names the columns: its cells
+// are filled and unique, and not numbers where the data below is numeric
+func detectHeader(rows [][]string) bool {
+	if len(rows) < 2 {
+		return false
+	}
+
+	seen := map[string]bool{}
+	for _, cell := range rows[0] {
+		cell = strings.TrimSpace(cell)
+		if cell == "" || seen[cell] {
+			return false
+		}
+		seen[cell] = true
+	}
+
+	for col, cell := range rows[0] {
+		if isNumber(cell) {
+			return false
+		}
+		numeric := true
+		for _, row := range rows[1:] {
+			if col < len(row) && strings.TrimSpace(row[col]) != "" && !isNumber(row[col]) {
+				numeric = false
+				break
+			}
+		}
+		if numeric {
+			return true
+		}
+	}
+
+	// all text: a header when no cell of the first row shows up below it
+	for _, row := range rows[1:] {
+		for col, cell := range row {
+			if col < len(rows[0]) && strings.TrimSpace(cell) == strings.TrimSpace(rows[0][col]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(s), ",", ""), 64)
+	return err == nil
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderTable(t *testing.T) {
+	tests := []struct {
+		content string
+		comma   rune
+		header  string
+		want    []string
+		not     []string
+	}{
+		// text header above numbers
+		{"\xef\xbb\xbfname,size\nlogo.png,\"1,024\"\nbanner.png,512\n", ',', "",
+			[]string{"<thead>\n<tr><th>name</th><th>size</th></tr>\n</thead>\n<tbody>\n", "<td>logo.png</td><td>1,024</td>"}, nil},
+		// numbers only: no header
+		{"1,2\n3,4\n", ',', "", []string{"<tr><td>1</td><td>2</td></tr>"}, []string{"<th>"}},
+		// the first row repeats below: no header
+		{"a,b\na,c\n", ',', "", []string{"<td>a</td><td>b</td>"}, []string{"<th>"}},
+		{"1,2\n3,4\n", ',', "true", []string{"<th>1</th><th>2</th>"}, nil},
+		{"key,value\nx,y\n", ',', "false", []string{"<td>key</td>"}, []string{"<th>"}},
+		{"key\tvalue\n<b>\ta \"b\"\n", '\t', "", []string{"<th>key</th><th>value</th>", "<td>&lt;b&gt;</td><td>a &#34;b&#34;</td>"}, nil},
+		// rows of different lengths
+		{"a,b,c\nx\n", ',', "true", []string{"<td>x</td></tr>"}, nil},
+		{"", ',', "", []string{"<table></table>"}, nil},
+	}
+	for _, test := range tests {
+		out := RenderTable([]byte(test.content), test.comma, test.header)
+		for _, want := range test.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("table of %q lacks %q:\n%s", test.content, want, out)
+			}
+		}
+		for _, not := range test.not {
+			if strings.Contains(out, not) {
+				t.Errorf("table of %q has %q:\n%s", test.content, not, out)
+			}
+		}
+		if strings.Contains(out, "\n\n") {
+			t.Errorf("table of %q has a blank line:\n%s", test.content, out)
+		}
+	}
+}
+
+func TestRenderTableTruncated(t *testing.T) {
+	defer func(rows int) { MaxTableRows = rows }(MaxTableRows)
+	MaxTableRows = 2
+
+	out := RenderTable([]byte("a\nb\nc\nd\n"), ',', "false")
+	if strings.Count(out, "<tr>") != 2 || !strings.Contains(out, "2 more rows not shown.") {
+		t.Errorf("truncated table:\n%s", out)
+	}
+}
+
+func TestExpandIncludesCSV(t *testing.T) {
+	files := map[string]string{
+		"data/fields.csv": "name,type\nid,int\n",
+		"data/fields.tsv": "name\ttype\nid\tint\n",
+		"data/semi.txt":   "name;type\nid;int\n",
+	}
+	content := "{{< csv \"../data/fields.csv\" >}}\n\n{{< csv \"/data/fields.tsv\" >}}\n\n" +
+		"{{< csv \"/data/semi.txt\" delimiter=\";\" header=\"false\" >}}\n"
+	var read []string
+	out := string(ExpandIncludes([]byte(content), "docs/a.md", testReader(files, &read)))
+
+	if strings.Count(out, "<th>name</th><th>type</th>") != 2 || !strings.Contains(out, "<td>name</td><td>type</td>") {
+		t.Errorf("csv includes: %s", out)
+	}
+	html := Render2Html([]byte(out), RenderOptions{})
+	if strings.Count(html, `<div class="csv-table">`) != 3 || strings.Contains(html, "&lt;td") {
+		t.Errorf("csv includes rendered as %s", html)
+	}
+}
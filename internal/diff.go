@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"strings"
+
+	nethtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	// diffContext unchanged blocks are kept around changes
+	diffContext = 2
+	// maxDiffBlocks bounds the quadratic diff, larger documents are shown
+	// as replaced
+	maxDiffBlocks = 3000
+)
+
+// htmlBlocks splits rendered html into its top level elements
+func htmlBlocks(content string) []string {
+	context := &nethtml.Node{Type: nethtml.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := nethtml.ParseFragment(strings.NewReader(content), context)
+	if err != nil {
+		return []string{content}
+	}
+	var blocks []string
+	for _, node := range nodes {
+		if node.Type == nethtml.TextNode && strings.TrimSpace(node.Data) == "" {
+			continue
+		}
+		var b strings.Builder
+		if err := nethtml.Render(&b, node); err == nil {
+			blocks = append(blocks, b.String())
+		}
+	}
+	return blocks
+}
+
+// RenderDiff compares two rendered documents block by block, removed
+// blocks are marked diff-del and added ones diff-ins. Long unchanged runs
+// are folded.
+func RenderDiff(oldHTML, newHTML string) string {
+	a, b := htmlBlocks(oldHTML), htmlBlocks(newHTML)
+
+	type op struct {
+		kind  byte
+		block string
+	}
+	var ops []op
+	if len(a) > maxDiffBlocks || len(b) > maxDiffBlocks {
+		for _, block := range a {
+			ops = append(ops, op{'-', block})
+		}
+		for _, block := range b {
+			ops = append(ops, op{'+', block})
+		}
+	} else {
+		// longest common subsequence of the blocks
+		lcs := make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(a) || j < len(b) {
+			switch {
+			case i < len(a) && j < len(b) && a[i] == b[j]:
+				ops = append(ops, op{'=', a[i]})
+				i++
+				j++
+			case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+				ops = append(ops, op{'+', b[j]})
+				j++
+			default:
+				ops = append(ops, op{'-', a[i]})
+				i++
+			}
+		}
+	}
+
+	// unchanged blocks near a change are shown
+	show := make([]bool, len(ops))
+	for k, o := range ops {
+		if o.kind == '=' {
+			continue
+		}
+		for d := k - diffContext; d <= k+diffContext; d++ {
+			if d >= 0 && d < len(ops) {
+				show[d] = true
+			}
+		}
+	}
+
+	var out strings.Builder
+	out.WriteString(`<div class="diff">`)
+	folded := false
+	for k, o := range ops {
+		switch {
+		case o.kind == '-':
+			out.WriteString(`<div class="diff-del">` + o.block + `</div>`)
+		case o.kind == '+':
+			out.WriteString(`<div class="diff-ins">` + o.block + `</div>`)
+		case show[k]:
+			out.WriteString(`<div class="diff-same">` + o.block + `</div>`)
+		default:
+			if !folded {
+				out.WriteString(`<div class="diff-fold">&#8943;</div>`)
+			}
+			folded = true
+			continue
+		}
+		folded = false
+	}
+	out.WriteString(`</div>`)
+	return out.String()
+}
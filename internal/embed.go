@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+	mdhtml "github.com/gomarkdown/markdown/html"
+)
+
+// ![title](file.pdf) and friends embed a viewer instead of an image
+var embedKinds = map[string]string{
+	".pdf":  "pdf",
+	".mp4":  "video",
+	".webm": "video",
+	".ogv":  "video",
+	".mov":  "video",
+	".mp3":  "audio",
+	".ogg":  "audio",
+	".wav":  "audio",
+	".m4a":  "audio",
+}
+
+func embedKind(dest []byte) (kind, name string) {
+	u, err := url.Parse(string(dest))
+	if err != nil {
+		return "", ""
+	}
+	return embedKinds[strings.ToLower(path.Ext(u.Path))], path.Base(u.Path)
+}
+
+// isLocal reports whether dest points into the same site
+func isLocal(dest []byte) bool {
+	u, err := url.Parse(string(dest))
+	return err == nil && u.Scheme == "" && u.Host == ""
+}
+
+// resolveAssets points local images and embeds at the urls resolve
+// gives them
+func resolveAssets(doc ast.Node, resolve func(src string) (string, bool)) {
+	if resolve == nil {
+		return
+	}
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		image, ok := node.(*ast.Image)
+		if !ok || !entering || !isLocal(image.Destination) {
+			return ast.GoToNext
+		}
+		if u, ok := resolve(string(image.Destination)); ok {
+			image.Destination = []byte(u)
+		}
+		return ast.GoToNext
+	})
+}
+
+func imageAlt(image *ast.Image) []byte {
+	var alt bytes.Buffer
+	ast.WalkFunc(image, func(node ast.Node, entering bool) ast.WalkStatus {
+		if leaf := node.AsLeaf(); leaf != nil && entering {
+			alt.Write(leaf.Literal)
+		}
+		return ast.GoToNext
+	})
+	return alt.Bytes()
+}
+
+// renderEmbed writes pdf, video and audio images as players, it reports
+// false for plain images
+func renderEmbed(w io.Writer, image *ast.Image, entering bool) bool {
+	kind, name := embedKind(image.Destination)
+	if kind == "" {
+		return false
+	}
+	if !entering {
+		return true
+	}
+
+	src := image.Destination
+	label := imageAlt(image)
+	if len(label) == 0 {
+		label = []byte(name)
+	}
+
+	// a span, images sit inside paragraphs
+	io.WriteString(w, `<span class="embed embed-`+kind+`">`)
+	switch {
+	case kind == "pdf" && isLocal(src):
+		// pdfs from other sites are only linked
+		io.WriteString(w, `<object type="application/pdf" data="`)
+		mdhtml.EscapeHTML(w, src)
+		io.WriteString(w, `"></object>`)
+	case kind == "video" || kind == "audio":
+		io.WriteString(w, `<`+kind+` controls preload="metadata" src="`)
+		mdhtml.EscapeHTML(w, src)
+		io.WriteString(w, `"`)
+		if len(image.Title) > 0 {
+			io.WriteString(w, ` title="`)
+			mdhtml.EscapeHTML(w, image.Title)
+			io.WriteString(w, `"`)
+		}
+		io.WriteString(w, `></`+kind+`>`)
+	}
+	io.WriteString(w, `<a class="embed-download" href="`)
+	mdhtml.EscapeHTML(w, src)
+	io.WriteString(w, `">Download `)
+	mdhtml.EscapeHTML(w, label)
+	io.WriteString(w, `</a></span>`)
+	return true
+}
@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderEmbeds(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"![Spec](files/spec.pdf)",
+			`<span class="embed embed-pdf"><object type="application/pdf" data="files/spec.pdf"></object>` +
+				`<a class="embed-download" href="files/spec.pdf">Download Spec</a></span>`},
+		// pdfs from other sites are only linked
+		{"![](https://example.com/x.PDF)",
+			`<span class="embed embed-pdf"><a class="embed-download" href="https://example.com/x.PDF">Download x.PDF</a></span>`},
+		{`![Demo](/media/demo.mp4?v=1&t=2 "The demo")`,
+			`<span class="embed embed-video"><video controls preload="metadata" src="/media/demo.mp4?v=1&amp;t=2" title="The demo"></video>` +
+				`<a class="embed-download" href="/media/demo.mp4?v=1&amp;t=2">Download Demo</a></span>`},
+		{"![](talk.mp3)",
+			`<span class="embed embed-audio"><audio controls preload="metadata" src="talk.mp3"></audio>` +
+				`<a class="embed-download" href="talk.mp3">Download talk.mp3</a></span>`},
+		{"![Logo](logo.png)", `<img src="logo.png" alt="Logo"`},
+	}
+	for _, test := range tests {
+		out := Render2Html([]byte(test.content), RenderOptions{})
+		if !strings.Contains(out, test.want) {
+			t.Errorf("Render2Html(%q) = %s, want %s", test.content, out, test.want)
+		}
+	}
+}
+
+func TestSanitizeEmbeds(t *testing.T) {
+	out := Render2Html([]byte("![Spec](spec.pdf) ![](demo.webm) ![](talk.ogg)"), RenderOptions{})
+	for _, policy := range []string{SanitizeStrict, SanitizeIframe} {
+		clean := Sanitize(out, policy, testIframeHosts)
+		for _, want := range []string{`<object type="application/pdf" data="spec.pdf">`, `<video controls="" preload="metadata" src="demo.webm">`,
+			`<audio controls="" preload="metadata" src="talk.ogg">`, `<a class="embed-download" href="spec.pdf"`} {
+			if !strings.Contains(clean, want) {
+				t.Errorf("%s policy dropped %s: %s", policy, want, clean)
+			}
+		}
+	}
+}
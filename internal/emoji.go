@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"io"
+	"regexp"
+
+	"github.com/gomarkdown/markdown/ast"
+	mdhtml "github.com/gomarkdown/markdown/html"
+	"github.com/kyokomi/emoji/v2"
+)
+
+// Emoji is a :shortcode: with a custom image
+type Emoji struct {
+	ast.Leaf
+
+	Name string
+	URL  string
+}
+
+var emojiRegexp = regexp.MustCompile(`:([a-z0-9_+-]+):`)
+
+// parseEmoji replaces :shortcodes: in text nodes by their emoji, custom
+// maps names to image urls and takes precedence over the bundled table
+func parseEmoji(doc ast.Node, custom map[string]string) {
+	var texts []*ast.Text
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if text, ok := node.(*ast.Text); ok && entering && emojiRegexp.Match(text.Literal) {
+			texts = append(texts, text)
+		}
+		return ast.GoToNext
+	})
+
+	codes := emoji.CodeMap()
+	for _, text := range texts {
+		var nodes []ast.Node
+		var literal []byte
+		last := 0
+		for _, m := range emojiRegexp.FindAllSubmatchIndex(text.Literal, -1) {
+			// "a:b:c:" shares colons between matches, skip overlaps
+			if m[0] < last {
+				continue
+			}
+			name := string(text.Literal[m[2]:m[3]])
+			if url, ok := custom[name]; ok {
+				literal = append(literal, text.Literal[last:m[0]]...)
+				if len(literal) > 0 {
+					nodes = append(nodes, &ast.Text{Leaf: ast.Leaf{Literal: literal}})
+					literal = nil
+				}
+				nodes = append(nodes, &Emoji{Name: name, URL: url})
+				last = m[1]
+			} else if code, ok := codes[":"+name+":"]; ok {
+				literal = append(literal, text.Literal[last:m[0]]...)
+				literal = append(literal, code...)
+				last = m[1]
+			}
+		}
+		if last == 0 {
+			continue
+		}
+		literal = append(literal, text.Literal[last:]...)
+		if len(literal) > 0 {
+			nodes = append(nodes, &ast.Text{Leaf: ast.Leaf{Literal: literal}})
+		}
+		replaceNode(text, nodes...)
+	}
+}
+
+func renderEmoji(w io.Writer, e *Emoji) {
+	io.WriteString(w, `<img class="emoji" src="`)
+	mdhtml.EscapeHTML(w, []byte(e.URL))
+	io.WriteString(w, `" alt="`+e.Name+`" title="`+e.Name+`">`)
+}
@@ -0,0 +1,33 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderEmoji(t *testing.T) {
+	opts := RenderOptions{CustomEmoji: map[string]string{"party": "/doc/demo/.md-doc/emoji/party.png?v=1&x=2", "tada": "/tada.png"}}
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"Done :rocket:!", "Done 🚀!"},
+		{"**:+1:** ok", "<strong>👍</strong> ok"},
+		{"Let us :party:", `Let us <img class="emoji" src="/doc/demo/.md-doc/emoji/party.png?v=1&amp;x=2" alt="party" title="party">`},
+		// custom emoji take precedence over the bundled ones
+		{":tada:", `<img class="emoji" src="/tada.png" alt="tada" title="tada">`},
+		{"at 12:30:00 :nope:", "at 12:30:00 :nope:"},
+		{"a:rocket:rocket:", "a🚀rocket:"},
+		{"`:rocket:`", "<code>:rocket:</code>"},
+	}
+	for _, test := range tests {
+		out := Render2Html([]byte(test.content), opts)
+		if !strings.Contains(out, test.want) {
+			t.Errorf("Render2Html(%q) = %q, want %q", test.content, out, test.want)
+		}
+	}
+
+	if out := Render2Html([]byte("```\n:rocket:\n```\n"), opts); strings.Contains(out, "🚀") {
+		t.Errorf("emoji in a code block: %s", out)
+	}
+}
@@ -0,0 +1,265 @@
+package internal
+
+import (
+	"archive/zip"
+	"fmt"
+	"hash/crc32"
+	"html"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	nethtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// EPUBOptions describes an epub book
+type EPUBOptions struct {
+	Title      string
+	Identifier string
+	Language   string
+	// Date is the modification date of the book and of its files
+	Date time.Time
+	// CSS styles the chapters after the book styles, e.g. chroma classes
+	CSS string
+}
+
+// EPUBChapter is a document of a book, Path is relative to the content
+// directory and ends in .xhtml
+type EPUBChapter struct {
+	Path     string
+	Title    string
+	HTML     string
+	Headings []Heading
+}
+
+// EPUBResource is a file the chapters link to, e.g. an image
+type EPUBResource struct {
+	Path      string
+	MediaType string
+	Data      []byte
+}
+
+// EPUBContentDir holds the chapters and resources inside the book
+const EPUBContentDir = "content"
+
+const epubCSS = `body { font-family: serif; line-height: 1.5; }
+h1, h2, h3, h4 { font-family: sans-serif; line-height: 1.2; }
+pre, code { font-family: monospace; font-size: 0.9em; }
+pre { white-space: pre-wrap; padding: 0.5em; border: 1px solid #ddd; }
+blockquote { margin-left: 1em; padding-left: 1em; border-left: 3px solid #ddd; color: #555; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.5em; }
+img { max-width: 100%; }
+img.emoji { height: 1em; vertical-align: middle; }
+.admonition { margin: 1em 0; padding: 0.5em 1em; border-left: 4px solid #888; }
+.admonition-title { font-weight: bold; }
+`
+
+// WriteEPUB writes an epub 3 book of chapters with a navigation document
+// built from their headings. The zip only depends on its input, so books
+// of the same commit are identical.
+func WriteEPUB(w io.Writer, chapters []EPUBChapter, resources []EPUBResource, opts EPUBOptions) error {
+	if opts.Language == "" {
+		opts.Language = "en"
+	}
+	z := zip.NewWriter(w)
+
+	// mimetype comes first, stored and without extra fields
+	mimetype := []byte("application/epub+zip")
+	mw, err := z.CreateRaw(&zip.FileHeader{
+		Name:               "mimetype",
+		Method:             zip.Store,
+		ModifiedDate:       1<<5 | 1, // 1980-01-01, msdos dates start there
+		CRC32:              crc32.ChecksumIEEE(mimetype),
+		CompressedSize64:   uint64(len(mimetype)),
+		UncompressedSize64: uint64(len(mimetype)),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := mw.Write(mimetype); err != nil {
+		return err
+	}
+
+	write := func(name string, data []byte) error {
+		fw, err := z.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: opts.Date.UTC()})
+		if err != nil {
+			return err
+		}
+		_, err = fw.Write(data)
+		return err
+	}
+
+	container := `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="EPUB/package.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+	if err := write("META-INF/container.xml", []byte(container)); err != nil {
+		return err
+	}
+	if err := write("EPUB/style.css", []byte(epubCSS+opts.CSS)); err != nil {
+		return err
+	}
+	if err := write("EPUB/nav.xhtml", []byte(epubNav(chapters, opts))); err != nil {
+		return err
+	}
+
+	properties := make([]string, len(chapters))
+	for i, chapter := range chapters {
+		body, err := toXHTML(chapter.HTML)
+		if err != nil {
+			return fmt.Errorf("%s: %w", chapter.Path, err)
+		}
+		properties[i] = epubProperties(body)
+		if err := write("EPUB/"+EPUBContentDir+"/"+chapter.Path, []byte(epubChapter(chapter, body, opts))); err != nil {
+			return err
+		}
+	}
+	for _, resource := range resources {
+		if err := write("EPUB/"+EPUBContentDir+"/"+resource.Path, resource.Data); err != nil {
+			return err
+		}
+	}
+
+	if err := write("EPUB/package.opf", []byte(epubPackage(chapters, properties, resources, opts))); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+// toXHTML reserializes rendered html as xml, void elements closed
+func toXHTML(content string) (string, error) {
+	context := &nethtml.Node{Type: nethtml.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := nethtml.ParseFragment(strings.NewReader(content), context)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, node := range nodes {
+		if err := nethtml.Render(&b, node); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+// epubProperties are the manifest properties a chapter needs
+func epubProperties(body string) string {
+	var props []string
+	if strings.Contains(body, "<math") {
+		props = append(props, "mathml")
+	}
+	if strings.Contains(body, "<svg") {
+		props = append(props, "svg")
+	}
+	if strings.Contains(body, `src="http://`) || strings.Contains(body, `src="https://`) {
+		props = append(props, "remote-resources")
+	}
+	return strings.Join(props, " ")
+}
+
+// epubHref escapes a file name for a link, names may have spaces
+func epubHref(file string) string {
+	return (&url.URL{Path: file}).String()
+}
+
+func epubHead(title, css string, opts EPUBOptions) string {
+	lang := html.EscapeString(opts.Language)
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="` + lang + `" lang="` + lang + `">
+<head>
+<meta charset="utf-8"/>
+<title>` + html.EscapeString(title) + `</title>
+<link rel="stylesheet" type="text/css" href="` + html.EscapeString(css) + `"/>
+</head>
+`
+}
+
+func epubChapter(chapter EPUBChapter, body string, opts EPUBOptions) string {
+	css := strings.Repeat("../", strings.Count(chapter.Path, "/")+1) + "style.css"
+	var b strings.Builder
+	b.WriteString(epubHead(chapter.Title, css, opts))
+	b.WriteString("<body>\n<section epub:type=\"chapter\">\n")
+	if !strings.HasPrefix(strings.TrimSpace(body), "<h1") {
+		b.WriteString("<h1>" + html.EscapeString(chapter.Title) + "</h1>\n")
+	}
+	b.WriteString(body)
+	b.WriteString("\n</section>\n</body>\n</html>\n")
+	return b.String()
+}
+
+// epubNav lists the chapters with their second and third level headings
+func epubNav(chapters []EPUBChapter, opts EPUBOptions) string {
+	var b strings.Builder
+	b.WriteString(epubHead(opts.Title, "style.css", opts))
+	b.WriteString("<body>\n<nav epub:type=\"toc\" id=\"toc\">\n<h1>Contents</h1>\n<ol>\n")
+	for _, chapter := range chapters {
+		href := epubHref(EPUBContentDir + "/" + chapter.Path)
+		b.WriteString(`<li><a href="` + html.EscapeString(href) + `">` + html.EscapeString(chapter.Title) + "</a>")
+
+		var open []int
+		for _, h := range chapter.Headings {
+			if h.Level != 2 && h.Level != 3 || h.ID == "" {
+				continue
+			}
+			// close deeper lists, open one when going down a level
+			for len(open) > 0 && open[len(open)-1] > h.Level {
+				b.WriteString("</li></ol>")
+				open = open[:len(open)-1]
+			}
+			if len(open) > 0 && open[len(open)-1] == h.Level {
+				b.WriteString("</li>")
+			} else {
+				b.WriteString("<ol>")
+				open = append(open, h.Level)
+			}
+			b.WriteString(`<li><a href="` + html.EscapeString(href+"#"+h.ID) + `">` + html.EscapeString(h.Text) + "</a>")
+		}
+		for range open {
+			b.WriteString("</li></ol>")
+		}
+		b.WriteString("</li>\n")
+	}
+	b.WriteString("</ol>\n</nav>\n</body>\n</html>\n")
+	return b.String()
+}
+
+func epubPackage(chapters []EPUBChapter, properties []string, resources []EPUBResource, opts EPUBOptions) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+`)
+	fmt.Fprintf(&b, "<dc:identifier id=\"uid\">%s</dc:identifier>\n", html.EscapeString(opts.Identifier))
+	fmt.Fprintf(&b, "<dc:title>%s</dc:title>\n", html.EscapeString(opts.Title))
+	fmt.Fprintf(&b, "<dc:language>%s</dc:language>\n", html.EscapeString(opts.Language))
+	fmt.Fprintf(&b, "<meta property=\"dcterms:modified\">%s</meta>\n", opts.Date.UTC().Format("2006-01-02T15:04:05Z"))
+	b.WriteString("</metadata>\n<manifest>\n")
+	b.WriteString("<item id=\"nav\" href=\"nav.xhtml\" media-type=\"application/xhtml+xml\" properties=\"nav\"/>\n")
+	b.WriteString("<item id=\"style\" href=\"style.css\" media-type=\"text/css\"/>\n")
+	for i, chapter := range chapters {
+		props := ""
+		if properties[i] != "" {
+			props = ` properties="` + properties[i] + `"`
+		}
+		fmt.Fprintf(&b, "<item id=\"c%d\" href=\"%s\" media-type=\"application/xhtml+xml\"%s/>\n",
+			i+1, html.EscapeString(epubHref(path.Join(EPUBContentDir, chapter.Path))), props)
+	}
+	for i, resource := range resources {
+		fmt.Fprintf(&b, "<item id=\"r%d\" href=\"%s\" media-type=\"%s\"/>\n",
+			i+1, html.EscapeString(epubHref(path.Join(EPUBContentDir, resource.Path))), html.EscapeString(resource.MediaType))
+	}
+	b.WriteString("</manifest>\n<spine>\n")
+	for i := range chapters {
+		fmt.Fprintf(&b, "<itemref idref=\"c%d\"/>\n", i+1)
+	}
+	b.WriteString("</spine>\n</package>\n")
+	return b.String()
+}
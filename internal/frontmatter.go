@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"bytes"
+
+	"gopkg.in/yaml.v3"
+)
+
+var frontMatterFence = []byte("---")
+
+// SplitFrontMatter cuts the yaml block between "---" lines at the start
+// of a markdown document from its body. A document without one, or with
+// a block that isn't a yaml map, is all body.
+func SplitFrontMatter(file string, content []byte) (map[string]interface{}, []byte) {
+	if !IsMarkdown(file) || !bytes.HasPrefix(content, frontMatterFence) {
+		return nil, content
+	}
+	rest := content[len(frontMatterFence):]
+	if len(rest) > 0 && rest[0] == '\r' {
+		rest = rest[1:]
+	}
+	if len(rest) == 0 || rest[0] != '\n' {
+		return nil, content
+	}
+	rest = rest[1:]
+
+	for offset := 0; offset < len(rest); {
+		end := bytes.IndexByte(rest[offset:], '\n')
+		line := rest[offset:]
+		next := len(rest)
+		if end >= 0 {
+			line = rest[offset : offset+end]
+			next = offset + end + 1
+		}
+		if string(bytes.TrimRight(line, " \t\r")) == "---" {
+			var meta map[string]interface{}
+			if err := yaml.Unmarshal(rest[:offset], &meta); err != nil {
+				return nil, content
+			}
+			if meta == nil {
+				meta = map[string]interface{}{}
+			}
+			return meta, rest[next:]
+		}
+		offset = next
+	}
+	return nil, content
+}
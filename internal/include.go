@@ -0,0 +1,187 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// include directives are expanded before rendering:
+//
+//	{{< include "shared/prereqs.md" >}}
+//	{{< code "examples/main.go" lines="10-30" >}}
+//	{{< csv "data/fields.csv" header="true" >}}
+//
+// paths are relative to the including file, or to the repo root when
+// they start with a slash
+
+const maxIncludeDepth = 8
+
+var (
+	includeRegexp = regexp.MustCompile(`\{\{<\s*(include|code|csv)\s+"([^"]+)"((?:\s+\w+="[^"]*")*)\s*>\}\}`)
+	paramRegexp   = regexp.MustCompile(`(\w+)="([^"]*)"`)
+	fenceRegexp   = regexp.MustCompile("^\\s{0,3}(```|~~~)")
+)
+
+// ReadFunc reads a file of the repo by its path from the repo root
+type ReadFunc func(file string) ([]byte, error)
+
+type includer struct {
+	read  ReadFunc
+	stack []string
+}
+
+// ExpandIncludes replaces include, code and csv directives of file by the
+// content they point to. Failed includes render as a caution block.
+func ExpandIncludes(content []byte, file string, read ReadFunc) []byte {
+	inc := &includer{read: read, stack: []string{path.Clean("/" + file)}}
+	return inc.expand(content, file)
+}
+
+// ResolvePath joins target to the directory of file and rejects
+// paths leaving the repo
+func ResolvePath(file, target string) (string, error) {
+	var p string
+	if strings.HasPrefix(target, "/") {
+		p = path.Clean(strings.TrimLeft(target, "/"))
+	} else {
+		p = path.Join(path.Dir(file), target)
+	}
+	if p == ".." || strings.HasPrefix(p, "../") || p == "." {
+		return "", errors.New("path outside of repo")
+	}
+	return p, nil
+}
+
+func (inc *includer) expand(content []byte, file string) []byte {
+	if !bytes.Contains(content, []byte("{{<")) {
+		return content
+	}
+
+	var out bytes.Buffer
+	fence := ""
+	for _, line := range bytes.SplitAfter(content, []byte("\n")) {
+		// directives in code blocks are shown as written
+		if m := fenceRegexp.FindSubmatch(line); m != nil {
+			if fence == "" {
+				fence = string(m[1])
+			} else if fence == string(m[1]) {
+				fence = ""
+			}
+		}
+		if fence != "" {
+			out.Write(line)
+			continue
+		}
+
+		out.Write(includeRegexp.ReplaceAllFunc(line, func(directive []byte) []byte {
+			m := includeRegexp.FindSubmatch(directive)
+			params := map[string]string{}
+			for _, p := range paramRegexp.FindAllSubmatch(m[3], -1) {
+				params[string(p[1])] = string(p[2])
+			}
+			res, err := inc.include(string(m[1]), file, string(m[2]), params)
+			if err != nil {
+				return []byte(fmt.Sprintf("\n\n:::caution Include failed\n`%s`: %s\n:::\n\n", m[2], err))
+			}
+			return res
+		}))
+	}
+	return out.Bytes()
+}
+
+func (inc *includer) include(kind, file, target string, params map[string]string) ([]byte, error) {
+	p, err := ResolvePath(file, target)
+	if err != nil {
+		return nil, err
+	}
+	if len(inc.stack) >= maxIncludeDepth {
+		return nil, errors.New("too many nested includes")
+	}
+	for _, parent := range inc.stack {
+		if parent == "/"+p {
+			return nil, errors.New("include cycle")
+		}
+	}
+
+	content, err := inc.read(p)
+	if err != nil {
+		return nil, errors.New("file not found")
+	}
+	if lines, ok := params["lines"]; ok {
+		content, err = selectLines(content, lines)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if kind == "csv" {
+		comma := ','
+		if path.Ext(p) == ".tsv" || params["delimiter"] == "tab" {
+			comma = '\t'
+		} else if d := []rune(params["delimiter"]); len(d) == 1 {
+			comma = d[0]
+		}
+		return []byte("\n\n" + RenderTable(content, comma, params["header"]) + "\n"), nil
+	}
+	if kind == "code" {
+		lang := params["lang"]
+		if lang == "" {
+			lang = strings.TrimPrefix(path.Ext(p), ".")
+		}
+		return codeFence(content, lang), nil
+	}
+
+	inc.stack = append(inc.stack, "/"+p)
+	defer func() { inc.stack = inc.stack[:len(inc.stack)-1] }()
+	return inc.expand(content, p), nil
+}
+
+// selectLines keeps the 1-based inclusive range "10-30", "10-" or "10"
+func selectLines(content []byte, spec string) ([]byte, error) {
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	from, to := spec, spec
+	if i := strings.Index(spec, "-"); i >= 0 {
+		from, to = spec[:i], spec[i+1:]
+	}
+
+	start, err := strconv.Atoi(strings.TrimSpace(from))
+	if err != nil || start < 1 {
+		return nil, fmt.Errorf("bad line range %q", spec)
+	}
+	end := len(lines)
+	if strings.TrimSpace(to) != "" {
+		end, err = strconv.Atoi(strings.TrimSpace(to))
+		if err != nil || end < start {
+			return nil, fmt.Errorf("bad line range %q", spec)
+		}
+	}
+	if start > len(lines) {
+		return nil, nil
+	}
+	if end > len(lines) {
+		end = len(lines)
+	}
+	return bytes.Join(lines[start-1:end], nil), nil
+}
+
+// codeFence wraps code in a fence longer than any backtick run inside it
+func codeFence(code []byte, lang string) []byte {
+	fence := "```"
+	for bytes.Contains(code, []byte(fence)) {
+		fence += "`"
+	}
+
+	var out bytes.Buffer
+	out.WriteString("\n" + fence + lang + "\n")
+	out.Write(code)
+	if len(code) > 0 && code[len(code)-1] != '\n' {
+		out.WriteByte('\n')
+	}
+	out.WriteString(fence + "\n")
+	return out.Bytes()
+}
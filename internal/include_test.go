@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testReader reads files from a map, remembering what was read
+func testReader(files map[string]string, read *[]string) ReadFunc {
+	return func(file string) ([]byte, error) {
+		*read = append(*read, file)
+		content, ok := files[file]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return []byte(content), nil
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	tests := []struct {
+		file, target, want string
+	}{
+		{"docs/a.md", "b.md", "docs/b.md"},
+		{"docs/a.md", "./parts/b.md", "docs/parts/b.md"},
+		{"docs/a.md", "../b.md", "b.md"},
+		{"docs/a.md", "/shared/b.md", "shared/b.md"},
+		{"docs/a.md", "//shared//b.md", "shared/b.md"},
+		{"a.md", "../b.md", ""},
+		{"docs/a.md", "../../b.md", ""},
+		{"docs/a.md", "/../b.md", ""},
+		{"docs/a.md", "parts/../../../b.md", ""},
+		{"docs/a.md", "..", ""},
+		{"a.md", ".", ""},
+	}
+	for _, test := range tests {
+		got, err := ResolvePath(test.file, test.target)
+		if got != test.want || (err != nil) != (test.want == "") {
+			t.Errorf("ResolvePath(%q, %q) = %q, %v, want %q", test.file, test.target, got, err, test.want)
+		}
+	}
+}
+
+func TestExpandIncludesDepth(t *testing.T) {
+	files := map[string]string{}
+	for i := 1; i <= maxIncludeDepth+2; i++ {
+		files[fmt.Sprintf("d%d.md", i)] = fmt.Sprintf("level %d\n\n{{< include \"d%d.md\" >}}\n", i, i+1)
+	}
+	var read []string
+	out := string(ExpandIncludes([]byte("{{< include \"d1.md\" >}}\n"), "d0.md", testReader(files, &read)))
+
+	if !strings.Contains(out, fmt.Sprintf("level %d\n", maxIncludeDepth-1)) {
+		t.Errorf("includes stopped early: %s", out)
+	}
+	if strings.Contains(out, fmt.Sprintf("level %d\n", maxIncludeDepth)) || !strings.Contains(out, "too many nested includes") {
+		t.Errorf("includes nested past the limit: %s", out)
+	}
+	if len(read) != maxIncludeDepth-1 {
+		t.Errorf("read %v", read)
+	}
+}
+
+func TestExpandIncludesCycle(t *testing.T) {
+	files := map[string]string{
+		"a.md":      "a\n\n{{< include \"b.md\" >}}\n",
+		"b.md":      "b\n\n{{< include \"/a.md\" >}}\n",
+		"self.md":   "self\n\n{{< include \"self.md\" >}}\n",
+		"part.md":   "part\n",
+		"twice.md":  "{{< include \"part.md\" >}}\n{{< include \"part.md\" >}}\n",
+		"nested.md": "{{< include \"twice.md\" >}}\n",
+	}
+	expand := func(file string) string {
+		var read []string
+		return string(ExpandIncludes([]byte(files[file]), file, testReader(files, &read)))
+	}
+
+	if out := expand("a.md"); strings.Count(out, "include cycle") != 1 || strings.Count(out, "\nb\n") != 1 {
+		t.Errorf("cycle a, b, a: %s", out)
+	}
+	if out := expand("self.md"); !strings.Contains(out, "include cycle") {
+		t.Errorf("self include: %s", out)
+	}
+	// the same file twice side by side is no cycle
+	if out := expand("nested.md"); strings.Count(out, "part\n") != 2 || strings.Contains(out, "Include failed") {
+		t.Errorf("repeated include: %s", out)
+	}
+}
+
+func TestExpandIncludesOutsideRepo(t *testing.T) {
+	files := map[string]string{"docs/part.md": "part\n"}
+	var read []string
+	content := "{{< include \"../../secret.md\" >}}\n{{< code \"/../etc/passwd\" >}}\n{{< csv \"../../x.csv\" >}}\n" +
+		"{{< include \"../docs/part.md\" >}}\n"
+	out := string(ExpandIncludes([]byte(content), "docs/a.md", testReader(files, &read)))
+
+	if strings.Count(out, "path outside of repo") != 3 {
+		t.Errorf("paths leaving the repo expanded: %s", out)
+	}
+	if !strings.Contains(out, "part\n") || len(read) != 1 || read[0] != "docs/part.md" {
+		t.Errorf("read %v: %s", read, out)
+	}
+}
+
+func TestExpandIncludesInCode(t *testing.T) {
+	content := "```\n{{< include \"part.md\" >}}\n```\n"
+	var read []string
+	out := string(ExpandIncludes([]byte(content), "a.md", testReader(map[string]string{"part.md": "part\n"}, &read)))
+	if out != content || len(read) != 0 {
+		t.Errorf("directive in a code block expanded: %s", out)
+	}
+}
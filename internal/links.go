@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	inlineLinkRegexp = regexp.MustCompile(`(\]\(\s*<?)([^)\s>]+)`)
+	refLinkRegexp    = regexp.MustCompile(`^( {0,3}\[[^\]]+\]:[ \t]*<?)([^\s>]+)`)
+)
+
+// RewriteLinks changes the destinations of the inline links, images and
+// link definitions of a markdown document in place, code blocks and code
+// spans are left alone. rewrite returns the new destination or false to
+// keep it.
+func RewriteLinks(content []byte, rewrite func(dest string) (string, bool)) []byte {
+	replace := func(re *regexp.Regexp, line string) string {
+		spans := codeSpans(line)
+		var out strings.Builder
+		last := 0
+		for _, m := range re.FindAllStringSubmatchIndex(line, -1) {
+			if inSpans(spans, m[0]) {
+				continue
+			}
+			if dest, ok := rewrite(line[m[4]:m[5]]); ok {
+				out.WriteString(line[last:m[4]])
+				out.WriteString(dest)
+				last = m[5]
+			}
+		}
+		out.WriteString(line[last:])
+		return out.String()
+	}
+
+	lines := strings.SplitAfter(string(content), "\n")
+	fence := ""
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+		line = replace(refLinkRegexp, line)
+		lines[i] = replace(inlineLinkRegexp, line)
+	}
+	return []byte(strings.Join(lines, ""))
+}
+
+// codeSpans finds the `code` spans of a line, a run of backticks is
+// closed by a run of the same length
+func codeSpans(line string) [][2]int {
+	var spans [][2]int
+	start, open := 0, 0
+	for i := 0; i < len(line); {
+		if line[i] != '`' {
+			i++
+			continue
+		}
+		j := i
+		for j < len(line) && line[j] == '`' {
+			j++
+		}
+		switch {
+		case open == 0:
+			start, open = i, j-i
+		case j-i == open:
+			spans = append(spans, [2]int{start, j})
+			open = 0
+		}
+		i = j
+	}
+	return spans
+}
+
+func inSpans(spans [][2]int, pos int) bool {
+	for _, span := range spans {
+		if pos >= span[0] && pos < span[1] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRewriteLinks(t *testing.T) {
+	rewrite := func(dest string) (string, bool) {
+		if !strings.HasPrefix(dest, "b.md") {
+			return "", false
+		}
+		return "c.md" + strings.TrimPrefix(dest, "b.md"), true
+	}
+	tests := []struct {
+		content, want string
+	}{
+		{"[a](b.md)\n", "[a](c.md)\n"},
+		{"![i](b.md \"title\") and [x](b.md#part)\n", "![i](c.md \"title\") and [x](c.md#part)\n"},
+		{"[a](<b.md>) [o](other.md)\n", "[a](<c.md>) [o](other.md)\n"},
+		{"[ref]: b.md\n   [ref2]: <b.md?x=1>\n", "[ref]: c.md\n   [ref2]: <c.md?x=1>\n"},
+		{"`[a](b.md)` and [a](b.md)\n", "`[a](b.md)` and [a](c.md)\n"},
+		{"``code `[a](b.md)` `` [a](b.md)\n", "``code `[a](b.md)` `` [a](c.md)\n"},
+		{"it`s [a](b.md)\n", "it`s [a](c.md)\n"},
+		{"```\n[a](b.md)\n```\n[a](b.md)\n", "```\n[a](b.md)\n```\n[a](c.md)\n"},
+		{"~~~md\n[ref]: b.md\n~~~\n", "~~~md\n[ref]: b.md\n~~~\n"},
+		{"  ```\n  [a](b.md)\n  ```\n", "  ```\n  [a](b.md)\n  ```\n"},
+	}
+	for _, test := range tests {
+		if got := string(RewriteLinks([]byte(test.content), rewrite)); got != test.want {
+			t.Errorf("RewriteLinks(%q) = %q, want %q", test.content, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,488 @@
+package internal
+
+import (
+	"bytes"
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// latex to MathML conversion for the subset of TeX used in our docs,
+// browsers render MathML natively so no script or font is needed
+
+var mathIdentifiers = map[string]string{
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ϵ",
+	"varepsilon": "ε", "zeta": "ζ", "eta": "η", "theta": "θ", "vartheta": "ϑ",
+	"iota": "ι", "kappa": "κ", "lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ",
+	"pi": "π", "varpi": "ϖ", "rho": "ρ", "varrho": "ϱ", "sigma": "σ",
+	"varsigma": "ς", "tau": "τ", "upsilon": "υ", "phi": "ϕ", "varphi": "φ",
+	"chi": "χ", "psi": "ψ", "omega": "ω",
+	"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ",
+	"Pi": "Π", "Sigma": "Σ", "Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ", "Omega": "Ω",
+	"infty": "∞", "partial": "∂", "nabla": "∇", "ell": "ℓ", "hbar": "ℏ",
+	"emptyset": "∅", "varnothing": "∅", "aleph": "ℵ", "Re": "ℜ", "Im": "ℑ",
+}
+
+var mathOperators = map[string]string{
+	"pm": "±", "mp": "∓", "times": "×", "div": "÷", "cdot": "⋅", "ast": "∗",
+	"star": "⋆", "circ": "∘", "bullet": "∙", "oplus": "⊕", "otimes": "⊗",
+	"cap": "∩", "cup": "∪", "wedge": "∧", "land": "∧", "vee": "∨", "lor": "∨",
+	"setminus": "∖", "neg": "¬", "lnot": "¬",
+	"leq": "≤", "le": "≤", "geq": "≥", "ge": "≥", "neq": "≠", "ne": "≠",
+	"approx": "≈", "equiv": "≡", "sim": "∼", "simeq": "≃", "cong": "≅",
+	"propto": "∝", "ll": "≪", "gg": "≫", "prec": "≺", "succ": "≻",
+	"in": "∈", "notin": "∉", "ni": "∋", "subset": "⊂", "supset": "⊃",
+	"subseteq": "⊆", "supseteq": "⊇", "mid": "∣", "parallel": "∥", "perp": "⊥",
+	"to": "→", "rightarrow": "→", "leftarrow": "←", "gets": "←",
+	"leftrightarrow": "↔", "Rightarrow": "⇒", "Leftarrow": "⇐",
+	"Leftrightarrow": "⇔", "implies": "⟹", "iff": "⟺", "mapsto": "↦",
+	"uparrow": "↑", "downarrow": "↓",
+	"forall": "∀", "exists": "∃", "nexists": "∄",
+	"ldots": "…", "dots": "…", "cdots": "⋯", "vdots": "⋮", "ddots": "⋱",
+	"langle": "⟨", "rangle": "⟩", "lfloor": "⌊", "rfloor": "⌋",
+	"lceil": "⌈", "rceil": "⌉", "vert": "|", "Vert": "‖", "|": "‖",
+	"{": "{", "}": "}", "lbrace": "{", "rbrace": "}", "prime": "′",
+	"angle": "∠", "triangle": "△", "degree": "°",
+	"$": "$", "%": "%", "&": "&", "#": "#", "_": "_",
+}
+
+// large operators take their limits under and over in display mode
+var mathLargeOperators = map[string]string{
+	"sum": "∑", "prod": "∏", "coprod": "∐", "int": "∫", "iint": "∬",
+	"iiint": "∭", "oint": "∮", "bigcup": "⋃", "bigcap": "⋂",
+	"bigoplus": "⨁", "bigotimes": "⨂",
+}
+
+var mathFunctions = map[string]bool{
+	"sin": true, "cos": true, "tan": true, "cot": true, "sec": true, "csc": true,
+	"arcsin": true, "arccos": true, "arctan": true, "sinh": true, "cosh": true,
+	"tanh": true, "log": true, "ln": true, "lg": true, "exp": true, "det": true,
+	"dim": true, "ker": true, "deg": true, "gcd": true, "arg": true, "Pr": true,
+	"lim": true, "max": true, "min": true, "sup": true, "inf": true,
+	"liminf": true, "limsup": true,
+}
+
+var mathAccents = map[string]string{
+	"hat": "^", "widehat": "^", "bar": "¯", "overline": "¯", "vec": "→",
+	"overrightarrow": "→", "dot": "˙", "ddot": "¨", "tilde": "~",
+	"widetilde": "~", "check": "ˇ", "breve": "˘",
+}
+
+var mathVariants = map[string]string{
+	"mathrm": "normal", "mathbf": "bold", "mathit": "italic",
+	"mathbb": "double-struck", "mathcal": "script", "mathfrak": "fraktur",
+	"mathsf": "sans-serif", "mathtt": "monospace", "boldsymbol": "bold-italic",
+	"operatorname": "normal",
+}
+
+var mathSpaces = map[string]string{
+	",": "0.1667em", ":": "0.2222em", ">": "0.2222em", ";": "0.2778em",
+	" ": "0.25em", "quad": "1em", "qquad": "2em", "!": "-0.1667em",
+}
+
+var mathEnvironments = map[string][2]string{
+	"matrix": {"", ""}, "pmatrix": {"(", ")"}, "bmatrix": {"[", "]"},
+	"Bmatrix": {"{", "}"}, "vmatrix": {"|", "|"}, "Vmatrix": {"‖", "‖"},
+	"cases": {"{", ""}, "aligned": {"", ""}, "align": {"", ""},
+	"align*": {"", ""}, "array": {"", ""}, "gathered": {"", ""},
+}
+
+type mathParser struct {
+	src     string
+	pos     int
+	display bool
+}
+
+// Latex2MathML converts a TeX formula to a MathML element, keeping the
+// source as an annotation so it can still be copied.
+func Latex2MathML(src string, display bool) string {
+	p := &mathParser{src: src, display: display}
+	body := p.parseRow("")
+
+	var buf bytes.Buffer
+	buf.WriteString(`<math xmlns="http://www.w3.org/1998/Math/MathML"`)
+	if display {
+		buf.WriteString(` display="block"`)
+	}
+	buf.WriteString(`><semantics>`)
+	buf.WriteString(mrow(body))
+	buf.WriteString(`<annotation encoding="application/x-tex">`)
+	buf.WriteString(html.EscapeString(strings.TrimSpace(src)))
+	buf.WriteString(`</annotation></semantics></math>`)
+	return buf.String()
+}
+
+func mrow(items []string) string {
+	if len(items) == 1 {
+		return items[0]
+	}
+	return "<mrow>" + strings.Join(items, "") + "</mrow>"
+}
+
+func mo(s string) string {
+	return "<mo>" + html.EscapeString(s) + "</mo>"
+}
+
+func (p *mathParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *mathParser) skipSpace() {
+	for !p.eof() && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+// readCommand reads a command name after the backslash
+func (p *mathParser) readCommand() string {
+	p.pos++
+	if p.eof() {
+		return ""
+	}
+	start := p.pos
+	for !p.eof() && unicode.IsLetter(rune(p.src[p.pos])) {
+		p.pos++
+	}
+	if start == p.pos {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// readGroupText reads a raw {...} argument without parsing it
+func (p *mathParser) readGroupText() string {
+	p.skipSpace()
+	if p.eof() || p.src[p.pos] != '{' {
+		return ""
+	}
+	depth := 0
+	start := p.pos + 1
+	for ; !p.eof(); p.pos++ {
+		switch p.src[p.pos] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				p.pos++
+				return p.src[start : p.pos-1]
+			}
+		}
+	}
+	return p.src[start:]
+}
+
+// parseRow parses atoms until one of the stop tokens or the end of input
+func (p *mathParser) parseRow(stop string) []string {
+	var items []string
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return items
+		}
+		if stop != "" && p.atStop(stop) {
+			return items
+		}
+		c := p.src[p.pos]
+		switch {
+		case c == '^' || c == '_':
+			p.pos++
+			var base string
+			if len(items) > 0 {
+				base = items[len(items)-1]
+				items = items[:len(items)-1]
+			} else {
+				base = "<mrow></mrow>"
+			}
+			items = append(items, p.parseScripts(base, c))
+		default:
+			items = append(items, p.parseAtom())
+		}
+	}
+}
+
+func (p *mathParser) atStop(stop string) bool {
+	for _, s := range strings.Split(stop, "|") {
+		if strings.HasPrefix(p.src[p.pos:], s) {
+			if strings.HasPrefix(s, `\`) {
+				// do not stop at \rightarrow when looking for \right
+				next := p.pos + len(s)
+				if next < len(p.src) && unicode.IsLetter(rune(p.src[next])) && unicode.IsLetter(rune(s[len(s)-1])) {
+					continue
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// parseScripts attaches sub and superscripts to base
+func (p *mathParser) parseScripts(base string, first byte) string {
+	var sub, sup string
+	if first == '_' {
+		sub = p.parseArgument()
+	} else {
+		sup = p.parseArgument()
+	}
+	p.skipSpace()
+	if !p.eof() {
+		if p.src[p.pos] == '_' && sub == "" {
+			p.pos++
+			sub = p.parseArgument()
+		} else if p.src[p.pos] == '^' && sup == "" {
+			p.pos++
+			sup = p.parseArgument()
+		}
+	}
+
+	under := p.display && strings.Contains(base, `movablelimits="true"`)
+	switch {
+	case sub != "" && sup != "":
+		if under {
+			return "<munderover>" + base + sub + sup + "</munderover>"
+		}
+		return "<msubsup>" + base + sub + sup + "</msubsup>"
+	case sub != "":
+		if under {
+			return "<munder>" + base + sub + "</munder>"
+		}
+		return "<msub>" + base + sub + "</msub>"
+	default:
+		if under {
+			return "<mover>" + base + sup + "</mover>"
+		}
+		return "<msup>" + base + sup + "</msup>"
+	}
+}
+
+// parseArgument parses a single atom or braced group
+func (p *mathParser) parseArgument() string {
+	p.skipSpace()
+	if p.eof() {
+		return "<mrow></mrow>"
+	}
+	if p.src[p.pos] == '{' {
+		p.pos++
+		items := p.parseRow("}")
+		if !p.eof() {
+			p.pos++
+		}
+		return mrow(items)
+	}
+	if unicode.IsDigit(rune(p.src[p.pos])) {
+		// a single digit only, x^23 is x squared then 3
+		p.pos++
+		return "<mn>" + p.src[p.pos-1:p.pos] + "</mn>"
+	}
+	return p.parseAtom()
+}
+
+func (p *mathParser) parseAtom() string {
+	c := p.src[p.pos]
+	switch {
+	case c == '{':
+		p.pos++
+		items := p.parseRow("}")
+		if !p.eof() {
+			p.pos++
+		}
+		return mrow(items)
+	case c == '}':
+		p.pos++
+		return ""
+	case c == '\\':
+		return p.parseCommand()
+	case c >= '0' && c <= '9' || c == '.':
+		start := p.pos
+		for !p.eof() && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		return "<mn>" + p.src[start:p.pos] + "</mn>"
+	case c < unicode.MaxASCII && unicode.IsLetter(rune(c)):
+		p.pos++
+		return "<mi>" + string(c) + "</mi>"
+	case c == '\'':
+		p.pos++
+		return mo("′")
+	case c == '~':
+		p.pos++
+		return `<mspace width="0.25em"></mspace>`
+	case c == '&':
+		p.pos++
+		return ""
+	default:
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.pos += size
+		if unicode.IsLetter(r) {
+			return "<mi>" + string(r) + "</mi>"
+		}
+		if r == '-' {
+			return mo("−")
+		}
+		return mo(string(r))
+	}
+}
+
+func (p *mathParser) parseCommand() string {
+	name := p.readCommand()
+	if v, ok := mathIdentifiers[name]; ok {
+		return "<mi>" + v + "</mi>"
+	}
+	if v, ok := mathOperators[name]; ok {
+		return mo(v)
+	}
+	if v, ok := mathLargeOperators[name]; ok {
+		return `<mo movablelimits="true">` + v + "</mo>"
+	}
+	if mathFunctions[name] {
+		attr := ""
+		if name == "lim" || name == "max" || name == "min" || name == "sup" || name == "inf" ||
+			name == "liminf" || name == "limsup" || name == "det" || name == "gcd" || name == "Pr" {
+			attr = ` movablelimits="true"`
+		}
+		if attr != "" {
+			return `<mo` + attr + `>` + name + `</mo>`
+		}
+		return `<mi mathvariant="normal">` + name + `</mi>`
+	}
+	if v, ok := mathSpaces[name]; ok {
+		return `<mspace width="` + v + `"></mspace>`
+	}
+	if v, ok := mathAccents[name]; ok {
+		arg := p.parseArgument()
+		if name == "overline" {
+			return `<mover accent="true">` + arg + `<mo stretchy="true">` + v + `</mo></mover>`
+		}
+		return `<mover accent="true">` + arg + mo(v) + `</mover>`
+	}
+	if v, ok := mathVariants[name]; ok {
+		if name == "operatorname" {
+			return `<mi mathvariant="normal">` + html.EscapeString(p.readGroupText()) + `</mi>`
+		}
+		arg := p.parseArgument()
+		return strings.ReplaceAll(arg, "<mi>", `<mi mathvariant="`+v+`">`)
+	}
+
+	switch name {
+	case "frac", "dfrac", "tfrac", "cfrac":
+		num := p.parseArgument()
+		den := p.parseArgument()
+		return "<mfrac>" + num + den + "</mfrac>"
+	case "binom":
+		top := p.parseArgument()
+		bottom := p.parseArgument()
+		return "<mrow>" + mo("(") + `<mfrac linethickness="0">` + top + bottom + "</mfrac>" + mo(")") + "</mrow>"
+	case "sqrt":
+		p.skipSpace()
+		if !p.eof() && p.src[p.pos] == '[' {
+			p.pos++
+			index := mrow(p.parseRow("]"))
+			if !p.eof() {
+				p.pos++
+			}
+			return "<mroot>" + p.parseArgument() + index + "</mroot>"
+		}
+		return "<msqrt>" + p.parseArgument() + "</msqrt>"
+	case "underline":
+		return `<munder accentunder="true">` + p.parseArgument() + `<mo stretchy="true">_</mo></munder>`
+	case "overset", "stackrel":
+		over := p.parseArgument()
+		return "<mover>" + p.parseArgument() + over + "</mover>"
+	case "underset":
+		under := p.parseArgument()
+		return "<munder>" + p.parseArgument() + under + "</munder>"
+	case "text", "textrm", "textbf", "textit", "mbox":
+		return "<mtext>" + html.EscapeString(p.readGroupText()) + "</mtext>"
+	case "left":
+		open := p.readDelimiter()
+		items := p.parseRow(`\right`)
+		close := ""
+		if !p.eof() {
+			p.readCommand()
+			close = p.readDelimiter()
+		}
+		return "<mrow>" + stretchy(open) + strings.Join(items, "") + stretchy(close) + "</mrow>"
+	case "right":
+		return stretchy(p.readDelimiter())
+	case "big", "Big", "bigg", "Bigg", "bigl", "bigr", "Bigl", "Bigr":
+		return mo(p.readDelimiter())
+	case "begin":
+		return p.parseEnvironment(p.readGroupText())
+	case "\\":
+		return ""
+	case "displaystyle", "textstyle", "limits", "nolimits":
+		return ""
+	}
+	return "<merror><mtext>\\" + html.EscapeString(name) + "</mtext></merror>"
+}
+
+func stretchy(delim string) string {
+	if delim == "" {
+		return ""
+	}
+	return `<mo stretchy="true">` + html.EscapeString(delim) + "</mo>"
+}
+
+// readDelimiter reads the delimiter following \left, \right or \big
+func (p *mathParser) readDelimiter() string {
+	p.skipSpace()
+	if p.eof() {
+		return ""
+	}
+	if p.src[p.pos] == '\\' {
+		name := p.readCommand()
+		if v, ok := mathOperators[name]; ok {
+			return v
+		}
+		return ""
+	}
+	c := p.src[p.pos]
+	p.pos++
+	if c == '.' {
+		return ""
+	}
+	return string(c)
+}
+
+func (p *mathParser) parseEnvironment(env string) string {
+	fences, ok := mathEnvironments[env]
+	if !ok {
+		return "<merror><mtext>" + html.EscapeString(env) + "</mtext></merror>"
+	}
+	if env == "array" {
+		// column spec is not needed for rendering
+		p.readGroupText()
+	}
+
+	end := `\end{` + env + `}`
+	var rows []string
+	for {
+		var cells []string
+		for {
+			items := p.parseRow(`&|\\|` + end)
+			cells = append(cells, "<mtd>"+strings.Join(items, "")+"</mtd>")
+			if p.eof() || !strings.HasPrefix(p.src[p.pos:], "&") {
+				break
+			}
+			p.pos++
+		}
+		rows = append(rows, "<mtr>"+strings.Join(cells, "")+"</mtr>")
+		if p.eof() || strings.HasPrefix(p.src[p.pos:], end) {
+			p.pos += len(end)
+			break
+		}
+		p.pos += 2
+	}
+
+	attrs := ""
+	if env == "cases" || strings.HasPrefix(env, "align") || env == "aligned" {
+		attrs = ` columnalign="left"`
+	}
+	table := "<mtable" + attrs + ">" + strings.Join(rows, "") + "</mtable>"
+	if fences[0] == "" && fences[1] == "" {
+		return table
+	}
+	return "<mrow>" + stretchy(fences[0]) + table + stretchy(fences[1]) + "</mrow>"
+}
@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLatex2MathML(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{`x`, `<mi>x</mi>`},
+		{`12.5`, `<mn>12.5</mn>`},
+		{`a-b`, `<mrow><mi>a</mi><mo>−</mo><mi>b</mi></mrow>`},
+		{`x^2_i`, `<msubsup><mi>x</mi><mi>i</mi><mn>2</mn></msubsup>`},
+		{`\frac{a}{b}`, `<mfrac><mi>a</mi><mi>b</mi></mfrac>`},
+		{`\sqrt{x}`, `<msqrt><mi>x</mi></msqrt>`},
+		{`\alpha \leq \infty`, `<mi>α</mi><mo>≤</mo><mi>∞</mi>`},
+		{`\sum_{i=1}^n`, `<mo movablelimits="true">∑</mo><mrow><mi>i</mi><mo>=</mo><mn>1</mn></mrow><mi>n</mi>`},
+		{`\$ \% \{`, `<mo>$</mo><mo>%</mo><mo>{</mo>`},
+		{`é ≤ 日`, `<mi>é</mi><mo>≤</mo><mi>日</mi>`},
+		{`a < b`, `<mo>&lt;</mo>`},
+	}
+	for _, test := range tests {
+		out := Latex2MathML(test.src, false)
+		if !strings.Contains(out, test.want) {
+			t.Errorf("Latex2MathML(%q) = %s, want %s", test.src, out, test.want)
+		}
+		if !strings.Contains(out, `<annotation encoding="application/x-tex">`) {
+			t.Errorf("Latex2MathML(%q) lost its source: %s", test.src, out)
+		}
+	}
+	if out := Latex2MathML(`x`, true); !strings.Contains(out, `display="block"`) {
+		t.Errorf("display math: %s", out)
+	}
+}
+
+func TestLatex2MathMLLongInput(t *testing.T) {
+	src := strings.Repeat(`é+`, 50000) + "x"
+	out := Latex2MathML(src, false)
+	if strings.Count(out, "<mi>é</mi>") != 50000 {
+		t.Error("long formula not converted")
+	}
+}
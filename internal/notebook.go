@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// jupyter notebook format 4, only the fields we render
+
+type notebook struct {
+	Cells    []notebookCell `json:"cells"`
+	Metadata struct {
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+		Kernelspec struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+	} `json:"metadata"`
+}
+
+type notebookCell struct {
+	CellType       string           `json:"cell_type"`
+	Source         notebookText     `json:"source"`
+	ExecutionCount *int             `json:"execution_count"`
+	Outputs        []notebookOutput `json:"outputs"`
+}
+
+type notebookOutput struct {
+	OutputType string                  `json:"output_type"`
+	Name       string                  `json:"name"`
+	Text       notebookText            `json:"text"`
+	Data       map[string]notebookText `json:"data"`
+	Ename      string                  `json:"ename"`
+	Evalue     string                  `json:"evalue"`
+	Traceback  []string                `json:"traceback"`
+}
+
+// notebookText is stored either as a string or a list of lines
+type notebookText string
+
+func (t *notebookText) UnmarshalJSON(data []byte) error {
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err == nil {
+		*t = notebookText(strings.Join(lines, ""))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		// json outputs like application/json are not rendered
+		return nil
+	}
+	*t = notebookText(s)
+	return nil
+}
+
+var ansiRegexp = regexp.MustCompile(`\x1b\[[0-9;]*[a-zA-Z]`)
+
+type notebookRenderer struct{}
+
+func (notebookRenderer) Render(content []byte, opts RenderOptions) string {
+	var nb notebook
+	if err := json.Unmarshal(content, &nb); err != nil {
+		return `<p class="render-error">Invalid notebook: ` + html.EscapeString(err.Error()) + "</p>\n"
+	}
+	lang := nb.Metadata.LanguageInfo.Name
+	if lang == "" {
+		lang = nb.Metadata.Kernelspec.Language
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("<div class=\"notebook\">\n")
+	for _, cell := range nb.Cells {
+		switch cell.CellType {
+		case "markdown":
+			buf.WriteString("<div class=\"nb-cell nb-markdown\">\n")
+			buf.WriteString(Render2Html([]byte(cell.Source), opts))
+			buf.WriteString("</div>\n")
+		case "code":
+			prompt := " "
+			if cell.ExecutionCount != nil {
+				prompt = fmt.Sprint(*cell.ExecutionCount)
+			}
+			buf.WriteString("<div class=\"nb-cell nb-code\">\n")
+			fmt.Fprintf(&buf, "<div class=\"nb-prompt\">In [%s]:</div>\n", prompt)
+			htmlHighlight(&buf, newFormatter(opts.LineNumbers, nil), string(cell.Source), lang, "python")
+			for _, output := range cell.Outputs {
+				renderNotebookOutput(&buf, output, opts)
+			}
+			buf.WriteString("</div>\n")
+		default:
+			buf.WriteString("<div class=\"nb-cell nb-raw\">")
+			buf.WriteString(`<pre>` + html.EscapeString(string(cell.Source)) + "</pre>")
+			buf.WriteString("</div>\n")
+		}
+	}
+	buf.WriteString("</div>\n")
+	return buf.String()
+}
+
+func renderNotebookOutput(buf *bytes.Buffer, output notebookOutput, opts RenderOptions) {
+	buf.WriteString("<div class=\"nb-output\">")
+	defer buf.WriteString("</div>\n")
+
+	switch output.OutputType {
+	case "stream":
+		class := "nb-stream"
+		if output.Name == "stderr" {
+			class = "nb-stream nb-stderr"
+		}
+		fmt.Fprintf(buf, "<pre class=\"%s\">%s</pre>", class, html.EscapeString(ansiRegexp.ReplaceAllString(string(output.Text), "")))
+	case "error":
+		trace := ansiRegexp.ReplaceAllString(strings.Join(output.Traceback, "\n"), "")
+		if trace == "" {
+			trace = output.Ename + ": " + output.Evalue
+		}
+		fmt.Fprintf(buf, "<pre class=\"nb-error\">%s</pre>", html.EscapeString(trace))
+	default:
+		// richest representation first
+		data := output.Data
+		for _, mime := range []string{"image/png", "image/jpeg", "image/gif"} {
+			if img, ok := data[mime]; ok {
+				fmt.Fprintf(buf, "<img src=\"data:%s;base64,%s\" alt=\"output\">", mime, strings.TrimSpace(string(img)))
+				return
+			}
+		}
+		if svg, ok := data["image/svg+xml"]; ok {
+			fmt.Fprintf(buf, "<div class=\"nb-svg\">%s</div>", svg)
+			return
+		}
+		if md, ok := data["text/markdown"]; ok {
+			buf.WriteString(Render2Html([]byte(md), opts))
+			return
+		}
+		if h, ok := data["text/html"]; ok {
+			buf.WriteString(string(h))
+			return
+		}
+		if text, ok := data["text/plain"]; ok {
+			fmt.Fprintf(buf, "<pre>%s</pre>", html.EscapeString(ansiRegexp.ReplaceAllString(string(text), "")))
+		}
+	}
+}
+
+func (notebookRenderer) Title(content []byte) string {
+	var nb notebook
+	if err := json.Unmarshal(content, &nb); err != nil {
+		return ""
+	}
+	for _, cell := range nb.Cells {
+		if cell.CellType != "markdown" {
+			continue
+		}
+		if title := (markdownRenderer{}).Title([]byte(cell.Source)); title != "" {
+			return title
+		}
+	}
+	return ""
+}
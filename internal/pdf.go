@@ -0,0 +1,630 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/gomarkdown/markdown/ast"
+	nethtml "golang.org/x/net/html"
+)
+
+// PDFOptions describes the cover, headers and footers of a pdf
+type PDFOptions struct {
+	Title    string
+	Subtitle string
+	Commit   string
+	Date     time.Time
+	// FontDir holds the DejaVu TrueType fonts for unicode text, the core
+	// fonts only cover latin-1 without them
+	FontDir string
+}
+
+// PDFSection is a document of a pdf, every section starts a new page
+type PDFSection struct {
+	File    string
+	Title   string
+	Content []byte
+}
+
+type tocEntry struct {
+	title string
+	level int
+	link  int
+	page  int
+}
+
+const (
+	pdfLineHeight = 6.0
+	pdfTextSize   = 11.0
+	pdfCodeSize   = 9.0
+	pdfTocLine    = 7.0
+)
+
+var pdfHeadingSizes = map[int]float64{1: 20, 2: 16, 3: 13.5, 4: 12, 5: 11, 6: 11}
+
+type pdfWriter struct {
+	pdf  *fpdf.Fpdf
+	opts PDFOptions
+	read ReadFunc
+	file string
+	sans string
+	mono string
+	tr   func(string) string
+
+	style string
+	toc   []*tocEntry
+	// headings of the current section that are listed in the toc
+	entries map[*ast.Heading]*tocEntry
+}
+
+// HTMLText is the text of rendered html with whitespace collapsed, like
+// the textContent browsers compare comment quotes with
+func HTMLText(content string) string {
+	var text strings.Builder
+	skip := ""
+	tokens := nethtml.NewTokenizer(strings.NewReader(content))
+	for {
+		switch tokens.Next() {
+		case nethtml.ErrorToken:
+			return CollapseSpace(text.String())
+		case nethtml.StartTagToken:
+			if name, _ := tokens.TagName(); skip == "" && (string(name) == "script" || string(name) == "style") {
+				skip = string(name)
+			}
+		case nethtml.EndTagToken:
+			if name, _ := tokens.TagName(); string(name) == skip {
+				skip = ""
+			}
+		case nethtml.TextToken:
+			if skip == "" {
+				text.Write(tokens.Text())
+			}
+		}
+	}
+}
+
+// RenderPDF writes sections as one pdf with a cover page and a table of
+// contents, read loads the images the documents refer to
+func RenderPDF(w io.Writer, sections []PDFSection, read ReadFunc, opts PDFOptions) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(20, 22, 20)
+	pdf.SetAutoPageBreak(true, 20)
+	pdf.AliasNbPages("{nb}")
+	pdf.SetCatalogSort(true)
+	pdf.SetCreationDate(opts.Date)
+	pdf.SetModificationDate(opts.Date)
+	pdf.SetTitle(opts.Title, true)
+	pdf.SetCreator("md-doc", true)
+
+	p := &pdfWriter{pdf: pdf, opts: opts, read: read}
+	p.setupFonts()
+	pdf.SetHeaderFuncMode(p.header, true)
+	pdf.SetFooterFunc(p.footer)
+
+	// the toc is known before rendering, its pages are filled in last
+	docs := make([]ast.Node, len(sections))
+	sectionEntries := make([]map[*ast.Heading]*tocEntry, len(sections))
+	for i, section := range sections {
+		p.toc = append(p.toc, &tocEntry{title: section.Title, level: 0})
+		sectionEntries[i] = map[*ast.Heading]*tocEntry{}
+		if !IsMarkdown(section.File) {
+			continue
+		}
+		docs[i] = parseMarkdown(normalizeFences(section.Content))
+		convertAlerts(docs[i])
+		parseWikiLinks(docs[i])
+		ast.WalkFunc(docs[i], func(node ast.Node, entering bool) ast.WalkStatus {
+			if h, ok := node.(*ast.Heading); ok && entering && h.Level == 2 {
+				entry := &tocEntry{title: nodeText(h), level: 1}
+				p.toc = append(p.toc, entry)
+				sectionEntries[i][h] = entry
+			}
+			return ast.GoToNext
+		})
+	}
+
+	p.cover()
+	_, pageHeight := pdf.GetPageSize()
+	_, top, _, bottom := pdf.GetMargins()
+	perPage := int((pageHeight - top - bottom - 20) / pdfTocLine)
+	tocStart := pdf.PageNo() + 1
+	for i := 0; i < (len(p.toc)+perPage-1)/perPage; i++ {
+		pdf.AddPage()
+	}
+
+	next := 0
+	for i, section := range sections {
+		pdf.AddPage()
+		p.file = section.File
+		p.entries = sectionEntries[i]
+		entry := p.toc[next]
+		next += 1 + len(p.entries)
+		p.anchor(entry)
+
+		if docs[i] == nil {
+			p.heading(section.Title, 1)
+			p.textBlock(HTMLText(RenderHTML(section.File, section.Content)))
+			continue
+		}
+		if first := ast.GetFirstChild(docs[i]); first == nil || !isTitle(first) {
+			p.heading(section.Title, 1)
+		}
+		p.blocks(docs[i])
+	}
+	last := pdf.PageNo()
+
+	p.writeToc(tocStart, perPage)
+	pdf.SetPage(last)
+	return pdf.Output(w)
+}
+
+// RenderHTML renders a document by its renderer, markdown by default
+func RenderHTML(file string, content []byte) string {
+	r, ok := GetRenderer(file)
+	if !ok {
+		r = markdownRenderer{}
+	}
+	return r.Render(content, RenderOptions{})
+}
+
+func isTitle(node ast.Node) bool {
+	h, ok := node.(*ast.Heading)
+	return ok && h.Level == 1
+}
+
+func (p *pdfWriter) setupFonts() {
+	fonts := []struct{ family, style, file string }{
+		{"sans", "", "DejaVuSans.ttf"},
+		{"sans", "B", "DejaVuSans-Bold.ttf"},
+		{"sans", "I", "DejaVuSans-Oblique.ttf"},
+		{"sans", "BI", "DejaVuSans-BoldOblique.ttf"},
+		{"mono", "", "DejaVuSansMono.ttf"},
+		{"mono", "B", "DejaVuSansMono-Bold.ttf"},
+	}
+	if p.opts.FontDir != "" {
+		if _, err := os.Stat(filepath.Join(p.opts.FontDir, fonts[0].file)); err == nil {
+			p.pdf.SetFontLocation(p.opts.FontDir)
+			for _, font := range fonts {
+				file := font.file
+				if _, err := os.Stat(filepath.Join(p.opts.FontDir, file)); err != nil {
+					// styles without a font of their own use the regular one
+					file = fonts[0].file
+					if font.family == "mono" {
+						file = fonts[4].file
+					}
+				}
+				p.pdf.AddUTF8Font(font.family, font.style, file)
+			}
+			if p.pdf.Ok() {
+				p.sans, p.mono = "sans", "mono"
+				p.tr = func(s string) string { return s }
+				p.pdf.SetFont(p.sans, "", pdfTextSize)
+				return
+			}
+			p.pdf.ClearError()
+		}
+	}
+
+	p.sans, p.mono = "Helvetica", "Courier"
+	p.tr = p.pdf.UnicodeTranslatorFromDescriptor("")
+	p.pdf.SetFont(p.sans, "", pdfTextSize)
+}
+
+func (p *pdfWriter) shortCommit() string {
+	if len(p.opts.Commit) > 10 {
+		return p.opts.Commit[:10]
+	}
+	return p.opts.Commit
+}
+
+func (p *pdfWriter) header() {
+	if p.pdf.PageNo() == 1 {
+		return
+	}
+	left, _, _, _ := p.pdf.GetMargins()
+	p.pdf.SetFont(p.sans, "", 8)
+	p.pdf.SetTextColor(110, 119, 129)
+	p.pdf.SetXY(left, 10)
+	p.pdf.CellFormat(0, 5, p.tr(p.opts.Title), "", 0, "L", false, 0, "")
+	p.pdf.SetXY(left, 10)
+	p.pdf.CellFormat(0, 5, p.tr(p.shortCommit()), "", 0, "R", false, 0, "")
+}
+
+func (p *pdfWriter) footer() {
+	if p.pdf.PageNo() == 1 {
+		return
+	}
+	left, _, _, _ := p.pdf.GetMargins()
+	p.pdf.SetFont(p.sans, "", 8)
+	p.pdf.SetTextColor(110, 119, 129)
+	p.pdf.SetXY(left, -14)
+	p.pdf.CellFormat(0, 5, p.tr(fmt.Sprintf("commit %s, %s", p.shortCommit(), p.opts.Date.UTC().Format("2006-01-02"))),
+		"", 0, "L", false, 0, "")
+	p.pdf.SetXY(left, -14)
+	p.pdf.CellFormat(0, 5, fmt.Sprintf("Page %d of {nb}", p.pdf.PageNo()), "", 0, "R", false, 0, "")
+}
+
+func (p *pdfWriter) cover() {
+	p.pdf.AddPage()
+	p.pdf.SetY(90)
+	p.pdf.SetFont(p.sans, "B", 28)
+	p.pdf.MultiCell(0, 12, p.tr(p.opts.Title), "", "C", false)
+	if p.opts.Subtitle != "" {
+		p.pdf.Ln(4)
+		p.pdf.SetFont(p.sans, "", 14)
+		p.pdf.SetTextColor(87, 96, 106)
+		p.pdf.MultiCell(0, 8, p.tr(p.opts.Subtitle), "", "C", false)
+	}
+	p.pdf.SetY(230)
+	p.pdf.SetFont(p.sans, "", 10)
+	p.pdf.SetTextColor(87, 96, 106)
+	p.pdf.MultiCell(0, 6, p.tr("Commit "+p.opts.Commit), "", "C", false)
+	p.pdf.MultiCell(0, 6, p.opts.Date.UTC().Format("2006-01-02 15:04 MST"), "", "C", false)
+	p.resetText()
+}
+
+func (p *pdfWriter) writeToc(start, perPage int) {
+	left, top, right, _ := p.pdf.GetMargins()
+	pageWidth, _ := p.pdf.GetPageSize()
+	for i, entry := range p.toc {
+		row := i % perPage
+		p.pdf.SetPage(start + i/perPage)
+		if row == 0 {
+			p.pdf.SetXY(left, top)
+			p.pdf.SetFont(p.sans, "B", 18)
+			p.pdf.SetTextColor(31, 35, 40)
+			p.pdf.CellFormat(0, 10, "Contents", "", 0, "L", false, 0, "")
+		}
+
+		style := ""
+		if entry.level == 0 {
+			style = "B"
+		}
+		indent := float64(entry.level) * 6
+		width := pageWidth - left - right - indent
+		p.pdf.SetFont(p.sans, style, pdfTextSize)
+		p.pdf.SetXY(left+indent, top+18+float64(row)*pdfTocLine)
+		p.pdf.CellFormat(width-15, pdfTocLine, p.tr(p.fit(entry.title, width-17)), "", 0, "L", false, entry.link, "")
+		p.pdf.CellFormat(15, pdfTocLine, fmt.Sprint(entry.page), "", 0, "R", false, entry.link, "")
+	}
+}
+
+// fit shortens text to the width
+func (p *pdfWriter) fit(text string, width float64) string {
+	if p.pdf.GetStringWidth(p.tr(text)) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && p.pdf.GetStringWidth(p.tr(string(runes)+"...")) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+// anchor points a toc entry at the current position
+func (p *pdfWriter) anchor(entry *tocEntry) {
+	entry.link = p.pdf.AddLink()
+	entry.page = p.pdf.PageNo()
+	p.pdf.SetLink(entry.link, -1, entry.page)
+	p.pdf.Bookmark(p.tr(entry.title), entry.level, -1)
+}
+
+func (p *pdfWriter) resetText() {
+	p.style = ""
+	p.pdf.SetFont(p.sans, "", pdfTextSize)
+	p.pdf.SetTextColor(31, 35, 40)
+}
+
+func (p *pdfWriter) heading(text string, level int) {
+	p.pdf.Ln(3)
+	p.pdf.SetFont(p.sans, "B", pdfHeadingSizes[level])
+	p.pdf.MultiCell(0, pdfHeadingSizes[level]*0.5, p.tr(text), "", "L", false)
+	p.pdf.Ln(2)
+	p.resetText()
+}
+
+func (p *pdfWriter) textBlock(text string) {
+	if text == "" {
+		return
+	}
+	p.pdf.MultiCell(0, pdfLineHeight, p.tr(text), "", "L", false)
+	p.pdf.Ln(2)
+}
+
+func nodeText(node ast.Node) string {
+	var text strings.Builder
+	ast.WalkFunc(node, func(n ast.Node, entering bool) ast.WalkStatus {
+		switch n := n.(type) {
+		case *WikiLink:
+			text.WriteString(n.Label)
+		default:
+			if leaf := n.AsLeaf(); leaf != nil && entering {
+				text.Write(leaf.Literal)
+			}
+		}
+		return ast.GoToNext
+	})
+	return text.String()
+}
+
+func (p *pdfWriter) blocks(node ast.Node) {
+	for _, child := range node.GetChildren() {
+		p.block(child)
+	}
+}
+
+func (p *pdfWriter) block(node ast.Node) {
+	left, _, _, _ := p.pdf.GetMargins()
+
+	switch n := node.(type) {
+	case *ast.Heading:
+		if entry, ok := p.entries[n]; ok {
+			p.pdf.Ln(3)
+			p.anchor(entry)
+		}
+		p.heading(nodeText(n), n.Level)
+	case *ast.Paragraph:
+		p.pdf.SetX(left)
+		p.inlines(n)
+		p.pdf.Ln(pdfLineHeight)
+		p.pdf.Ln(2)
+	case *ast.List:
+		number := n.Start
+		if number == 0 {
+			number = 1
+		}
+		for _, item := range n.Children {
+			marker := "•"
+			if n.ListFlags&ast.ListTypeOrdered != 0 {
+				marker = fmt.Sprintf("%d.", number)
+				number++
+			}
+			p.pdf.SetX(left)
+			p.pdf.CellFormat(7, pdfLineHeight, p.tr(marker), "", 0, "L", false, 0, "")
+			p.pdf.SetLeftMargin(left + 7)
+			p.blocks(item)
+			p.pdf.SetLeftMargin(left)
+		}
+		p.pdf.Ln(1)
+	case *ast.CodeBlock:
+		code := strings.ReplaceAll(strings.TrimRight(string(n.Literal), "\n"), "\t", "    ")
+		p.pdf.SetFont(p.mono, "", pdfCodeSize)
+		p.pdf.SetFillColor(246, 248, 250)
+		p.pdf.MultiCell(0, 4.5, p.tr(code), "", "L", true)
+		p.pdf.Ln(3)
+		p.resetText()
+	case *ast.MathBlock:
+		p.pdf.SetFont(p.mono, "", pdfCodeSize)
+		p.pdf.MultiCell(0, 4.5, p.tr(strings.TrimSpace(string(n.Literal))), "", "C", false)
+		p.pdf.Ln(3)
+		p.resetText()
+	case *ast.BlockQuote:
+		p.indented(left, func() {
+			p.pdf.SetTextColor(87, 96, 106)
+			p.blocks(n)
+		})
+	case *Admonition:
+		p.indented(left, func() {
+			title := n.Title
+			if title == "" {
+				title = admonitionTitles[n.Kind]
+			}
+			p.pdf.SetFont(p.sans, "B", pdfTextSize)
+			p.pdf.MultiCell(0, pdfLineHeight, p.tr(title), "", "L", false)
+			p.resetText()
+			p.blocks(n)
+		})
+	case *ast.Table:
+		p.table(n)
+	case *ast.HorizontalRule:
+		pageWidth, _ := p.pdf.GetPageSize()
+		_, _, right, _ := p.pdf.GetMargins()
+		p.pdf.Ln(2)
+		p.pdf.SetDrawColor(208, 215, 222)
+		p.pdf.Line(left, p.pdf.GetY(), pageWidth-right, p.pdf.GetY())
+		p.pdf.Ln(4)
+	case *ast.HTMLBlock:
+		p.textBlock(HTMLText(string(n.Literal)))
+	default:
+		if node.AsContainer() != nil {
+			p.blocks(node)
+		}
+	}
+}
+
+// indented renders quotes and admonitions with a bar on their left
+func (p *pdfWriter) indented(left float64, fn func()) {
+	page, y := p.pdf.PageNo(), p.pdf.GetY()
+	p.pdf.SetLeftMargin(left + 6)
+	p.pdf.SetX(left + 6)
+	fn()
+	p.pdf.SetLeftMargin(left)
+	p.resetText()
+	if p.pdf.PageNo() == page {
+		p.pdf.SetDrawColor(208, 215, 222)
+		p.pdf.SetLineWidth(0.8)
+		p.pdf.Line(left+2, y, left+2, p.pdf.GetY()-2)
+		p.pdf.SetLineWidth(0.2)
+	}
+}
+
+func (p *pdfWriter) setStyle(style string) {
+	p.style = style
+	p.pdf.SetFont(p.sans, style, pdfTextSize)
+}
+
+func (p *pdfWriter) inlines(node ast.Node) {
+	for _, child := range node.GetChildren() {
+		p.inline(child)
+	}
+}
+
+func (p *pdfWriter) inline(node ast.Node) {
+	switch n := node.(type) {
+	case *ast.Text:
+		p.pdf.Write(pdfLineHeight, p.tr(string(n.Literal)))
+	case *ast.Strong, *ast.Emph:
+		old := p.style
+		add := "B"
+		if _, ok := n.(*ast.Emph); ok {
+			add = "I"
+		}
+		style := old + add
+		if strings.Contains(style, "B") && strings.Contains(style, "I") {
+			style = "BI"
+		}
+		p.setStyle(style)
+		p.inlines(n)
+		p.setStyle(old)
+	case *ast.Code:
+		p.pdf.SetFont(p.mono, "", pdfCodeSize+0.5)
+		p.pdf.Write(pdfLineHeight, p.tr(string(n.Literal)))
+		p.setStyle(p.style)
+	case *ast.Math:
+		p.pdf.SetFont(p.mono, "", pdfCodeSize+0.5)
+		p.pdf.Write(pdfLineHeight, p.tr(string(n.Literal)))
+		p.setStyle(p.style)
+	case *ast.Link:
+		dest := string(n.Destination)
+		p.pdf.SetTextColor(9, 105, 218)
+		if strings.HasPrefix(dest, "http://") || strings.HasPrefix(dest, "https://") {
+			p.pdf.WriteLinkString(pdfLineHeight, p.tr(nodeText(n)), dest)
+		} else {
+			p.inlines(n)
+		}
+		p.pdf.SetTextColor(31, 35, 40)
+	case *WikiLink:
+		p.pdf.Write(pdfLineHeight, p.tr(n.Label))
+	case *ast.Softbreak:
+		p.pdf.Write(pdfLineHeight, " ")
+	case *ast.Hardbreak:
+		p.pdf.Ln(pdfLineHeight)
+	case *ast.Image:
+		p.image(n)
+	case *ast.HTMLSpan:
+	default:
+		p.inlines(node)
+	}
+}
+
+var pdfImageTypes = map[string]string{".png": "PNG", ".jpg": "JPG", ".jpeg": "JPG", ".gif": "GIF"}
+
+// image draws local png, jpeg and gif images, others show their alt text
+func (p *pdfWriter) image(n *ast.Image) {
+	dest := string(n.Destination)
+	imageType, ok := pdfImageTypes[strings.ToLower(path.Ext(dest))]
+	alt := nodeText(n)
+	if !ok || strings.Contains(dest, "://") || p.read == nil {
+		p.pdf.Write(pdfLineHeight, p.tr("["+alt+"]"))
+		return
+	}
+	file, err := ResolvePath(p.file, dest)
+	var data []byte
+	if err == nil {
+		data, err = p.read(file)
+	}
+	if err != nil {
+		p.pdf.Write(pdfLineHeight, p.tr("["+alt+"]"))
+		return
+	}
+
+	info := p.pdf.RegisterImageOptionsReader(file, fpdf.ImageOptions{ImageType: imageType}, bytes.NewReader(data))
+	if !p.pdf.Ok() || info == nil {
+		p.pdf.ClearError()
+		p.pdf.Write(pdfLineHeight, p.tr("["+alt+"]"))
+		return
+	}
+
+	left, _, right, _ := p.pdf.GetMargins()
+	pageWidth, _ := p.pdf.GetPageSize()
+	width, height := info.Width(), info.Height()
+	if max := pageWidth - left - right; width > max {
+		height, width = height*max/width, max
+	}
+	if height > 120 {
+		width, height = width*120/height, 120
+	}
+	p.pdf.Ln(pdfLineHeight)
+	p.pdf.ImageOptions(file, left, -1, width, height, true, fpdf.ImageOptions{ImageType: imageType}, 0, "")
+}
+
+func (p *pdfWriter) table(n *ast.Table) {
+	var rows [][]string
+	var header []bool
+	ast.WalkFunc(n, func(node ast.Node, entering bool) ast.WalkStatus {
+		row, ok := node.(*ast.TableRow)
+		if !ok || !entering {
+			return ast.GoToNext
+		}
+		var cells []string
+		for _, cell := range row.Children {
+			cells = append(cells, nodeText(cell))
+		}
+		_, isHeader := row.Parent.(*ast.TableHeader)
+		rows = append(rows, cells)
+		header = append(header, isHeader)
+		return ast.SkipChildren
+	})
+	if len(rows) == 0 {
+		return
+	}
+
+	columns := 0
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+	left, _, right, bottom := p.pdf.GetMargins()
+	pageWidth, pageHeight := p.pdf.GetPageSize()
+	width := (pageWidth - left - right) / float64(columns)
+	lineHeight := 5.0
+
+	p.pdf.SetFontSize(pdfCodeSize + 0.5)
+	p.pdf.SetDrawColor(208, 215, 222)
+	p.pdf.SetFillColor(246, 248, 250)
+	for i, row := range rows {
+		style := ""
+		if header[i] {
+			style = "B"
+		}
+		p.pdf.SetFont(p.sans, style, pdfCodeSize+0.5)
+
+		lines := 1
+		for _, cell := range row {
+			if n := len(p.pdf.SplitLines([]byte(p.tr(cell)), width-2)); n > lines {
+				lines = n
+			}
+		}
+		height := float64(lines)*lineHeight + 2
+		if p.pdf.GetY()+height > pageHeight-bottom {
+			p.pdf.AddPage()
+		}
+
+		y := p.pdf.GetY()
+		for j := 0; j < columns; j++ {
+			x := left + float64(j)*width
+			fill := ""
+			if header[i] {
+				fill = "F"
+			}
+			p.pdf.Rect(x, y, width, height, "D"+fill)
+			cell := ""
+			if j < len(row) {
+				cell = row[j]
+			}
+			p.pdf.SetXY(x+1, y+1)
+			p.pdf.MultiCell(width-2, lineHeight, p.tr(cell), "", "L", false)
+		}
+		p.pdf.SetXY(left, y+height)
+	}
+	p.pdf.Ln(4)
+	p.resetText()
+}
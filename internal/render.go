@@ -1,12 +1,16 @@
 package internal
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"regexp"
+	"strings"
 
 	"github.com/gomarkdown/markdown"
 	"github.com/gomarkdown/markdown/ast"
 	mdhtml "github.com/gomarkdown/markdown/html"
+	"github.com/gomarkdown/markdown/parser"
 
 	"github.com/alecthomas/chroma"
 	"github.com/alecthomas/chroma/formatters/html"
@@ -14,9 +18,21 @@ import (
 	"github.com/alecthomas/chroma/styles"
 )
 
+// RendererVersion is part of the render cache key, bump it when the
+// html output changes
+const RendererVersion = "5"
+
+const (
+	DefaultLightStyle = "monokailight"
+	DefaultDarkStyle  = "monokai"
+)
+
 var (
 	htmlFormatter  *html.Formatter
 	highlightStyle *chroma.Style
+
+	fenceRangesRegexp = regexp.MustCompile(`\{([\d,\s-]*)\}`)
+	fenceInfoRegexp   = regexp.MustCompile("(?m)^( {0,3}(?:```+|~~~+)[ \t]*[^\\s{`]*)[ \t]*(\\{[\\d,\\s-]*\\})[ \t]*$")
 )
 
 func init() {
@@ -24,15 +40,73 @@ func init() {
 	if htmlFormatter == nil {
 		panic("couldn't create html formatter")
 	}
-	styleName := "monokailight"
+	styleName := DefaultLightStyle
 	highlightStyle = styles.Get(styleName)
 	if highlightStyle == nil {
 		panic(fmt.Sprintf("didn't find style '%s'", styleName))
 	}
 }
 
+// HasStyle reports whether name is a known chroma style
+func HasStyle(name string) bool {
+	_, ok := styles.Registry[name]
+	return ok
+}
+
+// WriteChromaCSS writes the stylesheet for the highlighting classes in
+// the given chroma style
+func WriteChromaCSS(w io.Writer, name string) error {
+	style, ok := styles.Registry[name]
+	if !ok {
+		return fmt.Errorf("didn't find style '%s'", name)
+	}
+	return htmlFormatter.WriteCSS(w, style)
+}
+
+func newFormatter(lineNumbers bool, ranges [][2]int) *html.Formatter {
+	if !lineNumbers && len(ranges) == 0 {
+		return htmlFormatter
+	}
+	return html.New(html.WithClasses(true), html.TabWidth(2),
+		html.WithLineNumbers(lineNumbers), html.HighlightLines(ranges))
+}
+
+// normalizeFences turns "```go {3-5, 8}" into "```go{3-5,8}", the parser
+// only takes a single word as fence info
+func normalizeFences(content []byte) []byte {
+	if !bytes.Contains(content, []byte("{")) {
+		return content
+	}
+	return fenceInfoRegexp.ReplaceAllFunc(content, func(line []byte) []byte {
+		m := fenceInfoRegexp.FindSubmatch(line)
+		ranges := strings.Join(strings.Fields(string(m[2])), "")
+		return append(append([]byte{}, m[1]...), ranges...)
+	})
+}
+
+// parseFenceInfo splits fence info like "go {3-5,8}" into the language
+// and the line ranges to highlight
+func parseFenceInfo(info string) (string, [][2]int) {
+	m := fenceRangesRegexp.FindStringSubmatchIndex(info)
+	if m == nil {
+		return strings.TrimSpace(info), nil
+	}
+
+	var ranges [][2]int
+	for _, part := range strings.Split(info[m[2]:m[3]], ",") {
+		var from, to int
+		part = strings.TrimSpace(part)
+		if n, _ := fmt.Sscanf(part, "%d-%d", &from, &to); n == 2 && from <= to {
+			ranges = append(ranges, [2]int{from, to})
+		} else if n == 1 {
+			ranges = append(ranges, [2]int{from, from})
+		}
+	}
+	return strings.TrimSpace(info[:m[0]] + info[m[1]:]), ranges
+}
+
 // based on https://github.com/alecthomas/chroma/blob/master/quick/quick.go
-func htmlHighlight(w io.Writer, source, lang, defaultLang string) error {
+func htmlHighlight(w io.Writer, formatter *html.Formatter, source, lang, defaultLang string) error {
 	if lang == "" {
 		lang = defaultLang
 	}
@@ -49,39 +123,390 @@ func htmlHighlight(w io.Writer, source, lang, defaultLang string) error {
 	if err != nil {
 		return err
 	}
-	return htmlFormatter.Format(w, highlightStyle, it)
+	return formatter.Format(w, highlightStyle, it)
 }
 
 // an actual rendering of Paragraph is more complicated
-func renderCode(w io.Writer, codeBlock *ast.CodeBlock, entering bool) {
+func renderCode(w io.Writer, codeBlock *ast.CodeBlock, entering bool, opts RenderOptions) {
 	defaultLang := ""
-	lang := string(codeBlock.Info)
-	htmlHighlight(w, string(codeBlock.Literal), lang, defaultLang)
+	lang, ranges := parseFenceInfo(string(codeBlock.Info))
+	formatter := newFormatter(opts.LineNumbers, ranges)
+	htmlHighlight(w, formatter, string(codeBlock.Literal), lang, defaultLang)
+}
+
+// fixInlineMath applies the dollar rules the parser doesn't know about: no
+// space after the opening $, none before the closing $ and no digit after
+// it, so "$5 and $10" stays text. runs of text and math are joined and
+// split again, which also picks up $$...$$ inside a paragraph
+func fixInlineMath(doc ast.Node) {
+	var parents []ast.Node
+	seen := map[ast.Node]bool{}
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		fix := false
+		switch n := node.(type) {
+		case *ast.Math:
+			fix = entering
+		case *ast.Text:
+			// escaped dollars
+			fix = entering && bytes.Contains(n.Literal, []byte(`\$`))
+		}
+		if parent := node.GetParent(); fix && !seen[parent] {
+			seen[parent] = true
+			parents = append(parents, parent)
+		}
+		return ast.GoToNext
+	})
+
+	for _, parent := range parents {
+		var children []ast.Node
+		var run []byte
+		flush := func() {
+			for _, node := range splitMath(run) {
+				node.SetParent(parent)
+				children = append(children, node)
+			}
+			run = nil
+		}
+		for _, child := range parent.GetChildren() {
+			switch n := child.(type) {
+			case *ast.Text:
+				run = append(run, n.Literal...)
+			case *ast.Math:
+				run = append(append(append(run, '$'), n.Literal...), '$')
+			default:
+				flush()
+				children = append(children, child)
+			}
+		}
+		flush()
+		parent.SetChildren(children)
+	}
 }
 
-func myRenderHook(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
-	if code, ok := node.(*ast.CodeBlock); ok {
-		renderCode(w, code, entering)
+// splitMath splits text into text and inline math nodes, \$ is kept as
+// a dollar sign
+func splitMath(data []byte) []ast.Node {
+	var nodes []ast.Node
+	last := 0
+	for i := 0; i < len(data); i++ {
+		if data[i] != '$' {
+			continue
+		}
+		// \$ is a dollar sign
+		if i > 0 && data[i-1] == '\\' {
+			if i-1 > last {
+				nodes = append(nodes, &ast.Text{Leaf: ast.Leaf{Literal: data[last : i-1]}})
+			}
+			last = i
+			continue
+		}
+		delim := 1
+		if i+1 < len(data) && data[i+1] == '$' {
+			delim = 2
+		}
+		end := closingDollar(data, i+delim, delim)
+		if end < 0 {
+			i += delim - 1
+			continue
+		}
+		if i > last {
+			nodes = append(nodes, &ast.Text{Leaf: ast.Leaf{Literal: data[last:i]}})
+		}
+		nodes = append(nodes, &ast.Math{Leaf: ast.Leaf{Literal: data[i+delim : end]}})
+		last = end + delim
+		i = last - 1
+	}
+	if last < len(data) {
+		nodes = append(nodes, &ast.Text{Leaf: ast.Leaf{Literal: data[last:]}})
+	}
+	return nodes
+}
+
+// closingDollar returns the index of the delimiter closing the math
+// starting at start, or -1
+func closingDollar(data []byte, start, delim int) int {
+	if start >= len(data) || isSpaceByte(data[start]) {
+		return -1
+	}
+	if delim == 2 {
+		if end := bytes.Index(data[start:], []byte("$$")); end > 0 {
+			return start + end
+		}
+		return -1
+	}
+	// the next dollar closes the math or it is no math, like in
+	// "$5 or $10"
+	for end := start + 1; end < len(data); end++ {
+		if data[end] != '$' || data[end-1] == '\\' {
+			continue
+		}
+		if isSpaceByte(data[end-1]) || end+1 < len(data) && data[end+1] >= '0' && data[end+1] <= '9' {
+			return -1
+		}
+		return end
+	}
+	return -1
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func renderMath(w io.Writer, node ast.Node, entering bool) {
+	switch math := node.(type) {
+	case *ast.Math:
+		io.WriteString(w, Latex2MathML(string(math.Literal), false))
+	case *ast.MathBlock:
+		if entering {
+			io.WriteString(w, Latex2MathML(string(math.Literal), true)+"\n")
+		}
+	}
+}
+
+// Admonition is a callout block, from a GitHub alert or a ::: container
+type Admonition struct {
+	ast.Container
+
+	Kind  string
+	Title string
+	// Collapsible renders as details, Open sets its initial state
+	Collapsible bool
+	Open        bool
+}
+
+var (
+	admonitionTitles = map[string]string{
+		"note":      "Note",
+		"tip":       "Tip",
+		"info":      "Info",
+		"important": "Important",
+		"warning":   "Warning",
+		"caution":   "Caution",
+		"danger":    "Danger",
+		"details":   "Details",
+	}
+
+	alertRegexp     = regexp.MustCompile(`^\[!(?i:(NOTE|TIP|INFO|IMPORTANT|WARNING|CAUTION|DANGER))\]([+-]?)[ \t]*([^\n]*)\n?`)
+	containerRegexp = regexp.MustCompile(`^ ?:::[ \t]*([a-zA-Z]+)([+-]?)[ \t]*([^\n]*)\n`)
+	containerEnd    = regexp.MustCompile(`^ ?:::[ \t]*$`)
+)
+
+func newAdmonition(kind, fold, title string) *Admonition {
+	kind = strings.ToLower(kind)
+	if _, ok := admonitionTitles[kind]; !ok {
+		kind = "note"
+	}
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title = admonitionTitles[kind]
+	}
+	return &Admonition{
+		Kind:        kind,
+		Title:       title,
+		Collapsible: fold != "" || kind == "details",
+		Open:        fold == "+",
+	}
+}
+
+// indentContainers shifts ::: lines by a space, the parser reads a line
+// starting with ':' after a blank line as a definition and would take the
+// container into a definition list
+func indentContainers(content []byte) []byte {
+	if !bytes.Contains(content, []byte(":::")) {
+		return content
+	}
+
+	var out bytes.Buffer
+	fence := ""
+	for _, line := range bytes.SplitAfter(content, []byte("\n")) {
+		if m := fenceRegexp.FindSubmatch(line); m != nil {
+			if fence == "" {
+				fence = string(m[1])
+			} else if fence == string(m[1]) {
+				fence = ""
+			}
+		}
+		if fence == "" && bytes.HasPrefix(line, []byte(":::")) {
+			out.WriteByte(' ')
+		}
+		out.Write(line)
+	}
+	return out.Bytes()
+}
+
+// parseContainer is a parser hook for ":::type title" ... ":::" blocks,
+// containers may be nested and ::: lines in code blocks are skipped
+func parseContainer(data []byte) (ast.Node, []byte, int) {
+	m := containerRegexp.FindSubmatch(data)
+	if m == nil {
+		return nil, nil, 0
+	}
+
+	depth := 1
+	fence := ""
+	start := len(m[0])
+	for end := start; end < len(data); {
+		next := bytes.IndexByte(data[end:], '\n')
+		if next < 0 {
+			next = len(data) - end
+		}
+		line := data[end : end+next]
+		if f := fenceRegexp.FindSubmatch(line); f != nil {
+			if fence == "" {
+				fence = string(f[1])
+			} else if fence == string(f[1]) {
+				fence = ""
+			}
+		} else if fence == "" && containerEnd.Match(line) {
+			depth--
+		} else if fence == "" && containerRegexp.Match(data[end:]) {
+			depth++
+		}
+		if depth == 0 {
+			consumed := end + next
+			if consumed < len(data) {
+				consumed++
+			}
+			return newAdmonition(string(m[1]), string(m[2]), string(m[3])), data[start:end], consumed
+		}
+		end += next + 1
+	}
+
+	// unclosed containers are left as plain text
+	return nil, nil, 0
+}
+
+// convertAlerts replaces block quotes starting with [!NOTE] and friends
+// by admonitions
+func convertAlerts(doc ast.Node) {
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		quote, ok := node.(*ast.BlockQuote)
+		if !ok || !entering {
+			return ast.GoToNext
+		}
+		para, ok := ast.GetFirstChild(quote).(*ast.Paragraph)
+		if !ok {
+			return ast.GoToNext
+		}
+		text, ok := ast.GetFirstChild(para).(*ast.Text)
+		if !ok {
+			return ast.GoToNext
+		}
+		m := alertRegexp.FindSubmatch(text.Literal)
+		if m == nil {
+			return ast.GoToNext
+		}
+
+		text.Literal = text.Literal[len(m[0]):]
+		if len(text.Literal) == 0 {
+			ast.RemoveFromTree(text)
+			if len(para.Children) == 0 {
+				ast.RemoveFromTree(para)
+			}
+		}
+
+		admonition := newAdmonition(string(m[1]), string(m[2]), string(m[3]))
+		admonition.SetChildren(quote.Children)
+		for _, child := range admonition.Children {
+			child.SetParent(admonition)
+		}
+		quote.Children = nil
+		replaceNode(quote, admonition)
+		return ast.SkipChildren
+	})
+}
+
+func renderAdmonition(w io.Writer, node *Admonition, entering bool) {
+	tag, title := "div", "p"
+	if node.Collapsible {
+		tag, title = "details", "summary"
+	}
+	if !entering {
+		io.WriteString(w, "</"+tag+">\n")
+		return
+	}
+
+	open := ""
+	if node.Collapsible && node.Open {
+		open = " open"
+	}
+	fmt.Fprintf(w, "<%s class=\"admonition admonition-%s\"%s>\n", tag, node.Kind, open)
+	fmt.Fprintf(w, "<%s class=\"admonition-title\">", title)
+	mdhtml.EscapeHTML(w, []byte(node.Title))
+	fmt.Fprintf(w, "</%s>\n", title)
+}
+
+func myRenderHook(w io.Writer, node ast.Node, entering bool, opts RenderOptions) (ast.WalkStatus, bool) {
+	switch n := node.(type) {
+	case *ast.CodeBlock:
+		renderCode(w, n, entering, opts)
+		return ast.GoToNext, true
+	case *ast.Math, *ast.MathBlock:
+		renderMath(w, n, entering)
 		return ast.GoToNext, true
+	case *Admonition:
+		renderAdmonition(w, n, entering)
+		return ast.GoToNext, true
+	case *WikiLink:
+		renderWikiLink(w, n)
+		return ast.GoToNext, true
+	case *Emoji:
+		renderEmoji(w, n)
+		return ast.GoToNext, true
+	case *ast.Image:
+		if renderEmbed(w, n, entering) {
+			return ast.SkipChildren, true
+		}
 	}
 	return ast.GoToNext, false
 }
 
-func newCustomizedRender() *mdhtml.Renderer {
-	opts := mdhtml.RendererOptions{
-		Flags:          mdhtml.CommonFlags,
-		RenderNodeHook: myRenderHook,
+func newCustomizedRender(opts RenderOptions) *mdhtml.Renderer {
+	hook := func(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+		return myRenderHook(w, node, entering, opts)
 	}
-	return mdhtml.NewRenderer(opts)
+	return mdhtml.NewRenderer(mdhtml.RendererOptions{
+		Flags:          mdhtml.CommonFlags,
+		RenderNodeHook: hook,
+	})
 }
 
-func Render2Html(content []byte) string {
-	// ext := parser.CommonExtensions | parser.AutoHeadingIDs
-	// parser := parser.NewWithExtensions(ext)
-	// doc := parser.Parse(content)
+func newParser() *parser.Parser {
+	ext := parser.CommonExtensions | parser.MathJax | parser.AutoHeadingIDs
+	p := parser.NewWithExtensions(ext)
+	p.Opts.ParserHook = parseContainer
+	return p
+}
+
+// parseMarkdown parses a markdown document, ::: containers included, and
+// fixes up the inline math
+func parseMarkdown(content []byte) ast.Node {
+	doc := newParser().Parse(indentContainers(content))
+	fixInlineMath(doc)
+	return doc
+}
+
+// RenderOptions carries what the renderer needs to know about the document
+type RenderOptions struct {
+	// ResolveWikiLink maps a [[target]] to an url, ok is false when the
+	// target does not exist
+	ResolveWikiLink func(target string) (url string, ok bool)
+	// ResolveAsset maps the local src of an image or embed to its url, ok
+	// is false to keep src
+	ResolveAsset func(src string) (url string, ok bool)
+	// LineNumbers numbers the lines of code blocks
+	LineNumbers bool
+	// CustomEmoji maps :name: shortcodes to image urls
+	CustomEmoji map[string]string
+}
 
-	// htmlFlags := mdhtml.CommonFlags | mdhtml.HrefTargetBlank
-	// opts := mdhtml.RendererOptions{Flags: htmlFlags}
-	renderer := newCustomizedRender()
-	return string(markdown.ToHTML(content, nil, renderer))
+func Render2Html(content []byte, opts RenderOptions) string {
+	doc := parseMarkdown(normalizeFences(content))
+	convertAlerts(doc)
+	parseWikiLinks(doc)
+	resolveWikiLinks(doc, opts.ResolveWikiLink)
+	parseEmoji(doc, opts.CustomEmoji)
+	resolveAssets(doc, opts.ResolveAsset)
+	renderer := newCustomizedRender(opts)
+	return string(markdown.Render(doc, renderer))
 }
@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMath(t *testing.T) {
+	tests := []struct {
+		name, content string
+		want          []string
+		not           []string
+	}{
+		{"inline", "area $x^2$ here\n",
+			[]string{`<p>area <math xmlns="http://www.w3.org/1998/Math/MathML"><semantics><msup><mi>x</mi><mn>2</mn></msup>`, "</math> here</p>"},
+			[]string{`display="block"`}},
+		{"inline double dollars", "inline $$a+b$$ here\n",
+			[]string{"<p>inline <math", "<mi>a</mi><mo>+</mo><mi>b</mi>", "</math> here</p>"},
+			[]string{`display="block"`}},
+		{"display", "$$\n\\frac{a}{b}\n$$\n",
+			[]string{`display="block"`, "<mfrac><mi>a</mi><mi>b</mi></mfrac>"},
+			[]string{"<p>"}},
+		{"escaped dollars", "a \\$5 b and \\$x\\$\n",
+			[]string{"<p>a $5 b and $x$</p>"},
+			[]string{"<math", `\$`}},
+		{"escaped dollar next to math", "\\$ and $y$\n",
+			[]string{"<p>$ and <math", "<mi>y</mi>"},
+			[]string{`\$`}},
+		{"escaped dollar in math", "$\\$5$\n",
+			[]string{"<mo>$</mo><mn>5</mn>"},
+			[]string{"merror"}},
+		{"prices", "costs $5 and $10 or $5.50 and $ 10$\n",
+			[]string{"<p>costs $5 and $10 or $5.50 and $ 10$</p>"},
+			[]string{"<math"}},
+		{"price next to math", "pay $5, or $x$ dollars\n",
+			[]string{"<p>pay $5, or <math", "<mi>x</mi>"},
+			nil},
+		{"code span", "`$x$` and `$$y$$`\n",
+			[]string{"<code>$x$</code>", "<code>$$y$$</code>"},
+			[]string{"<math"}},
+		{"code block", "```\n$y$ and \\$z\n```\n",
+			[]string{"$y$ and \\$z"},
+			[]string{"<math"}},
+	}
+	for _, test := range tests {
+		out := Render2Html([]byte(test.content), RenderOptions{})
+		for _, want := range test.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("%s: %q lacks %q:\n%s", test.name, test.content, want, out)
+			}
+		}
+		for _, not := range test.not {
+			if strings.Contains(out, not) {
+				t.Errorf("%s: %q has %q:\n%s", test.name, test.content, not, out)
+			}
+		}
+	}
+}
+
+func TestRenderContainerCode(t *testing.T) {
+	content := ":::note Title\nBefore\n\n```go\n:::\nfunc main() {}\n```\n\nAfter\n:::\n\nTerm\n: Definition\n"
+	out := Render2Html([]byte(content), RenderOptions{})
+
+	// the ::: in the code block neither closes the container nor leaves it
+	// as text
+	note := strings.Index(out, `<div class="admonition admonition-note">`)
+	code := strings.Index(out, `<pre tabindex="0" class="chroma"><code>`)
+	after := strings.Index(out, "<p>After</p>\n</div>")
+	if note < 0 || code < note || after < code {
+		t.Errorf("code block not kept inside the admonition:\n%s", out)
+	}
+	if !strings.Contains(out, `<span class="kd">func</span>`) || strings.Contains(out, "<p>:::") {
+		t.Errorf("code block lost:\n%s", out)
+	}
+	if !strings.Contains(out, "<dt>Term</dt>\n<dd>Definition</dd>") {
+		t.Errorf("definition list lost:\n%s", out)
+	}
+}
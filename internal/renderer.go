@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"html"
+	"path"
+	"strings"
+)
+
+// Renderer turns a document format into html for the doc.html layout
+type Renderer interface {
+	Render(content []byte, opts RenderOptions) string
+	// Title is the document title found in content, or empty
+	Title(content []byte) string
+}
+
+var renderers = map[string]Renderer{}
+
+func init() {
+	RegisterRenderer(markdownRenderer{}, ".md", ".markdown")
+	RegisterRenderer(notebookRenderer{}, ".ipynb")
+	RegisterRenderer(asciidocRenderer{}, ".adoc", ".asciidoc", ".asc")
+	RegisterRenderer(textRenderer{}, ".txt", ".text", ".rst", ".org")
+	RegisterRenderer(csvRenderer{','}, ".csv")
+	RegisterRenderer(csvRenderer{'\t'}, ".tsv", ".tab")
+}
+
+// RegisterRenderer selects r for files with the given extensions
+func RegisterRenderer(r Renderer, exts ...string) {
+	for _, ext := range exts {
+		renderers[strings.ToLower(ext)] = r
+	}
+}
+
+// GetRenderer returns the renderer for a file by its extension
+func GetRenderer(file string) (Renderer, bool) {
+	r, ok := renderers[strings.ToLower(path.Ext(file))]
+	return r, ok
+}
+
+func IsMarkdown(file string) bool {
+	_, ok := renderers[strings.ToLower(path.Ext(file))].(markdownRenderer)
+	return ok
+}
+
+type markdownRenderer struct{}
+
+func (markdownRenderer) Render(content []byte, opts RenderOptions) string {
+	return Render2Html(content, opts)
+}
+
+func (markdownRenderer) Title(content []byte) string {
+	fence := false
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~") {
+			fence = !fence
+		}
+		if !fence && strings.HasPrefix(line, "# ") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "# "))
+		}
+	}
+	return ""
+}
+
+type textRenderer struct{}
+
+func (textRenderer) Render(content []byte, opts RenderOptions) string {
+	return `<pre class="plain-text">` + html.EscapeString(string(content)) + "</pre>\n"
+}
+
+func (textRenderer) Title(content []byte) string {
+	return ""
+}
@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+const testNotebook = `{
+ "metadata": {"language_info": {"name": "python"}},
+ "cells": [
+  {"cell_type": "markdown", "source": ["# Analysis\n", "Some *notes*."]},
+  {"cell_type": "code", "execution_count": 3, "source": "print(1 < 2)",
+   "outputs": [
+    {"output_type": "stream", "name": "stdout", "text": ["True\n"]},
+    {"output_type": "error", "ename": "ValueError", "evalue": "bad", "traceback": ["\u001b[31mValueError\u001b[0m: bad"]},
+    {"output_type": "execute_result", "data": {"text/plain": ["42"], "application/json": {"a": 1}}}
+   ]}
+ ]
+}`
+
+const testAsciidoc = `= User Guide
+:product: md-doc
+
+== Install {product}
+
+Run *go build* and see https://example.com[the site].
+
+NOTE: Keep a <backup>.
+
+* one
+** nested
+* two
+
+[source,go]
+----
+func main() {}
+----
+
+|===
+|Name |Value
+
+|a |1
+|===
+`
+
+func TestGetRenderer(t *testing.T) {
+	tests := []struct {
+		file, content string
+		title         string
+		want          []string
+	}{
+		{"a/README.MD", "# Hello\n\n```\n# not a title\n```\n", "Hello", []string{"<h1", "Hello</h1>"}},
+		{"notes.txt", "# plain <text>\n", "", []string{`<pre class="plain-text"># plain &lt;text&gt;`}},
+		{"data.ipynb", testNotebook, "Analysis", []string{
+			`<div class="nb-cell nb-markdown">`, "<em>notes</em>",
+			"In [3]:", `<pre class="nb-stream">True`, `<pre class="nb-error">ValueError: bad</pre>`, "<pre>42</pre>",
+		}},
+		{"guide.adoc", testAsciidoc, "User Guide", []string{
+			`<h2 id="install-product">Install md-doc</h2>`,
+			`<strong>go build</strong>`, `<a href="https://example.com">the site</a>`,
+			`<div class="admonition admonition-note">`, "Keep a &lt;backup&gt;.",
+			"<ul>\n<li>one<ul>\n<li>nested</li>\n</ul>\n</li>\n<li>two</li>\n</ul>",
+			"<th>Name</th><th>Value</th>", "<td>a</td><td>1</td>",
+		}},
+	}
+	for _, test := range tests {
+		r, ok := GetRenderer(test.file)
+		if !ok {
+			t.Errorf("no renderer for %s", test.file)
+			continue
+		}
+		if title := r.Title([]byte(test.content)); title != test.title {
+			t.Errorf("title of %s = %q, want %q", test.file, title, test.title)
+		}
+		out := r.Render([]byte(test.content), RenderOptions{})
+		for _, want := range test.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("%s lacks %q:\n%s", test.file, want, out)
+			}
+		}
+	}
+
+	if _, ok := GetRenderer("image.png"); ok {
+		t.Error("renderer for image.png")
+	}
+	if !IsMarkdown("doc.markdown") || IsMarkdown("doc.adoc") {
+		t.Error("IsMarkdown picks the wrong files")
+	}
+}
+
+func TestNotebookInvalid(t *testing.T) {
+	r, _ := GetRenderer("bad.ipynb")
+	if out := r.Render([]byte("{"), RenderOptions{}); !strings.Contains(out, `class="render-error"`) {
+		t.Errorf("invalid notebook rendered as %s", out)
+	}
+}
@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+const (
+	// SanitizeStrict keeps only markdown output, highlighted code and math
+	SanitizeStrict = "strict"
+	// SanitizeIframe is strict plus iframes from the repo's listed hosts
+	SanitizeIframe = "iframe"
+	// SanitizeTrusted skips sanitization, only for repos with trusted writers
+	SanitizeTrusted = "trusted"
+)
+
+var (
+	mathElements = []string{
+		"math", "semantics", "annotation", "mrow", "mi", "mo", "mn", "ms",
+		"mtext", "mspace", "msup", "msub", "msubsup", "munder", "mover",
+		"munderover", "mfrac", "msqrt", "mroot", "mtable", "mtr", "mtd",
+		"merror", "mpadded", "mphantom", "mstyle",
+	}
+	mediaElements = []string{"video", "audio"}
+	// same site paths only, no scheme and no host
+	localURL  = regexp.MustCompile(`^(?:[^:/?#]|/[^/])[^:]*$`)
+	mathAttrs = []string{
+		"display", "mathvariant", "stretchy", "movablelimits", "accent",
+		"accentunder", "linethickness", "columnalign", "width", "encoding",
+		"xmlns",
+	}
+
+	strictPolicy = newStrictPolicy()
+	// iframe policies by their comma joined hosts
+	iframePolicies sync.Map
+)
+
+func newStrictPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	// chroma and the renderer style everything through classes
+	p.AllowStyling()
+	// notebook outputs embed their images
+	p.AllowDataURIImages()
+	p.AllowNoAttrs().OnElements(mathElements...)
+	p.AllowAttrs(mathAttrs...).Matching(regexp.MustCompile(`^[\w\s.:/\-]*$`)).OnElements(mathElements...)
+	p.AllowAttrs("controls").Matching(regexp.MustCompile(`^$`)).OnElements(mediaElements...)
+	p.AllowAttrs("preload").Matching(regexp.MustCompile(`^(none|metadata|auto)$`)).OnElements(mediaElements...)
+	p.AllowAttrs("src").OnElements(mediaElements...)
+	p.AllowAttrs("data").Matching(localURL).OnElements("object")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^application/pdf$`)).OnElements("object")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	return p
+}
+
+func newIframePolicy(hosts []string) *bluemonday.Policy {
+	p := newStrictPolicy()
+	if len(hosts) == 0 {
+		return p
+	}
+
+	quoted := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		quoted = append(quoted, regexp.QuoteMeta(strings.ToLower(host)))
+	}
+	src := regexp.MustCompile(`^https://(` + strings.Join(quoted, "|") + `)(/|$)`)
+
+	p.AllowElements("iframe")
+	p.AllowAttrs("src").Matching(src).OnElements("iframe")
+	p.AllowAttrs("width", "height").Matching(bluemonday.NumberOrPercent).OnElements("iframe")
+	p.AllowAttrs("allowfullscreen", "frameborder", "title").OnElements("iframe")
+	// the sandbox attribute is always set, writers opt in to these values
+	p.AllowIFrames(bluemonday.SandboxAllowScripts, bluemonday.SandboxAllowSameOrigin,
+		bluemonday.SandboxAllowPopups, bluemonday.SandboxAllowPresentation)
+	return p
+}
+
+func iframePolicy(hosts []string) *bluemonday.Policy {
+	key := strings.Join(hosts, ",")
+	if p, ok := iframePolicies.Load(key); ok {
+		return p.(*bluemonday.Policy)
+	}
+	p, _ := iframePolicies.LoadOrStore(key, newIframePolicy(hosts))
+	return p.(*bluemonday.Policy)
+}
+
+// Sanitize filters rendered html through the allowlist policy of a repo,
+// unknown policies fall back to strict.
+func Sanitize(content, policy string, iframeHosts []string) string {
+	switch policy {
+	case SanitizeTrusted:
+		return content
+	case SanitizeIframe:
+		return iframePolicy(iframeHosts).Sanitize(content)
+	default:
+		return strictPolicy.Sanitize(content)
+	}
+}
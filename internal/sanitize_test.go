@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+var testIframeHosts = []string{"www.youtube.com", "player.vimeo.com"}
+
+var xssPayloads = []string{
+	`<script>alert(1)</script>`,
+	`<SCRIPT SRC=//evil.com/x.js></SCRIPT>`,
+	`<scr<script>ipt>alert(1)</script>`,
+	`<img src=x onerror=alert(1)>`,
+	`<p onclick="alert(1)">x</p>`,
+	`<body onload=alert(1)>`,
+	`<div onmouseover="alert(1)" class="admonition">x</div>`,
+	`<video src=x onerror=alert(1)></video>`,
+	`<input type=checkbox autofocus onfocus=alert(1)>`,
+	`<a href="javascript:alert(1)">x</a>`,
+	`<a href="JaVaScRiPt:alert(1)">x</a>`,
+	`<a href=" javascript:alert(1)">x</a>`,
+	`<a href="java&#x09;script:alert(1)">x</a>`,
+	`<a href="&#106;avascript:alert(1)">x</a>`,
+	`<a href="vbscript:msgbox(1)">x</a>`,
+	`<a href="data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==">x</a>`,
+	`<img src="data:text/html,<script>alert(1)</script>">`,
+	`<object data="javascript:alert(1)"></object>`,
+	`<object data="//evil.com/x.swf" type="application/pdf"></object>`,
+	`<embed src="javascript:alert(1)">`,
+	`<form action="javascript:alert(1)"><button>x</button></form>`,
+	`<base href="//evil.com/">`,
+	`<meta http-equiv="refresh" content="0;url=javascript:alert(1)">`,
+	`<link rel=stylesheet href=//evil.com/x.css>`,
+	`<style>body{background:url(javascript:alert(1))}</style>`,
+	`<svg onload=alert(1)>`,
+	`<svg><script>alert(1)</script></svg>`,
+	`<svg><a xlink:href="javascript:alert(1)"><text>x</text></a></svg>`,
+	`<svg><animate attributeName=href to=javascript:alert(1) /></svg>`,
+	`<math><mtext><table><mglyph><style><img src=x onerror=alert(1)>`,
+	`<math href="javascript:alert(1)">x</math>`,
+	`<math><mi xlink:href="javascript:alert(1)">x</mi></math>`,
+	`<math><maction actiontype="statusline#http://evil.com">x</maction></math>`,
+	`<noscript><p title="</noscript><img src=x onerror=alert(1)>">`,
+	`<iframe src="https://evil.com/"></iframe>`,
+	`<iframe src="javascript:alert(1)"></iframe>`,
+	`<iframe srcdoc="<script>alert(1)</script>"></iframe>`,
+	`<iframe src="https://evil.com/?www.youtube.com"></iframe>`,
+	`<iframe src="https://evil.com/www.youtube.com/embed/x"></iframe>`,
+	`<iframe src="https://www.youtube.com.evil.com/embed/x"></iframe>`,
+	`<iframe src="https://www.youtube.com@evil.com/embed/x"></iframe>`,
+	`<iframe src="http://www.youtube.com/embed/x"></iframe>`,
+	`<iframe src="//www.youtube.com/embed/x"></iframe>`,
+	`<iframe src="https://wwwXyoutube.com/embed/x"></iframe>`,
+	`<iframe src="https://www.youtube.com/embed/x" onload="alert(1)"></iframe>`,
+}
+
+// unsafe returns why the sanitized html is unsafe, or ""
+func unsafe(t *testing.T, content string, iframeHosts []string) string {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reason string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "script", "style", "svg", "embed", "form", "base", "meta", "link", "noscript", "body":
+				// body is added by the html parser
+				if n.Data != "body" || len(n.Attr) > 0 {
+					reason = "element " + n.Data
+				}
+			case "iframe":
+				if !allowedIframe(n, iframeHosts) {
+					reason = "iframe " + attr(n, "src")
+				}
+			}
+			for _, a := range n.Attr {
+				name := strings.ToLower(a.Key)
+				value := strings.ToLower(strings.TrimSpace(a.Val))
+				switch {
+				case strings.HasPrefix(name, "on"), name == "srcdoc", name == "formaction":
+					reason = "attribute " + name
+				case name == "href" || name == "src" || name == "data" || name == "action" || a.Namespace != "":
+					if strings.HasPrefix(value, "javascript:") || strings.HasPrefix(value, "vbscript:") ||
+						(strings.HasPrefix(value, "data:") && !(n.Data == "img" && strings.HasPrefix(value, "data:image/"))) {
+						reason = name + "=" + value
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return reason
+}
+
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func allowedIframe(n *html.Node, hosts []string) bool {
+	src := attr(n, "src")
+	for _, host := range hosts {
+		if strings.HasPrefix(src, "https://"+host+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSanitizePayloads(t *testing.T) {
+	policies := []struct {
+		name  string
+		hosts []string
+	}{
+		{SanitizeStrict, nil},
+		{SanitizeIframe, testIframeHosts},
+	}
+	for _, policy := range policies {
+		for _, payload := range xssPayloads {
+			out := Sanitize(payload, policy.name, policy.hosts)
+			if reason := unsafe(t, out, policy.hosts); reason != "" {
+				t.Errorf("%s: %s\n  kept %s\n  in %s", policy.name, payload, reason, out)
+			}
+		}
+	}
+}
+
+func TestSanitizeIframeHosts(t *testing.T) {
+	embed := `<iframe src="https://www.youtube.com/embed/x" width="560" height="315" allowfullscreen></iframe>`
+
+	out := Sanitize(embed, SanitizeIframe, testIframeHosts)
+	if !strings.Contains(out, `src="https://www.youtube.com/embed/x"`) {
+		t.Errorf("allowed iframe dropped: %s", out)
+	}
+	if !strings.Contains(out, "sandbox=") {
+		t.Errorf("iframe without sandbox: %s", out)
+	}
+	if out := Sanitize(embed, SanitizeStrict, testIframeHosts); strings.Contains(out, "<iframe") {
+		t.Errorf("strict kept an iframe: %s", out)
+	}
+	if out := Sanitize(embed, SanitizeIframe, []string{"player.vimeo.com"}); strings.Contains(out, "youtube") {
+		t.Errorf("iframe of an unlisted host kept: %s", out)
+	}
+}
+
+func TestSanitizeKeepsRenderedMarkdown(t *testing.T) {
+	content := Render2Html([]byte("# Title\n\n*a* $x^2$ [link](other.md)\n\n```go\nfunc main() {}\n```\n"), RenderOptions{})
+	out := Sanitize(content, SanitizeStrict, nil)
+	for _, want := range []string{`<h1 id="title">`, "<em>a</em>", "<math", `href="other.md"`, `class="chroma"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("sanitized output lost %q: %s", want, out)
+		}
+	}
+}
+
+func TestIframePolicyCached(t *testing.T) {
+	if iframePolicy(testIframeHosts) != iframePolicy([]string{"www.youtube.com", "player.vimeo.com"}) {
+		t.Error("policy built again for the same hosts")
+	}
+	if iframePolicy(testIframeHosts) == iframePolicy([]string{"www.youtube.com"}) {
+		t.Error("policy shared between host lists")
+	}
+}
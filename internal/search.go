@@ -0,0 +1,202 @@
+package internal
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	nethtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Section is the text of a rendered document from one heading to the
+// next, the text before the first heading has no ID
+type Section struct {
+	Heading string
+	ID      string
+	Text    string
+}
+
+var (
+	headingAtoms = map[atom.Atom]bool{atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true}
+	blockAtoms   = map[atom.Atom]bool{atom.P: true, atom.Div: true, atom.Li: true, atom.Dt: true, atom.Dd: true, atom.Tr: true,
+		atom.Td: true, atom.Th: true, atom.Pre: true, atom.Blockquote: true, atom.Br: true, atom.Figcaption: true}
+)
+
+// HTMLSections splits rendered html at the headings with an id
+func HTMLSections(content string) []Section {
+	context := &nethtml.Node{Type: nethtml.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := nethtml.ParseFragment(strings.NewReader(content), context)
+	if err != nil {
+		return nil
+	}
+
+	sections := []Section{{}}
+	var text strings.Builder
+	var walk func(n *nethtml.Node, b *strings.Builder)
+	walk = func(n *nethtml.Node, b *strings.Builder) {
+		switch {
+		case n.Type == nethtml.TextNode:
+			b.WriteString(n.Data)
+			return
+		case n.DataAtom == atom.Script || n.DataAtom == atom.Style:
+			return
+		case headingAtoms[n.DataAtom]:
+			var id string
+			for _, attr := range n.Attr {
+				if attr.Key == "id" {
+					id = attr.Val
+				}
+			}
+			if id != "" {
+				var heading strings.Builder
+				for c := n.FirstChild; c != nil; c = c.NextSibling {
+					walk(c, &heading)
+				}
+				sections[len(sections)-1].Text = CollapseSpace(text.String())
+				text.Reset()
+				sections = append(sections, Section{Heading: CollapseSpace(heading.String()), ID: id})
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, b)
+		}
+		// blocks don't run into each other
+		if blockAtoms[n.DataAtom] || headingAtoms[n.DataAtom] {
+			b.WriteByte(' ')
+		}
+	}
+	for _, node := range nodes {
+		walk(node, &text)
+	}
+	sections[len(sections)-1].Text = CollapseSpace(text.String())
+
+	if sections[0].Text == "" {
+		sections = sections[1:]
+	}
+	return sections
+}
+
+// SearchTerms splits a query into its distinct lower case words
+func SearchTerms(query string) []string {
+	seen := map[string]bool{}
+	var terms []string
+	for _, word := range strings.FieldsFunc(query, unicode.IsSpace) {
+		word = string(FoldRunes([]rune(word)))
+		if !seen[word] {
+			seen[word] = true
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// FoldRunes lowers each rune on its own, so offsets into the result are
+// offsets into text
+func FoldRunes(text []rune) []rune {
+	folded := make([]rune, len(text))
+	for i, r := range text {
+		folded[i] = unicode.ToLower(r)
+	}
+	return folded
+}
+
+// TermOffsets finds the occurrences of term in folded text, in runes
+func TermOffsets(folded []rune, term string) []int {
+	t := []rune(term)
+	var offsets []int
+	for i := 0; i+len(t) <= len(folded); i++ {
+		match := true
+		for j, r := range t {
+			if folded[i+j] != r {
+				match = false
+				break
+			}
+		}
+		if match {
+			offsets = append(offsets, i)
+			i += len(t) - 1
+		}
+	}
+	return offsets
+}
+
+// Span is a range of runes
+type Span struct {
+	Start int
+	End   int
+}
+
+// Snippet cuts about width runes of text around the first occurrence of a
+// term and returns the spans of the terms in it. A cut is marked with an
+// ellipsis.
+func Snippet(text string, terms []string, width int) (string, []Span) {
+	runes := []rune(text)
+	folded := FoldRunes(runes)
+	first := -1
+	for _, term := range terms {
+		if offsets := TermOffsets(folded, term); len(offsets) > 0 && (first < 0 || offsets[0] < first) {
+			first = offsets[0]
+		}
+	}
+
+	start := 0
+	if first > width/3 {
+		start = first - width/3
+		// start at a word
+		for i := start; i < first; i++ {
+			if unicode.IsSpace(runes[i]) {
+				start = i + 1
+				break
+			}
+		}
+	}
+	end := start + width
+	if end >= len(runes) {
+		end = len(runes)
+	} else {
+		for i := end; i > first && i > start; i-- {
+			if unicode.IsSpace(runes[i]) {
+				end = i
+				break
+			}
+		}
+	}
+
+	snippet := runes[start:end]
+	lead := 0
+	if start > 0 {
+		snippet = append([]rune("…"), snippet...)
+		lead = 1
+	}
+	if end < len(runes) {
+		snippet = append(snippet, []rune("…")...)
+	}
+
+	var spans []Span
+	window := folded[start:end]
+	for _, term := range terms {
+		n := len([]rune(term))
+		for _, at := range TermOffsets(window, term) {
+			spans = append(spans, Span{Start: lead + at, End: lead + at + n})
+		}
+	}
+	return string(snippet), mergeSpans(spans)
+}
+
+// mergeSpans sorts spans and joins the overlapping ones
+func mergeSpans(spans []Span) []Span {
+	sort.Slice(spans, func(i, j int) bool { return spans[i].Start < spans[j].Start })
+	var merged []Span
+	for _, s := range spans {
+		if n := len(merged); n > 0 && s.Start <= merged[n-1].End {
+			if s.End > merged[n-1].End {
+				merged[n-1].End = s.End
+			}
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
@@ -32,6 +32,8 @@ type Config struct {
 	ReceivePack    bool
 	RoutePrefix    string
 	CommandFunc    func(*exec.Cmd)
+	// ReceiveFunc is called with the repo dir after a push
+	ReceiveFunc func(string)
 }
 
 type HandlerReq struct {
@@ -204,7 +206,10 @@ func serviceRpc(hr HandlerReq) {
 		flusher.Flush()
 	}
 
-	cmd.Wait()
+	err = cmd.Wait()
+	if err == nil && rpc == "receive-pack" && DefaultConfig.ReceiveFunc != nil {
+		DefaultConfig.ReceiveFunc(dir)
+	}
 }
 
 func getInfoRefs(hr HandlerReq) {
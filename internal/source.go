@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alecthomas/chroma"
+	chromahtml "github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/lexers"
+)
+
+// line numbers link to #L<n>, doc.js highlights #L<from>-L<to>
+var sourceFormatter = chromahtml.New(chromahtml.WithClasses(true), chromahtml.TabWidth(4),
+	chromahtml.WithLineNumbers(true), chromahtml.LinkableLineNumbers(true, "L"))
+
+// IsText reports whether content looks like text rather than binary
+func IsText(content []byte) bool {
+	sample := content
+	if len(sample) > 8000 {
+		sample = sample[:8000]
+	}
+	return !bytes.Contains(sample, []byte{0}) && utf8.Valid(content)
+}
+
+// RenderSource renders a source file with highlighting and line anchors,
+// rawUrl is linked from the header
+func RenderSource(file string, content []byte, rawUrl string) string {
+	var buf bytes.Buffer
+	lines := bytes.Count(content, []byte("\n"))
+	if len(content) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
+		lines++
+	}
+
+	fmt.Fprintf(&buf, "<div class=\"source-view\">\n<div class=\"source-header\"><span>%d lines · %s</span>"+
+		"<a href=\"%s\">Raw</a></div>\n", lines, FormatSize(int64(len(content))), html.EscapeString(rawUrl))
+
+	l := lexers.Match(path.Base(file))
+	if l == nil {
+		l = lexers.Analyse(string(content))
+	}
+	if l == nil {
+		l = lexers.Fallback
+	}
+	it, err := chroma.Coalesce(l).Tokenise(nil, string(content))
+	if err == nil {
+		err = sourceFormatter.Format(&buf, highlightStyle, it)
+	}
+	if err != nil {
+		fmt.Fprintf(&buf, "<pre>%s</pre>", html.EscapeString(string(content)))
+	}
+	buf.WriteString("\n</div>\n")
+	return buf.String()
+}
+
+// RenderDownload offers a download instead of showing the file
+func RenderDownload(reason string, size int64, downloadUrl string) string {
+	return fmt.Sprintf("<div class=\"source-view\">\n<p class=\"source-download\">%s (%s). "+
+		"<a href=\"%s\">Download</a></p>\n</div>\n", html.EscapeString(reason), FormatSize(size), html.EscapeString(downloadUrl))
+}
+
+func FormatSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	value := float64(size)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", value), ".0") + " " + units[i]
+}
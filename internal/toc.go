@@ -0,0 +1,41 @@
+package internal
+
+import (
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// Heading is an entry of a document's table of contents
+type Heading struct {
+	Level int
+	Text  string
+	ID    string
+}
+
+// Headings lists the headings of a markdown document as the renderer
+// numbers them, other formats have none
+func Headings(file string, content []byte) []Heading {
+	if !IsMarkdown(file) {
+		return nil
+	}
+
+	var headings []Heading
+	doc := parseMarkdown(normalizeFences(content))
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		heading, ok := node.(*ast.Heading)
+		if !ok || !entering || heading.IsTitleblock {
+			return ast.GoToNext
+		}
+		var text strings.Builder
+		ast.WalkFunc(heading, func(node ast.Node, entering bool) ast.WalkStatus {
+			if leaf := node.AsLeaf(); leaf != nil && entering {
+				text.Write(leaf.Literal)
+			}
+			return ast.GoToNext
+		})
+		headings = append(headings, Heading{Level: heading.Level, Text: text.String(), ID: heading.HeadingID})
+		return ast.SkipChildren
+	})
+	return headings
+}
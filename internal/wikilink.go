@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/gomarkdown/markdown/ast"
+	mdhtml "github.com/gomarkdown/markdown/html"
+)
+
+// WikiLink is a [[target]] or [[target|label]] link to another document
+// of the same repo, target may carry a #heading anchor
+type WikiLink struct {
+	ast.Leaf
+
+	Target string
+	Label  string
+	// Destination is empty when the target could not be resolved
+	Destination string
+}
+
+var wikiLinkRegexp = regexp.MustCompile(`\[\[([^\[\]|\n]+)(?:\|([^\[\]\n]+))?\]\]`)
+
+// replaceNode puts nodes in the place of old in its parent
+func replaceNode(old ast.Node, nodes ...ast.Node) {
+	parent := old.GetParent()
+	var children []ast.Node
+	for _, child := range parent.GetChildren() {
+		if child != old {
+			children = append(children, child)
+			continue
+		}
+		for _, n := range nodes {
+			n.SetParent(parent)
+			children = append(children, n)
+		}
+	}
+	parent.SetChildren(children)
+	old.SetParent(nil)
+}
+
+// parseWikiLinks splits text nodes around [[...]], code spans and blocks
+// are not text nodes so they are left alone
+func parseWikiLinks(doc ast.Node) {
+	var texts []*ast.Text
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if text, ok := node.(*ast.Text); ok && entering && wikiLinkRegexp.Match(text.Literal) {
+			texts = append(texts, text)
+		}
+		return ast.GoToNext
+	})
+
+	for _, text := range texts {
+		var nodes []ast.Node
+		last := 0
+		for _, m := range wikiLinkRegexp.FindAllSubmatchIndex(text.Literal, -1) {
+			if m[0] > last {
+				nodes = append(nodes, &ast.Text{Leaf: ast.Leaf{Literal: text.Literal[last:m[0]]}})
+			}
+			link := &WikiLink{Target: strings.TrimSpace(string(text.Literal[m[2]:m[3]]))}
+			if m[4] >= 0 {
+				link.Label = strings.TrimSpace(string(text.Literal[m[4]:m[5]]))
+			}
+			if link.Label == "" {
+				link.Label = link.Target
+			}
+			nodes = append(nodes, link)
+			last = m[1]
+		}
+		if last < len(text.Literal) {
+			nodes = append(nodes, &ast.Text{Leaf: ast.Leaf{Literal: text.Literal[last:]}})
+		}
+		replaceNode(text, nodes...)
+	}
+}
+
+func resolveWikiLinks(doc ast.Node, resolve func(target string) (string, bool)) {
+	if resolve == nil {
+		return
+	}
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if link, ok := node.(*WikiLink); ok && entering {
+			if url, ok := resolve(link.Target); ok {
+				link.Destination = url
+			}
+		}
+		return ast.GoToNext
+	})
+}
+
+func renderWikiLink(w io.Writer, link *WikiLink) {
+	if link.Destination == "" {
+		io.WriteString(w, `<span class="wikilink wikilink-missing" title="Missing document">`)
+		mdhtml.EscapeHTML(w, []byte(link.Label))
+		io.WriteString(w, `</span>`)
+		return
+	}
+	io.WriteString(w, `<a class="wikilink" href="`)
+	mdhtml.EscapeHTML(w, []byte(link.Destination))
+	io.WriteString(w, `">`)
+	mdhtml.EscapeHTML(w, []byte(link.Label))
+	io.WriteString(w, `</a>`)
+}
+
+// HeadingID turns heading text into the anchor the renderer generates for it
+func HeadingID(text string) string {
+	var id []rune
+	dash := false
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			if dash && len(id) > 0 {
+				id = append(id, '-')
+			}
+			dash = false
+			id = append(id, unicode.ToLower(r))
+		default:
+			dash = true
+		}
+	}
+	if len(id) == 0 {
+		return "empty"
+	}
+	return string(id)
+}
+
+// ExtractLinks returns the wiki link targets and the relative link
+// destinations of a markdown document
+func ExtractLinks(content []byte) (wiki []string, links []string) {
+	doc := parseMarkdown(content)
+	parseWikiLinks(doc)
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+		switch n := node.(type) {
+		case *WikiLink:
+			wiki = append(wiki, n.Target)
+		case *ast.Link:
+			dest := string(n.Destination)
+			if dest != "" && !strings.Contains(dest, ":") && !strings.HasPrefix(dest, "#") {
+				links = append(links, dest)
+			}
+		}
+		return ast.GoToNext
+	})
+	return wiki, links
+}
@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRenderWikiLinks(t *testing.T) {
+	docs := map[string]string{"Deployment Guide": "/doc/demo/deploy.md", "ops/runbook": "/doc/demo/ops/runbook.md"}
+	opts := RenderOptions{ResolveWikiLink: func(target string) (string, bool) {
+		anchor := ""
+		if i := strings.Index(target, "#"); i >= 0 {
+			target, anchor = target[:i], "#"+HeadingID(target[i+1:])
+		}
+		url, ok := docs[target]
+		return url + anchor, ok
+	}}
+	content := "See [[Deployment Guide]], [[ops/runbook#Roll back|the rollback]] and [[Missing]].\n\n" +
+		"`[[Deployment Guide]]`\n\n```\n[[ops/runbook]]\n```\n"
+	out := Render2Html([]byte(content), opts)
+
+	for _, want := range []string{
+		`<a class="wikilink" href="/doc/demo/deploy.md">Deployment Guide</a>`,
+		`<a class="wikilink" href="/doc/demo/ops/runbook.md#roll-back">the rollback</a>`,
+		`<span class="wikilink wikilink-missing" title="Missing document">Missing</span>`,
+		"<code>[[Deployment Guide]]</code>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("rendered wiki links lack %s:\n%s", want, out)
+		}
+	}
+	if strings.Count(out, `class="wikilink"`) != 2 {
+		t.Errorf("wiki links in code rendered:\n%s", out)
+	}
+}
+
+func TestHeadingID(t *testing.T) {
+	tests := map[string]string{
+		"Roll back":          "roll-back",
+		"  Step 2: Deploy! ": "step-2-deploy",
+		"Überblick & Zweck":  "überblick-zweck",
+		"a--b":               "a-b",
+	}
+	for text, want := range tests {
+		if got := HeadingID(text); got != want {
+			t.Errorf("HeadingID(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestExtractLinks(t *testing.T) {
+	content := "[[Guide]] [[ops/runbook#x|r]] [a](a.md) [b](../b.md#part) [web](https://example.com) [top](#top)\n\n`[[code]]`\n"
+	wiki, links := ExtractLinks([]byte(content))
+	if fmt.Sprint(wiki) != "[Guide ops/runbook#x]" || fmt.Sprint(links) != "[a.md ../b.md#part]" {
+		t.Errorf("wiki %q, links %q", wiki, links)
+	}
+}
@@ -0,0 +1,86 @@
+package logic
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/scnon/md-doc/utils"
+)
+
+var errContentType = errors.New("content type must be application/json")
+
+// ReadAccess answers 404 on the routes of a repo the user can't read, as
+// if it didn't exist. Git clones are checked too, the server syncs its
+// checkouts from disk.
+func ReadAccess(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		repo := c.Param("repo")
+		if repo == "" {
+			return next(c)
+		}
+		if user, _ := utils.CurrentUser(c); utils.CanRead(repo, user) {
+			return next(c)
+		}
+		if strings.HasPrefix(c.Path(), "/api/") {
+			return utils.RespError(c, 404, "not found")
+		}
+		return utils.Resp404(c)
+	}
+}
+
+// SameOrigin refuses changing requests from other sites, browsers would
+// send them as the user signed in at the proxy. Api tokens aren't sent by
+// browsers on their own and git has its own auth.
+func SameOrigin(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		switch req.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return next(c)
+		}
+		if strings.HasPrefix(c.Path(), "/repo/") || strings.HasPrefix(req.Header.Get(echo.HeaderAuthorization), "Bearer ") {
+			return next(c)
+		}
+		if !sameOrigin(req) {
+			return utils.RespError(c, 403, "cross site request refused")
+		}
+		return next(c)
+	}
+}
+
+// sameOrigin checks where a request comes from by its Sec-Fetch-Site,
+// Origin or Referer header, requests without any are refused
+func sameOrigin(req *http.Request) bool {
+	if site := req.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site == "same-origin" || site == "none"
+	}
+	source := req.Header.Get(echo.HeaderOrigin)
+	if source == "" {
+		source = req.Referer()
+	}
+	u, err := url.Parse(source)
+	return source != "" && err == nil && u.Host == req.Host
+}
+
+// bindJSON decodes the json body of a request into v, other content types
+// are refused since forms of other sites can send them without asking
+func bindJSON(c echo.Context, v interface{}) error {
+	mediaType, _, err := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if err != nil || mediaType != echo.MIMEApplicationJSON {
+		return errContentType
+	}
+	return json.NewDecoder(c.Request().Body).Decode(v)
+}
+
+// respBindError answers a request bindJSON failed on
+func respBindError(c echo.Context, err error) error {
+	if errors.Is(err, errContentType) {
+		return utils.RespError(c, 415, err.Error())
+	}
+	return utils.RespError(c, 400, "invalid request")
+}
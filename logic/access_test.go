@@ -0,0 +1,86 @@
+package logic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestSameOrigin(t *testing.T) {
+	e := echo.New()
+	e.Use(SameOrigin)
+	ok := func(c echo.Context) error { return c.String(200, "ok") }
+	e.POST("/api/doc/save", ok)
+	e.GET("/api/doc/save", ok)
+	e.POST("/repo/:repo/:action", ok)
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string]string
+		want    int
+	}{
+		{"same origin", "POST", "/api/doc/save", map[string]string{"Origin": "http://docs.test"}, 200},
+		{"same origin referer", "POST", "/api/doc/save", map[string]string{"Referer": "http://docs.test/edit/a/b.md"}, 200},
+		{"fetch metadata", "POST", "/api/doc/save", map[string]string{"Sec-Fetch-Site": "same-origin", "Origin": "http://evil.test"}, 200},
+		{"other origin", "POST", "/api/doc/save", map[string]string{"Origin": "http://evil.test"}, 403},
+		{"other referer", "POST", "/api/doc/save", map[string]string{"Referer": "http://evil.test/docs.test"}, 403},
+		{"cross site fetch", "POST", "/api/doc/save", map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "http://docs.test"}, 403},
+		{"same site fetch", "POST", "/api/doc/save", map[string]string{"Sec-Fetch-Site": "same-site"}, 403},
+		{"no origin", "POST", "/api/doc/save", nil, 403},
+		{"null origin", "POST", "/api/doc/save", map[string]string{"Origin": "null"}, 403},
+		{"api token", "POST", "/api/doc/save", map[string]string{"Authorization": "Bearer secret"}, 200},
+		{"git", "POST", "/repo/demo/git-receive-pack", nil, 200},
+		{"get", "GET", "/api/doc/save", map[string]string{"Origin": "http://evil.test"}, 200},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, "http://docs.test"+test.path, strings.NewReader("{}"))
+		for k, v := range test.headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != test.want {
+			t.Errorf("%s: %d, want %d", test.name, rec.Code, test.want)
+		}
+	}
+}
+
+func TestBindJSON(t *testing.T) {
+	e := echo.New()
+	e.POST("/", func(c echo.Context) error {
+		var req struct{ Key string }
+		if err := bindJSON(c, &req); err != nil {
+			return respBindError(c, err)
+		}
+		return c.String(200, req.Key)
+	})
+
+	tests := []struct {
+		contentType string
+		body        string
+		want        int
+	}{
+		{"application/json", `{"key":"a"}`, 200},
+		{"application/json; charset=utf-8", `{"key":"a"}`, 200},
+		{"text/plain", `{"key":"a"}`, 415},
+		{"application/x-www-form-urlencoded", `{"key":"a"}`, 415},
+		{"", `{"key":"a"}`, 415},
+		{"application/json", `{"key":`, 400},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+		if test.contentType != "" {
+			req.Header.Set("Content-Type", test.contentType)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != test.want {
+			t.Errorf("%q: %d, want %d", test.contentType, rec.Code, test.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package logic
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/scnon/md-doc/model"
+	"github.com/scnon/md-doc/utils"
+)
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// pageParams reads the offset and limit query params of a listing
+func pageParams(c echo.Context) (offset, limit int, ok bool) {
+	limit = defaultPageLimit
+	if s := c.QueryParam("offset"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return 0, 0, false
+		}
+		offset = n
+	}
+	if s := c.QueryParam("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxPageLimit {
+			return 0, 0, false
+		}
+		limit = n
+	}
+	return offset, limit, true
+}
+
+// apiPath cleans the path of an api request, empty is the repo root
+func apiPath(file string) (string, bool) {
+	if file == "" || file == "/" {
+		return "", true
+	}
+	clean, err := utils.CleanPath(file)
+	return clean, err == nil
+}
+
+// respApiError answers the errors of reading a repo
+func respApiError(c echo.Context, err error, what string) error {
+	switch {
+	case errors.Is(err, utils.ErrUnknownRef):
+		return utils.RespError(c, 404, err.Error())
+	case errors.Is(err, os.ErrNotExist):
+		return utils.RespError(c, 404, "not found")
+	case errors.Is(err, utils.ErrNotDir):
+		return utils.RespError(c, 400, err.Error())
+	}
+	log.Println(what, "failed:", c.Param("repo"), err)
+	return utils.RespError(c, 500, what+" failed")
+}
+
+// TreeApiHandler lists a directory of a repo at ?ref=, the repo root
+// without ?path=
+func TreeApiHandler(c echo.Context) error {
+	repo := c.Param("repo")
+	if !utils.CheckRepoExist(repo) {
+		return utils.RespError(c, 404, "repo not found")
+	}
+	dir, ok := apiPath(c.QueryParam("path"))
+	if !ok {
+		return utils.RespError(c, 400, "invalid path")
+	}
+	offset, limit, ok := pageParams(c)
+	if !ok {
+		return utils.RespError(c, 400, "invalid offset or limit")
+	}
+
+	tree, err := utils.ReadTree(repo, c.QueryParam("ref"), dir, offset, limit)
+	if err != nil {
+		return respApiError(c, err, "tree")
+	}
+	return c.JSON(200, model.Response{Code: 200, Msg: "success", Data: tree})
+}
+
+// DocApiHandler sends a document at ?ref= as json
+func DocApiHandler(c echo.Context) error {
+	repo := c.Param("repo")
+	if !utils.CheckRepoExist(repo) {
+		return utils.RespError(c, 404, "repo not found")
+	}
+	file, err := utils.CleanPath(c.Param("*"))
+	if err != nil {
+		return utils.RespError(c, 400, "invalid path")
+	}
+
+	doc, err := utils.ReadDoc(repo, c.QueryParam("ref"), file)
+	if err != nil {
+		return respApiError(c, err, "doc")
+	}
+	return c.JSON(200, model.Response{Code: 200, Msg: "success", Data: doc})
+}
+
+// CommitsApiHandler lists the history of ?ref=, of a single file with
+// ?path=
+func CommitsApiHandler(c echo.Context) error {
+	repo := c.Param("repo")
+	if !utils.CheckRepoExist(repo) {
+		return utils.RespError(c, 404, "repo not found")
+	}
+	file, ok := apiPath(c.QueryParam("path"))
+	if !ok {
+		return utils.RespError(c, 400, "invalid path")
+	}
+	offset, limit, ok := pageParams(c)
+	if !ok {
+		return utils.RespError(c, 400, "invalid offset or limit")
+	}
+
+	commits, err := utils.ListCommits(repo, c.QueryParam("ref"), file, offset, limit)
+	if err != nil {
+		return respApiError(c, err, "commits")
+	}
+	return c.JSON(200, model.Response{Code: 200, Msg: "success", Data: commits})
+}
+
+// OpenAPIHandler serves the description of the json api
+func OpenAPIHandler(c echo.Context) error {
+	return c.File("./static/openapi.json")
+}
@@ -0,0 +1,177 @@
+package logic
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/scnon/md-doc/model"
+	"github.com/scnon/md-doc/utils"
+)
+
+// apiServer serves the json api of a repo with two commits, it returns
+// their hashes
+func apiServer(t *testing.T) (e *echo.Echo, first, second string) {
+	t.Helper()
+	utils.DataPath = t.TempDir() + "/"
+	if _, err := git.PlainInit(utils.GetRepoPath("api"), true); err != nil {
+		t.Fatal(err)
+	}
+	commit := func(message string, files map[string]string) string {
+		var changes []utils.FileChange
+		for file, content := range files {
+			changes = append(changes, utils.FileChange{Path: file, Content: []byte(content)})
+		}
+		hash, err := utils.CommitFiles("api", changes, utils.CommitOptions{
+			Message: message,
+			Author:  model.User{Name: "alice", Email: "alice@localhost"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+	first = commit("add docs", map[string]string{
+		"a.md":        "---\ntags: [x]\n---\n# A\n\n## Setup\n",
+		"docs/b.md":   "# B\n",
+		"docs/c.json": "{}",
+	})
+	second = commit("update a\n\nwith a body", map[string]string{"a.md": "# A2\n"})
+
+	e = echo.New()
+	e.GET("/api/repos/:repo/tree", TreeApiHandler)
+	e.GET("/api/repos/:repo/docs/*", DocApiHandler)
+	e.GET("/api/repos/:repo/commits", CommitsApiHandler)
+	return e, first, second
+}
+
+// getApi requests url and decodes the data of the response into data
+func getApi(t *testing.T, e *echo.Echo, url string, data interface{}) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+	if rec.Code == 200 {
+		if err := json.Unmarshal(rec.Body.Bytes(), &model.Response{Data: data}); err != nil {
+			t.Fatalf("%s: %v", url, err)
+		}
+	}
+	return rec.Code
+}
+
+func TestTreeApi(t *testing.T) {
+	e, first, _ := apiServer(t)
+
+	var tree model.Tree
+	if code := getApi(t, e, "/api/repos/api/tree", &tree); code != 200 {
+		t.Fatalf("tree: %d", code)
+	}
+	if len(tree.Entries) != 2 || tree.Entries[0].Path != "a.md" || !tree.Entries[0].Doc ||
+		tree.Entries[1].Path != "docs" || tree.Entries[1].Type != "dir" {
+		t.Errorf("root entries %+v", tree.Entries)
+	}
+
+	tree = model.Tree{}
+	if code := getApi(t, e, "/api/repos/api/tree?path=docs&limit=1&ref="+first, &tree); code != 200 {
+		t.Fatalf("docs tree: %d", code)
+	}
+	if tree.Commit != first || len(tree.Entries) != 1 || tree.Entries[0].Path != "docs/b.md" || !tree.More {
+		t.Errorf("docs tree %+v", tree)
+	}
+
+	for url, want := range map[string]int{
+		"/api/repos/nope/tree":             404,
+		"/api/repos/api/tree?path=missing": 404,
+		"/api/repos/api/tree?path=a.md":    400,
+		"/api/repos/api/tree?path=.git":    400,
+		"/api/repos/api/tree?ref=nope":     404,
+		"/api/repos/api/tree?limit=0":      400,
+		"/api/repos/api/tree?offset=-1":    400,
+		"/api/repos/api/tree?limit=100000": 400,
+	} {
+		if code := getApi(t, e, url, nil); code != want {
+			t.Errorf("%s: %d, want %d", url, code, want)
+		}
+	}
+}
+
+func TestDocApi(t *testing.T) {
+	e, first, second := apiServer(t)
+
+	var doc model.Doc
+	if code := getApi(t, e, "/api/repos/api/docs/a.md?ref="+first, &doc); code != 200 {
+		t.Fatalf("doc: %d", code)
+	}
+	if doc.Commit != first || doc.Title != "A" || doc.FrontMatter["tags"] == nil || len(doc.Headings) != 2 ||
+		doc.Created == nil || doc.Created.Hash != first || doc.Updated.Hash != first {
+		t.Errorf("doc at the first commit %+v", doc)
+	}
+
+	doc = model.Doc{}
+	if code := getApi(t, e, "/api/repos/api/docs/a.md", &doc); code != 200 {
+		t.Fatalf("doc: %d", code)
+	}
+	if doc.Commit != second || doc.Title != "A2" || doc.Raw != "# A2\n" || doc.Created.Hash != first || doc.Updated.Hash != second {
+		t.Errorf("doc at head %+v", doc)
+	}
+
+	for url, want := range map[string]int{
+		"/api/repos/api/docs/missing.md": 404,
+		"/api/repos/api/docs/docs":       404,
+		"/api/repos/nope/docs/a.md":      404,
+	} {
+		if code := getApi(t, e, url, nil); code != want {
+			t.Errorf("%s: %d, want %d", url, code, want)
+		}
+	}
+}
+
+func TestCommitsApi(t *testing.T) {
+	e, first, second := apiServer(t)
+
+	var list model.CommitList
+	if code := getApi(t, e, "/api/repos/api/commits", &list); code != 200 {
+		t.Fatalf("commits: %d", code)
+	}
+	if len(list.Commits) != 2 || list.Commits[0].Hash != second || list.Commits[0].Subject != "update a" ||
+		list.Commits[1].Hash != first || list.Commits[0].Parents[0] != first || list.More {
+		t.Errorf("commits %+v", list)
+	}
+
+	list = model.CommitList{}
+	if code := getApi(t, e, "/api/repos/api/commits?path=docs/b.md", &list); code != 200 {
+		t.Fatalf("file commits: %d", code)
+	}
+	if len(list.Commits) != 1 || list.Commits[0].Hash != first {
+		t.Errorf("commits of docs/b.md %+v", list.Commits)
+	}
+
+	list = model.CommitList{}
+	if code := getApi(t, e, "/api/repos/api/commits?limit=1", &list); code != 200 {
+		t.Fatalf("commit page: %d", code)
+	}
+	if len(list.Commits) != 1 || list.Commits[0].Hash != second || !list.More {
+		t.Errorf("first page %+v", list)
+	}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	data, err := os.ReadFile("../static/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec struct {
+		OpenAPI string                     `json:"openapi"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/api/repos/{repo}/tree", "/api/repos/{repo}/docs/{path}", "/api/repos/{repo}/commits"} {
+		if _, ok := spec.Paths[p]; !ok || spec.OpenAPI == "" {
+			t.Errorf("spec lacks %s", p)
+		}
+	}
+}
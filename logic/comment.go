@@ -0,0 +1,111 @@
+package logic
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/scnon/md-doc/model"
+	"github.com/scnon/md-doc/utils"
+)
+
+// CommentsHandler lists the comment threads on a document
+func CommentsHandler(c echo.Context) error {
+	repo := c.Param("repo")
+	path, err := utils.CleanPath(c.Param("*"))
+	if err != nil || !utils.CheckRepoExist(repo) {
+		return utils.RespError(c, 404, "not found")
+	}
+	threads, err := utils.DocComments(repo, path)
+	if errors.Is(err, os.ErrNotExist) {
+		return utils.RespError(c, 404, "not found")
+	}
+	if err != nil {
+		log.Println("comments failed:", repo, path, err)
+		return utils.RespError(c, 500, "comments failed")
+	}
+	return c.JSON(200, model.Response{Code: 200, Msg: "success", Data: threads})
+}
+
+// AddCommentHandler starts a thread or replies to one
+func AddCommentHandler(c echo.Context) error {
+	var req model.CommentReq
+	if err := bindJSON(c, &req); err != nil {
+		return respBindError(c, err)
+	}
+	path, err := utils.CleanPath(req.Path)
+	if err != nil || !utils.CheckRepoExist(req.Repo) {
+		return utils.RespError(c, 404, "not found")
+	}
+	user, ok := utils.CurrentUser(c)
+	if !ok {
+		return utils.RespError(c, 401, "sign in to comment")
+	}
+	if !utils.CanRead(req.Repo, user) {
+		return utils.RespError(c, 404, "not found")
+	}
+	req.Path = path
+	if req.Body = strings.TrimSpace(req.Body); req.Body == "" {
+		return utils.RespError(c, 400, "empty comment")
+	}
+
+	comment, err := utils.AddComment(req, user)
+	switch {
+	case errors.Is(err, utils.ErrNoAnchor), errors.Is(err, utils.ErrNotThread), errors.Is(err, utils.ErrQuoteLength):
+		return utils.RespError(c, 400, err.Error())
+	case errors.Is(err, os.ErrNotExist):
+		return utils.RespError(c, 404, "not found")
+	case err != nil:
+		log.Println("comment failed:", req.Repo, path, err)
+		return utils.RespError(c, 500, "comment failed")
+	}
+	return c.JSON(200, model.Response{Code: 200, Msg: "success", Data: comment})
+}
+
+// ResolveCommentHandler resolves or reopens a thread
+func ResolveCommentHandler(c echo.Context) error {
+	var req model.CommentReq
+	if err := bindJSON(c, &req); err != nil {
+		return respBindError(c, err)
+	}
+	user, ok := utils.CurrentUser(c)
+	if !ok {
+		return utils.RespError(c, 401, "sign in to resolve")
+	}
+
+	err := utils.ResolveComment(req.Repo, req.ID, req.Resolved, user)
+	switch {
+	case errors.Is(err, utils.ErrNotThread):
+		return utils.RespError(c, 400, err.Error())
+	case errors.Is(err, os.ErrNotExist):
+		return utils.RespError(c, 404, "not found")
+	case errors.Is(err, os.ErrPermission):
+		return utils.RespError(c, 403, "you can't resolve this thread")
+	case err != nil:
+		log.Println("resolve failed:", req.Repo, req.ID, err)
+		return utils.RespError(c, 500, "resolve failed")
+	}
+	return c.JSON(200, model.Response{Code: 200, Msg: "success"})
+}
+
+// MentionsHandler lists the latest comments mentioning the signed in user
+func MentionsHandler(c echo.Context) error {
+	user, ok := utils.CurrentUser(c)
+	if !ok {
+		return utils.RespError(c, 401, "sign in first")
+	}
+	comments, err := utils.MentionedComments(user, 50)
+	if err != nil {
+		log.Println("mentions failed:", user.Name, err)
+		return utils.RespError(c, 500, "mentions failed")
+	}
+	readable := []model.Comment{}
+	for _, comment := range comments {
+		if utils.CanRead(comment.Repo, user) {
+			readable = append(readable, comment)
+		}
+	}
+	return c.JSON(200, model.Response{Code: 200, Msg: "success", Data: readable})
+}
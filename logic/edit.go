@@ -0,0 +1,360 @@
+package logic
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/scnon/md-doc/internal"
+	"github.com/scnon/md-doc/model"
+	"github.com/scnon/md-doc/utils"
+)
+
+// EditHandler shows the editor of a document, it edits the tip of the
+// default branch or of the proposal given by ?proposal=
+func EditHandler(c echo.Context) error {
+	repo := c.Param("repo")
+	path, err := utils.WritablePath(c.Param("*"))
+	if errors.Is(err, utils.ErrConfigPath) {
+		return c.HTML(403, "403 Forbidden")
+	}
+	if err != nil || !utils.CheckRepoExist(repo) {
+		return utils.Resp404(c)
+	}
+	user, ok := utils.CurrentUser(c)
+	if !ok {
+		return c.HTML(401, "401 Unauthorized")
+	}
+
+	branch := ""
+	var proposal *model.Proposal
+	if id := c.QueryParam("proposal"); id != "" {
+		proposal, err = getProposal(repo, id)
+		if err != nil {
+			return utils.Resp404(c)
+		}
+		if proposal.Status != model.ProposalOpen || !utils.CanChangeProposal(proposal, user) {
+			return c.HTML(403, "403 Forbidden")
+		}
+		branch = proposal.Branch
+	}
+
+	content, blob, err := utils.ReadBranchFile(repo, branch, path)
+	if errors.Is(err, os.ErrNotExist) {
+		return utils.Resp404(c)
+	}
+	if err != nil {
+		return utils.Resp500(c, err)
+	}
+	if !utils.EditableDoc(path, content) {
+		return c.HTML(403, "403 Forbidden")
+	}
+
+	res, err := utils.RenderEditPage(repo, path, content, blob, user, proposal)
+	if err != nil {
+		return utils.Resp500(c, err)
+	}
+	return c.HTML(200, res)
+}
+
+// RenderApiHandler renders unsaved content for the editor preview
+func RenderApiHandler(c echo.Context) error {
+	var req model.RenderReq
+	if err := bindJSON(c, &req); err != nil {
+		return respBindError(c, err)
+	}
+	path, err := utils.CleanPath(req.Path)
+	if err != nil || !utils.CheckRepoExist(req.Repo) {
+		return utils.RespError(c, 404, "not found")
+	}
+	if user, _ := utils.CurrentUser(c); !utils.CanRead(req.Repo, user) {
+		return utils.RespError(c, 404, "not found")
+	}
+
+	return c.JSON(200, model.Response{
+		Code: 200,
+		Msg:  "success",
+		Data: utils.PreviewDoc(req.Repo, path, []byte(req.Content)),
+	})
+}
+
+// SaveHandler commits an edited document, edits of an outdated version
+// are refused with 409
+func SaveHandler(c echo.Context) error {
+	var req model.SaveReq
+	if err := bindJSON(c, &req); err != nil {
+		return respBindError(c, err)
+	}
+	path, err := utils.WritablePath(req.Path)
+	if errors.Is(err, utils.ErrConfigPath) {
+		return utils.RespError(c, 403, err.Error())
+	}
+	if err != nil || !utils.CheckRepoExist(req.Repo) {
+		return utils.RespError(c, 404, "not found")
+	}
+	user, ok := utils.CurrentUser(c)
+	if !ok {
+		return utils.RespError(c, 401, "sign in to edit")
+	}
+	if !utils.CanRead(req.Repo, user) {
+		return utils.RespError(c, 404, "not found")
+	}
+	content := []byte(req.Content)
+	if !utils.EditableDoc(path, content) {
+		return utils.RespError(c, 403, "you can't edit this document")
+	}
+
+	// users without write access propose their edits
+	url := utils.GetDocUrl(req.Repo, path)
+	var commit string
+	var p *model.Proposal
+	switch {
+	case req.Proposal != 0:
+		p, err = utils.GetProposal(req.Repo, req.Proposal)
+		if err != nil {
+			return utils.RespError(c, 404, "not found")
+		}
+		if !utils.CanChangeProposal(p, user) {
+			return utils.RespError(c, 403, "you can't change this proposal")
+		}
+		url = utils.GetProposalUrl(req.Repo, p.ID)
+		err = utils.AddToProposal(p, path, content, req.Base, req.Message, user)
+		if errors.Is(err, utils.ErrNotOpen) {
+			return utils.RespError(c, 409, err.Error())
+		}
+	case req.Propose || !utils.CanWrite(req.Repo, user):
+		p, err = utils.CreateProposal(req.Repo, path, content, req.Base, req.Title, req.Message, user)
+		if err == nil {
+			url = utils.GetProposalUrl(req.Repo, p.ID)
+		}
+	default:
+		commit, err = utils.SaveDoc(req.Repo, path, content, req.Base, req.Message, user)
+	}
+	var conflict *utils.ConflictError
+	switch {
+	case errors.As(err, &conflict):
+		return c.JSON(409, model.Response{
+			Code: 409,
+			Msg:  "the document was changed since you started editing",
+			Data: model.SaveResp{Blob: conflict.Blob, URL: url},
+		})
+	case errors.Is(err, utils.ErrNoChanges):
+		return c.JSON(200, model.Response{
+			Code: 200,
+			Msg:  "no changes",
+			Data: model.SaveResp{Blob: req.Base, URL: url},
+		})
+	case err != nil:
+		log.Println("save failed:", req.Repo, path, err)
+		return utils.RespError(c, 500, "save failed")
+	}
+
+	return c.JSON(200, model.Response{
+		Code: 200,
+		Msg:  "success",
+		Data: model.SaveResp{Commit: commit, Blob: utils.BlobHash(content), URL: url},
+	})
+}
+
+// writeAccess is 0 when the user of the request may write to repo, the
+// error status otherwise
+func writeAccess(c echo.Context, repo string) (model.User, int) {
+	user, ok := utils.CurrentUser(c)
+	if !ok {
+		return user, 401
+	}
+	if !utils.CanWrite(repo, user) {
+		return user, 403
+	}
+	return user, 0
+}
+
+// respCommitError answers a failed file operation
+func respCommitError(c echo.Context, err error) error {
+	var conflict *utils.ConflictError
+	switch {
+	case errors.As(err, &conflict):
+		return utils.RespError(c, 409, "the file was changed by someone else")
+	case errors.Is(err, utils.ErrExists):
+		return utils.RespError(c, 409, "a file with that name exists")
+	case errors.Is(err, utils.ErrInvalidPath):
+		return utils.RespError(c, 400, "invalid path")
+	case errors.Is(err, utils.ErrConfigPath):
+		return utils.RespError(c, 403, err.Error())
+	case errors.Is(err, os.ErrNotExist):
+		return utils.RespError(c, 404, "not found")
+	}
+	log.Println("commit failed:", err)
+	return utils.RespError(c, 500, "commit failed")
+}
+
+// NewHandler shows the form for a new document in a directory
+func NewHandler(c echo.Context) error {
+	repo := c.Param("repo")
+	if !utils.CheckRepoExist(repo) {
+		return utils.Resp404(c)
+	}
+	user, code := writeAccess(c, repo)
+	if code != 0 {
+		return c.HTML(code, http.StatusText(code))
+	}
+
+	res, err := utils.RenderNewPage(repo, strings.Trim(c.Param("*"), "/"), user)
+	if err != nil {
+		return utils.Resp500(c, err)
+	}
+	return c.HTML(200, res)
+}
+
+// CreateHandler commits a new markdown document from a template
+func CreateHandler(c echo.Context) error {
+	var req model.CreateReq
+	if err := bindJSON(c, &req); err != nil {
+		return respBindError(c, err)
+	}
+	path, err := utils.WritablePath(req.Path)
+	if errors.Is(err, utils.ErrConfigPath) {
+		return utils.RespError(c, 403, err.Error())
+	}
+	if err != nil || !internal.IsMarkdown(path) {
+		return utils.RespError(c, 400, "new documents need a .md path")
+	}
+	if !utils.CheckRepoExist(req.Repo) {
+		return utils.RespError(c, 404, "not found")
+	}
+	user, code := writeAccess(c, req.Repo)
+	if code != 0 {
+		return utils.RespError(c, code, http.StatusText(code))
+	}
+	if req.Template == "" {
+		req.Template = "blank"
+	}
+
+	commit, err := utils.CreateDoc(req.Repo, path, req.Template, req.Title, user)
+	if err != nil {
+		return respCommitError(c, err)
+	}
+	return c.JSON(200, model.Response{
+		Code: 200,
+		Msg:  "success",
+		Data: model.SaveResp{Commit: commit, URL: utils.GetEditUrl(req.Repo, path)},
+	})
+}
+
+// MoveHandler renames a file and updates the links to it
+func MoveHandler(c echo.Context) error {
+	var req model.MoveReq
+	if err := bindJSON(c, &req); err != nil {
+		return respBindError(c, err)
+	}
+	from, err := utils.WritablePath(req.Path)
+	if err != nil {
+		return respCommitError(c, err)
+	}
+	to, err := utils.WritablePath(req.To)
+	if err != nil {
+		return respCommitError(c, err)
+	}
+	if !utils.CheckRepoExist(req.Repo) {
+		return utils.RespError(c, 404, "not found")
+	}
+	user, code := writeAccess(c, req.Repo)
+	if code != 0 {
+		return utils.RespError(c, code, http.StatusText(code))
+	}
+
+	commit, err := utils.MoveDoc(req.Repo, from, to, req.Base, user)
+	if err != nil {
+		return respCommitError(c, err)
+	}
+	return c.JSON(200, model.Response{
+		Code: 200,
+		Msg:  "success",
+		Data: model.SaveResp{Commit: commit, Blob: req.Base, URL: utils.GetDocUrl(req.Repo, to)},
+	})
+}
+
+// DeleteHandler removes a file, readers are sent to the first document
+func DeleteHandler(c echo.Context) error {
+	var req model.DeleteReq
+	if err := bindJSON(c, &req); err != nil {
+		return respBindError(c, err)
+	}
+	path, err := utils.WritablePath(req.Path)
+	if err != nil {
+		return respCommitError(c, err)
+	}
+	if !utils.CheckRepoExist(req.Repo) {
+		return utils.RespError(c, 404, "not found")
+	}
+	user, code := writeAccess(c, req.Repo)
+	if code != 0 {
+		return utils.RespError(c, code, http.StatusText(code))
+	}
+
+	commit, err := utils.DeleteDoc(req.Repo, path, req.Base, user)
+	if err != nil {
+		return respCommitError(c, err)
+	}
+	url := "/"
+	if order := utils.SidebarOrder(req.Repo); len(order) > 0 {
+		url = utils.GetDocUrl(req.Repo, order[0])
+	}
+	return c.JSON(200, model.Response{
+		Code: 200,
+		Msg:  "success",
+		Data: model.SaveResp{Commit: commit, URL: url},
+	})
+}
+
+// UploadHandler commits an image into the asset directory, the form has
+// the repo, the document it is for and the file
+func UploadHandler(c echo.Context) error {
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, utils.UploadSizeLimit+1<<20)
+	repo := c.FormValue("repo")
+	if !utils.CheckRepoExist(repo) {
+		return utils.RespError(c, 404, "not found")
+	}
+	user, code := writeAccess(c, repo)
+	if code != 0 {
+		return utils.RespError(c, code, http.StatusText(code))
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return utils.RespError(c, 400, "no file")
+	}
+	if header.Size > utils.UploadSizeLimit {
+		return utils.RespError(c, 413, "file is too large")
+	}
+	if !strings.HasPrefix(utils.AssetType(header.Filename, nil), "image/") {
+		return utils.RespError(c, 400, "only images can be uploaded")
+	}
+	file, err := header.Open()
+	if err != nil {
+		return utils.RespError(c, 400, "no file")
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return utils.RespError(c, 400, "no file")
+	}
+
+	path, err := utils.UploadAsset(repo, header.Filename, data, user)
+	if err != nil {
+		return respCommitError(c, err)
+	}
+	link := "/" + path
+	if doc, err := utils.CleanPath(c.FormValue("doc")); err == nil {
+		link = utils.RelativeUrl(doc, path)
+	}
+	return c.JSON(200, model.Response{
+		Code: 200,
+		Msg:  "success",
+		Data: model.UploadResp{Path: path, URL: link},
+	})
+}
@@ -1,12 +1,16 @@
 package logic
 
 import (
-	"encoding/json"
+	"bytes"
+	"errors"
 	"fmt"
 	"log"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/labstack/echo/v4"
+	"github.com/scnon/md-doc/internal"
 	"github.com/scnon/md-doc/model"
 	"github.com/scnon/md-doc/utils"
 )
@@ -19,10 +23,13 @@ func DocHandler(c echo.Context) error {
 	repo := c.Param("repo")
 	path := c.Param("*")
 	log.Println(repo, path)
-	if strings.HasSuffix(path, ".png") || strings.HasSuffix(path, ".webp") ||
-		strings.HasSuffix(path, ".jpg") || strings.HasSuffix(path, ".jpeg") {
-		file := fmt.Sprint(utils.GetGitPath(repo), path)
-		return c.File(file)
+	// relative links from documents to images and media land here
+	if !utils.IsDocFile(path) && utils.IsMediaFile(path) {
+		return utils.ServeAsset(c, repo, path)
+	}
+
+	if ref := c.QueryParam("ref"); ref != "" {
+		return refDocHandler(c, repo, path, ref)
 	}
 
 	out, err := utils.GetFile(repo, path)
@@ -31,47 +38,195 @@ func DocHandler(c echo.Context) error {
 	}
 
 	author, created, updated := utils.GetFileInfo(repo, path)
-	res, err := utils.ReaderDoc(repo, path, author, created, updated, out)
+	page := utils.ServerPage(repo, author, created, updated)
+	if user, ok := utils.CurrentUser(c); ok {
+		page.User = user.Name
+		if utils.EditableDoc(path, out) {
+			page.EditUrl = utils.GetEditUrl(repo, path)
+			page.Propose = !utils.CanWrite(repo, user)
+		}
+	}
+	res, err := utils.RenderPage(repo, path, out, page)
 	if err != nil {
 		return utils.Resp500(c, err)
 	}
 
-	return c.HTML(200, res)
+	return utils.RespCached(c, res, utils.GetFileModTime(repo, path))
+}
+
+// refDocHandler shows a document as it is at a branch, tag or commit,
+// read only
+func refDocHandler(c echo.Context, repo, path, ref string) error {
+	out, commit, _, err := utils.ReadRefFile(repo, ref, path)
+	if err != nil {
+		return utils.Resp404(c)
+	}
+	created, updated, err := utils.FileHistory(repo, commit, path)
+	if err != nil || updated == nil {
+		return utils.Resp500(c, err)
+	}
+
+	page := utils.ServerPage(repo, updated.Author.Name, created.Date.Local().Format(utils.InfoTimeFormat),
+		updated.Date.Local().Format(utils.InfoTimeFormat))
+	page.Ref, page.Commit = ref, commit
+	page.Comments = false
+	res, err := utils.RenderPage(repo, path, out, page)
+	if err != nil {
+		return utils.Resp500(c, err)
+	}
+	return utils.RespCached(c, res, updated.Date)
+}
+
+func AssetHandler(c echo.Context) error {
+	return utils.ServeAsset(c, c.Param("repo"), c.Param("*"))
+}
+
+// RawHandler serves a file of a repo as plain text or as a download
+func RawHandler(c echo.Context) error {
+	repo := c.Param("repo")
+	path := c.Param("*")
+
+	out, err := utils.GetFile(repo, path)
+	if err != nil {
+		return utils.Resp404(c)
+	}
+
+	header := c.Response().Header()
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	if c.QueryParam("download") != "" {
+		header.Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filepath.Base(path)))
+		return c.Blob(200, echo.MIMEOctetStream, out)
+	}
+	return c.Blob(200, echo.MIMETextPlainCharsetUTF8, out)
+}
+
+// ExportHandler sends /export/:repo/<doc or dir>.pdf or .epub, book.pdf
+// and book.epub are the whole repo
+func ExportHandler(c echo.Context) error {
+	repo := c.Param("repo")
+	path := c.Param("*")
+	if !utils.CheckRepoExist(repo) {
+		return utils.Resp404(c)
+	}
+
+	switch filepath.Ext(path) {
+	case ".pdf":
+		target := strings.TrimSuffix(path, ".pdf")
+		if target == "book" {
+			target = ""
+		}
+		var buf bytes.Buffer
+		if err := utils.ExportPDF(&buf, repo, target); err != nil {
+			return utils.Resp404(c)
+		}
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("inline; filename=%q", filepath.Base(path)))
+		return c.Blob(200, "application/pdf", buf.Bytes())
+	case ".epub":
+		target := strings.TrimSuffix(path, ".epub")
+		if target == "book" {
+			target = ""
+		}
+		var buf bytes.Buffer
+		if err := utils.ExportEPUB(&buf, repo, target); err != nil {
+			return utils.Resp404(c)
+		}
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filepath.Base(path)))
+		return c.Blob(200, "application/epub+zip", buf.Bytes())
+	}
+	return utils.Resp404(c)
 }
 
+func ChromaCSSHandler(c echo.Context) error {
+	name := strings.TrimSuffix(c.Param("style"), ".css")
+	if !internal.HasStyle(name) {
+		return utils.Resp404(c)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, "text/css; charset=utf-8")
+	c.Response().Header().Set(echo.HeaderCacheControl, "public, max-age=86400")
+	c.Response().WriteHeader(200)
+	return internal.WriteChromaCSS(c.Response(), name)
+}
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// SearchHander searches the documents of a repo, or of all repos the
+// user can read without one, answering the search popup with html when
+// format is html
 func SearchHander(c echo.Context) error {
 	var req model.SearchReq
-	err := json.NewDecoder(c.Request().Body).Decode(&req)
+	if err := bindJSON(c, &req); err != nil {
+		return respBindError(c, err)
+	}
+	if f := c.QueryParam("format"); f != "" {
+		req.Format = f
+	}
+	if req.Format != "" && req.Format != "json" && req.Format != "html" {
+		return utils.RespError(c, 400, "format must be json or html")
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultSearchLimit
+	}
+	if req.Offset < 0 || req.Limit < 0 || req.Limit > maxSearchLimit {
+		return utils.RespError(c, 400, "invalid offset or limit")
+	}
+	user, _ := utils.CurrentUser(c)
+	if req.Repo != "" && (!utils.CheckRepoExist(req.Repo) || !utils.CanRead(req.Repo, user)) {
+		return utils.RespError(c, 404, "repo not found")
+	}
+
+	res, err := utils.Search(req, user)
+	if errors.Is(err, utils.ErrRefNotIndexed) {
+		return utils.RespError(c, 404, err.Error())
+	}
 	if err != nil {
-		return utils.Resp500(c, err)
+		log.Println("search failed:", req.Repo, err)
+		return utils.RespError(c, 500, "search failed")
+	}
+	if req.Format == "html" {
+		return c.JSON(200, model.Response{Code: 200, Msg: "success", Data: utils.RenderSearchItems(res, req.Repo == "")})
+	}
+	return c.JSON(200, model.Response{Code: 200, Msg: "success", Data: res})
+}
+
+// SearchPageHandler shows the results of ?q= in all repos the user can
+// read, or in ?repo=
+func SearchPageHandler(c echo.Context) error {
+	req := model.SearchReq{
+		Key:    c.QueryParam("q"),
+		Repo:   c.QueryParam("repo"),
+		Ref:    c.QueryParam("ref"),
+		Path:   c.QueryParam("path"),
+		Tag:    c.QueryParam("tag"),
+		Author: c.QueryParam("author"),
+		Limit:  defaultSearchLimit,
+	}
+	if s := c.QueryParam("offset"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return c.HTML(400, "400 Bad Request")
+		}
+		req.Offset = n
+	}
+	user, _ := utils.CurrentUser(c)
+	if req.Repo != "" && (!utils.CheckRepoExist(req.Repo) || !utils.CanRead(req.Repo, user)) {
+		return utils.Resp404(c)
 	}
 
-	res := utils.RenderSearchItem([]model.SearchItem{
-		{
-			Title:   req.Key,
-			Content: req.Key,
-			Class:   "search_item",
-		},
-		{
-			Title:   req.Key,
-			Content: req.Key,
-			Class:   "search_item",
-		},
-		{
-			Title:   req.Key,
-			Content: req.Key,
-			Class:   "search_item",
-		},
-		{
-			Title:   req.Key,
-			Content: req.Key,
-			Class:   "search_item_last",
-		},
-	})
-
-	return c.JSON(200, model.Response{
-		Code: 200,
-		Msg:  "success",
-		Data: res,
-	})
+	res, err := utils.Search(req, user)
+	if errors.Is(err, utils.ErrRefNotIndexed) {
+		return utils.Resp404(c)
+	}
+	if err != nil {
+		return utils.Resp500(c, err)
+	}
+	page, err := utils.RenderSearchPage(req, res)
+	if err != nil {
+		return utils.Resp500(c, err)
+	}
+	return c.HTML(200, page)
 }
@@ -0,0 +1,21 @@
+package logic
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/scnon/md-doc/utils"
+)
+
+// the database is opened once, the tests share one in a temporary dir
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "md-doc-test")
+	if err != nil {
+		panic(err)
+	}
+	utils.DBPath = filepath.Join(dir, "md-doc.db")
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -0,0 +1,146 @@
+package logic
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/scnon/md-doc/model"
+	"github.com/scnon/md-doc/utils"
+)
+
+func getProposal(repo, id string) (*model.Proposal, error) {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return utils.GetProposal(repo, n)
+}
+
+// ProposalsHandler lists the proposals of a repo
+func ProposalsHandler(c echo.Context) error {
+	repo := c.Param("repo")
+	if !utils.CheckRepoExist(repo) {
+		return utils.Resp404(c)
+	}
+	proposals, err := utils.ListProposals(repo)
+	if err != nil {
+		return utils.Resp500(c, err)
+	}
+	res, err := utils.RenderProposalsPage(repo, proposals)
+	if err != nil {
+		return utils.Resp500(c, err)
+	}
+	return c.HTML(200, res)
+}
+
+// ProposalHandler shows a proposal with the diff of its changes
+func ProposalHandler(c echo.Context) error {
+	repo := c.Param("repo")
+	if !utils.CheckRepoExist(repo) {
+		return utils.Resp404(c)
+	}
+	p, err := getProposal(repo, c.Param("id"))
+	if err != nil {
+		return utils.Resp404(c)
+	}
+	user, ok := utils.CurrentUser(c)
+	res, err := utils.RenderProposalPage(p, user, ok)
+	if err != nil {
+		return utils.Resp500(c, err)
+	}
+	return c.HTML(200, res)
+}
+
+// proposalRequest decodes a request on a proposal of a signed in user
+func proposalRequest(c echo.Context) (*model.Proposal, model.ProposalReq, model.User, error) {
+	var req model.ProposalReq
+	if err := bindJSON(c, &req); err != nil {
+		return nil, req, model.User{}, respBindError(c, err)
+	}
+	user, ok := utils.CurrentUser(c)
+	if !ok {
+		return nil, req, user, utils.RespError(c, 401, "sign in first")
+	}
+	p, err := utils.GetProposal(req.Repo, req.ID)
+	if err != nil || !utils.CanRead(req.Repo, user) {
+		return nil, req, user, utils.RespError(c, 404, "not found")
+	}
+	return p, req, user, nil
+}
+
+// respProposal answers a proposal request with the proposal url
+func respProposal(c echo.Context, p *model.Proposal, err error) error {
+	var conflict *utils.MergeConflictError
+	switch {
+	case err == nil:
+		return c.JSON(200, model.Response{
+			Code: 200,
+			Msg:  "success",
+			Data: model.SaveResp{Commit: p.Merged, URL: utils.GetProposalUrl(p.Repo, p.ID)},
+		})
+	case errors.As(err, &conflict):
+		return utils.RespError(c, 409, conflict.Error())
+	case errors.Is(err, utils.ErrNotOpen), errors.Is(err, utils.ErrNotApproved):
+		return utils.RespError(c, 409, err.Error())
+	case errors.Is(err, utils.ErrSelfApprove):
+		return utils.RespError(c, 403, err.Error())
+	}
+	return respCommitError(c, err)
+}
+
+// CommentProposalHandler adds a comment to a proposal
+func CommentProposalHandler(c echo.Context) error {
+	p, req, user, err := proposalRequest(c)
+	if p == nil {
+		return err
+	}
+	body := strings.TrimSpace(req.Body)
+	if body == "" {
+		return utils.RespError(c, 400, "empty comment")
+	}
+	if err := utils.CommentProposal(p, body, user); err != nil {
+		log.Println("comment failed:", p.Repo, p.ID, err)
+		return utils.RespError(c, 500, "comment failed")
+	}
+	return respProposal(c, p, nil)
+}
+
+// ApproveProposalHandler approves the current changes of a proposal
+func ApproveProposalHandler(c echo.Context) error {
+	p, _, user, err := proposalRequest(c)
+	if p == nil {
+		return err
+	}
+	if !utils.CanWrite(p.Repo, user) {
+		return utils.RespError(c, 403, "only writers can approve")
+	}
+	return respProposal(c, p, utils.ApproveProposal(p, user))
+}
+
+// MergeProposalHandler merges an approved proposal
+func MergeProposalHandler(c echo.Context) error {
+	p, _, user, err := proposalRequest(c)
+	if p == nil {
+		return err
+	}
+	if !utils.CanWrite(p.Repo, user) {
+		return utils.RespError(c, 403, "only writers can merge")
+	}
+	_, err = utils.MergeProposal(p, user)
+	return respProposal(c, p, err)
+}
+
+// CloseProposalHandler closes a proposal without merging it
+func CloseProposalHandler(c echo.Context) error {
+	p, _, user, err := proposalRequest(c)
+	if p == nil {
+		return err
+	}
+	if !utils.CanChangeProposal(p, user) {
+		return utils.RespError(c, 403, "you can't close this proposal")
+	}
+	return respProposal(c, p, utils.CloseProposal(p))
+}
@@ -0,0 +1,76 @@
+package model
+
+import "time"
+
+// Page describes a slice of a listing, More is set when entries follow
+// the slice
+type Page struct {
+	Offset int  `json:"offset"`
+	Limit  int  `json:"limit"`
+	More   bool `json:"more"`
+}
+
+// TreeEntry is a file or directory of a repo tree
+type TreeEntry struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// Type is file, dir or submodule
+	Type string `json:"type"`
+	Size int64  `json:"size"`
+	// Hash is the blob or tree hash
+	Hash string `json:"hash"`
+	// Doc is set for files md-doc renders
+	Doc bool `json:"doc"`
+}
+
+type Tree struct {
+	Repo    string      `json:"repo"`
+	Ref     string      `json:"ref"`
+	Commit  string      `json:"commit"`
+	Path    string      `json:"path"`
+	Entries []TreeEntry `json:"entries"`
+	Page
+}
+
+type CommitInfo struct {
+	Hash      string    `json:"hash"`
+	Subject   string    `json:"subject"`
+	Message   string    `json:"message"`
+	Author    User      `json:"author"`
+	Date      time.Time `json:"date"`
+	Committer User      `json:"committer"`
+	Parents   []string  `json:"parents"`
+}
+
+type CommitList struct {
+	Repo    string       `json:"repo"`
+	Ref     string       `json:"ref"`
+	Path    string       `json:"path"`
+	Commits []CommitInfo `json:"commits"`
+	Page
+}
+
+type Heading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+	ID    string `json:"id"`
+}
+
+// Doc is a document at a ref with its rendering and history
+type Doc struct {
+	Repo   string `json:"repo"`
+	Path   string `json:"path"`
+	Ref    string `json:"ref"`
+	Commit string `json:"commit"`
+	Blob   string `json:"blob"`
+	Title  string `json:"title"`
+	// Raw is the source, FrontMatter is cut from it before rendering
+	Raw         string                 `json:"raw"`
+	HTML        string                 `json:"html"`
+	FrontMatter map[string]interface{} `json:"front_matter"`
+	Headings    []Heading              `json:"headings"`
+	// Created is the commit that added the document, Updated the last one
+	// that changed it
+	Created *CommitInfo `json:"created"`
+	Updated *CommitInfo `json:"updated"`
+}
@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+// Comment is a remark on a document. A thread starts with a comment on a
+// heading or a quoted passage, its replies name it as Parent.
+type Comment struct {
+	ID     int64  `json:"id"`
+	Repo   string `json:"repo"`
+	Path   string `json:"path"`
+	Parent int64  `json:"parent"`
+	Author User   `json:"author"`
+	Body   string `json:"body"`
+	// Heading is the id of the heading a thread is on, Quote its text
+	Heading string `json:"heading"`
+	Quote   string `json:"quote"`
+	Prefix  string `json:"prefix"`
+	Suffix  string `json:"suffix"`
+	// Blob is the version of the document the anchor was found in
+	Blob string `json:"blob"`
+	// Outdated threads lost their passage in an edit
+	Outdated bool      `json:"outdated"`
+	Resolved bool      `json:"resolved"`
+	Mentions []string  `json:"mentions"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+	Replies  []Comment `json:"replies,omitempty"`
+}
+
+// CommentReq adds a comment, a reply when Parent is set, or resolves the
+// thread ID
+type CommentReq struct {
+	Repo     string `json:"repo"`
+	Path     string `json:"path"`
+	Parent   int64  `json:"parent"`
+	Body     string `json:"body"`
+	Heading  string `json:"heading"`
+	Quote    string `json:"quote"`
+	Prefix   string `json:"prefix"`
+	Suffix   string `json:"suffix"`
+	ID       int64  `json:"id"`
+	Resolved bool   `json:"resolved"`
+}
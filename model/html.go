@@ -1,7 +1,53 @@
 package model
 
+import (
+	"html/template"
+	"time"
+)
+
 type SearchItem struct {
-	Title   string `json:"title"`
-	Content string `json:"content"`
-	Class   string `json:"class"`
+	Title   string        `json:"title"`
+	Heading string        `json:"heading"`
+	URL     string        `json:"url"`
+	Content template.HTML `json:"content"`
+	Class   string        `json:"class"`
+}
+
+// Span is a range of characters, unicode code points, of a text
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// SearchResult is a document matching a search. Anchor is the id of the
+// heading of the best matching section, Highlights are the matches in
+// Snippet.
+type SearchResult struct {
+	Repo       string    `json:"repo"`
+	Ref        string    `json:"ref"`
+	Path       string    `json:"path"`
+	Title      string    `json:"title"`
+	Heading    string    `json:"heading"`
+	Anchor     string    `json:"anchor"`
+	URL        string    `json:"url"`
+	Snippet    string    `json:"snippet"`
+	Highlights []Span    `json:"highlights"`
+	Score      float64   `json:"score"`
+	Updated    time.Time `json:"updated"`
+}
+
+// SearchRepo counts the results in a repo
+type SearchRepo struct {
+	Repo  string `json:"repo"`
+	Total int    `json:"total"`
+}
+
+// SearchResults is a page of the results of a search, Repos are the repos
+// with results, best first
+type SearchResults struct {
+	Key     string         `json:"key"`
+	Total   int            `json:"total"`
+	Results []SearchResult `json:"results"`
+	Repos   []SearchRepo   `json:"repos"`
+	Page
 }
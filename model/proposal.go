@@ -0,0 +1,47 @@
+package model
+
+import "time"
+
+const (
+	ProposalOpen   = "open"
+	ProposalMerged = "merged"
+	ProposalClosed = "closed"
+)
+
+// Proposal is a change made on its own branch, waiting for review before
+// it is merged into Target
+type Proposal struct {
+	ID          int64     `json:"id"`
+	Repo        string    `json:"repo"`
+	Branch      string    `json:"branch"`
+	Target      string    `json:"target"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Author      User      `json:"author"`
+	Status      string    `json:"status"`
+	Created     time.Time `json:"created"`
+	Updated     time.Time `json:"updated"`
+	// Merged is the commit that merged the proposal
+	Merged string `json:"merged"`
+}
+
+type ProposalComment struct {
+	ID      int64     `json:"id"`
+	Author  User      `json:"author"`
+	Body    string    `json:"body"`
+	Created time.Time `json:"created"`
+}
+
+// Approval is given to the proposal as it was at Commit
+type Approval struct {
+	User    User      `json:"user"`
+	Commit  string    `json:"commit"`
+	Created time.Time `json:"created"`
+}
+
+// ProposalReq names a proposal, Body is the text of a comment
+type ProposalReq struct {
+	Repo string `json:"repo"`
+	ID   int64  `json:"id"`
+	Body string `json:"body"`
+}
@@ -6,6 +6,72 @@ type Response struct {
 	Data interface{} `json:"data"`
 }
 
+// SearchReq searches the documents for the words of Key at Ref, the
+// default branch when it is empty. Path is a prefix of the paths
+// searched, Tag and Author filter by front matter tag and by anyone who
+// changed a document.
 type SearchReq struct {
-	Key string `json:"key"`
+	Key    string `json:"key"`
+	Repo   string `json:"repo"`
+	Ref    string `json:"ref"`
+	Path   string `json:"path"`
+	Tag    string `json:"tag"`
+	Author string `json:"author"`
+	Offset int    `json:"offset"`
+	Limit  int    `json:"limit"`
+	// Format html renders the results for the search popup
+	Format string `json:"format"`
+}
+
+type RenderReq struct {
+	Repo    string `json:"repo"`
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// SaveReq commits the new content of a document, Base is the blob hash
+// the edit started from. Propose starts a proposal named Title instead,
+// Proposal adds the edit to an open one.
+type SaveReq struct {
+	Repo     string `json:"repo"`
+	Path     string `json:"path"`
+	Content  string `json:"content"`
+	Base     string `json:"base"`
+	Message  string `json:"message"`
+	Propose  bool   `json:"propose"`
+	Title    string `json:"title"`
+	Proposal int64  `json:"proposal"`
+}
+
+type SaveResp struct {
+	Commit string `json:"commit"`
+	Blob   string `json:"blob"`
+	URL    string `json:"url"`
+}
+
+// CreateReq adds a document from a template
+type CreateReq struct {
+	Repo     string `json:"repo"`
+	Path     string `json:"path"`
+	Template string `json:"template"`
+	Title    string `json:"title"`
+}
+
+// MoveReq renames the document Path with blob Base to To
+type MoveReq struct {
+	Repo string `json:"repo"`
+	Path string `json:"path"`
+	To   string `json:"to"`
+	Base string `json:"base"`
+}
+
+type DeleteReq struct {
+	Repo string `json:"repo"`
+	Path string `json:"path"`
+	Base string `json:"base"`
+}
+
+type UploadResp struct {
+	Path string `json:"path"`
+	URL  string `json:"url"`
 }
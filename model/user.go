@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// User is who a request is made by, as named by the authenticating proxy
+type User struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// Account is a user that signed in before
+type Account struct {
+	User
+	Created  time.Time `json:"created"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// Token lets a user call the api without the proxy, only the hash of its
+// secret is kept
+type Token struct {
+	ID       int64     `json:"id"`
+	User     string    `json:"user"`
+	Name     string    `json:"name"`
+	Hash     string    `json:"-"`
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"last_used"`
+}
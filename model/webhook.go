@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// Webhook is a url notified of Events of a repo, signed with Secret
+type Webhook struct {
+	ID      int64     `json:"id"`
+	Repo    string    `json:"repo"`
+	URL     string    `json:"url"`
+	Secret  string    `json:"-"`
+	Events  []string  `json:"events"`
+	Active  bool      `json:"active"`
+	Created time.Time `json:"created"`
+}
@@ -0,0 +1,304 @@
+// comment threads on a document: quotes are matched in the collapsed text
+// of the document, like the server does when it re-attaches them
+
+var commentContext = 32;
+
+function collapseSpace(text) {
+    return text.replace(/\s+/g, " ").trim();
+}
+
+// textIndex is the collapsed text of root and the text node position of
+// each of its characters
+function textIndex(root) {
+    var walker = document.createTreeWalker(root, NodeFilter.SHOW_TEXT, {
+        acceptNode: (node) => node.parentElement.closest("script, style, .comment_add") ? NodeFilter.FILTER_REJECT : NodeFilter.FILTER_ACCEPT,
+    });
+    var text = "";
+    var pos = [];
+    var space = true;
+    var node;
+    while ((node = walker.nextNode()) !== null) {
+        for (var i = 0; i < node.data.length; i++) {
+            if (/\s/.test(node.data[i])) {
+                if (!space) {
+                    text += " ";
+                    pos.push([node, i]);
+                }
+                space = true;
+            } else {
+                text += node.data[i];
+                pos.push([node, i]);
+                space = false;
+            }
+        }
+    }
+    if (text.endsWith(" ")) {
+        text = text.slice(0, -1);
+        pos.pop();
+    }
+    return { text: text, pos: pos };
+}
+
+// markQuote wraps the passage of a thread in marks, preferring the
+// occurrence after its prefix
+function markQuote(root, thread) {
+    var index = textIndex(root);
+    var at = -1;
+    for (var i = index.text.indexOf(thread.quote); i >= 0; i = index.text.indexOf(thread.quote, i + 1)) {
+        if (at < 0) {
+            at = i;
+        }
+        if (collapseSpace(index.text.slice(0, i)).endsWith(thread.prefix)) {
+            at = i;
+            break;
+        }
+    }
+    if (at < 0) {
+        return;
+    }
+
+    // each text node is split once, from its first to its last character
+    var spans = new Map();
+    for (var k = at; k < at + thread.quote.length; k++) {
+        var [node, offset] = index.pos[k];
+        var span = spans.get(node) || [offset, offset];
+        span[1] = offset;
+        spans.set(node, span);
+    }
+    spans.forEach(([from, to], node) => {
+        var mid = node.splitText(from);
+        mid.splitText(to - from + 1);
+        var mark = document.createElement("mark");
+        mark.className = "comment_mark";
+        mark.dataset.thread = thread.id;
+        mid.parentNode.replaceChild(mark, mid);
+        mark.appendChild(mid);
+    });
+}
+
+function clearMarks(root) {
+    root.querySelectorAll("mark.comment_mark").forEach((mark) => {
+        mark.replaceWith(...mark.childNodes);
+    });
+    root.querySelectorAll(".comment_heading").forEach((h) => h.classList.remove("comment_heading"));
+    root.normalize();
+}
+
+function commentBody(text) {
+    var body = document.createElement("div");
+    body.className = "comment_body";
+    text.split(/(@\w(?:[\w.-]*\w)?)/).forEach((part, i) => {
+        if (i % 2 === 1) {
+            var mention = document.createElement("span");
+            mention.className = "comment_mention";
+            mention.textContent = part;
+            body.appendChild(mention);
+        } else {
+            body.appendChild(document.createTextNode(part));
+        }
+    });
+    return body;
+}
+
+function commentElement(comment) {
+    var div = document.createElement("div");
+    div.className = "comment";
+    var meta = document.createElement("div");
+    meta.className = "comment_meta";
+    meta.textContent = comment.author.name + ", " + new Date(comment.created).toLocaleString();
+    div.appendChild(meta);
+    div.appendChild(commentBody(comment.body));
+    return div;
+}
+
+function commentForm(placeholder, send) {
+    var form = document.createElement("form");
+    form.className = "comment_form";
+    var input = document.createElement("textarea");
+    input.placeholder = placeholder;
+    var button = document.createElement("button");
+    button.type = "submit";
+    button.textContent = "Comment";
+    form.append(input, button);
+    form.addEventListener("submit", (e) => {
+        e.preventDefault();
+        if (input.value.trim() !== "") {
+            send(input.value);
+        }
+    });
+    return form;
+}
+
+function postComment(url, body) {
+    $.ajax({
+        type: "POST",
+        url: url,
+        data: JSON.stringify(body),
+        dataType: "json",
+        contentType: "application/json",
+        success: loadComments,
+        error: function (xhr) {
+            alert(xhr.responseJSON ? xhr.responseJSON.msg : xhr.statusText);
+        },
+    });
+}
+
+function threadElement(pane, thread) {
+    var div = document.createElement("div");
+    div.className = "comment_thread";
+    div.id = "thread-" + thread.id;
+    div.classList.toggle("resolved", thread.resolved);
+
+    var quote = document.createElement("blockquote");
+    quote.textContent = thread.quote;
+    if (thread.outdated) {
+        quote.title = "The passage changed since";
+        quote.classList.add("outdated");
+    }
+    quote.addEventListener("click", () => {
+        var target = thread.heading ? document.getElementById(thread.heading) :
+            document.querySelector('mark.comment_mark[data-thread="' + thread.id + '"]');
+        if (target !== null) {
+            target.scrollIntoView({ behavior: "smooth", block: "center" });
+        }
+    });
+    div.appendChild(quote);
+
+    div.appendChild(commentElement(thread));
+    (thread.replies || []).forEach((reply) => div.appendChild(commentElement(reply)));
+
+    if (pane.dataset.user !== "") {
+        div.appendChild(commentForm("Reply", (text) => postComment("/api/comment", {
+            "repo": pane.dataset.repo,
+            "path": pane.dataset.path,
+            "parent": thread.id,
+            "body": text,
+        })));
+        var resolve = document.createElement("button");
+        resolve.textContent = thread.resolved ? "Reopen" : "Resolve";
+        resolve.addEventListener("click", () => postComment("/api/comment/resolve", {
+            "repo": pane.dataset.repo,
+            "id": thread.id,
+            "resolved": !thread.resolved,
+        }));
+        div.appendChild(resolve);
+    }
+    return div;
+}
+
+function loadComments() {
+    var pane = document.getElementById("comments");
+    var doc = document.querySelector(".markdown-body");
+    $.getJSON("/api/comments/" + pane.dataset.repo + "/" + pane.dataset.path, (data) => {
+        var list = document.getElementById("comment_threads");
+        list.innerHTML = "";
+        var draft = document.getElementById("comment_new");
+        if (draft !== null) {
+            draft.remove();
+        }
+        clearMarks(doc);
+        (data.data || []).forEach((thread) => {
+            list.appendChild(threadElement(pane, thread));
+            if (thread.resolved || thread.outdated) {
+                return;
+            }
+            if (thread.heading) {
+                var heading = document.getElementById(thread.heading);
+                if (heading !== null) {
+                    heading.classList.add("comment_heading");
+                }
+            } else {
+                markQuote(doc, thread);
+            }
+        });
+    });
+}
+
+// newThread asks for the first comment on a heading or a quote
+function newThread(anchor) {
+    var pane = document.getElementById("comments");
+    var old = document.getElementById("comment_new");
+    if (old !== null) {
+        old.remove();
+    }
+    var div = document.createElement("div");
+    div.className = "comment_thread";
+    div.id = "comment_new";
+    var quote = document.createElement("blockquote");
+    quote.textContent = anchor.quote;
+    div.appendChild(quote);
+    div.appendChild(commentForm("Comment on this", (text) => postComment("/api/comment", Object.assign({
+        "repo": pane.dataset.repo,
+        "path": pane.dataset.path,
+        "body": text,
+    }, anchor))));
+    pane.insertBefore(div, document.getElementById("comment_threads"));
+    div.querySelector("textarea").focus();
+}
+
+function selectionAnchor(root) {
+    var selection = window.getSelection();
+    if (selection.rangeCount === 0 || selection.isCollapsed) {
+        return null;
+    }
+    var range = selection.getRangeAt(0);
+    if (!root.contains(range.commonAncestorContainer)) {
+        return null;
+    }
+    var before = document.createRange();
+    before.setStart(root, 0);
+    before.setEnd(range.startContainer, range.startOffset);
+    var after = document.createRange();
+    after.setStart(range.endContainer, range.endOffset);
+    after.setEnd(root, root.childNodes.length);
+    return {
+        "quote": collapseSpace(range.toString()),
+        "prefix": collapseSpace(before.toString()).slice(-commentContext),
+        "suffix": collapseSpace(after.toString()).slice(0, commentContext),
+    };
+}
+
+document.addEventListener('DOMContentLoaded', () => {
+    var pane = document.getElementById("comments");
+    var doc = document.querySelector(".markdown-body");
+    if (pane === null || doc === null) {
+        return;
+    }
+    loadComments();
+    if (pane.dataset.user === "") {
+        return;
+    }
+
+    doc.querySelectorAll("h1[id], h2[id], h3[id], h4[id], h5[id], h6[id]").forEach((h) => {
+        var text = collapseSpace(h.textContent);
+        var button = document.createElement("button");
+        button.className = "comment_add";
+        button.textContent = "+";
+        button.title = "Comment on this section";
+        button.addEventListener("click", () => newThread({ "heading": h.id, "quote": text }));
+        h.appendChild(button);
+    });
+
+    var popup = document.createElement("button");
+    popup.className = "comment_popup";
+    popup.textContent = "Comment";
+    popup.hidden = true;
+    document.body.appendChild(popup);
+    var anchor = null;
+    popup.addEventListener("mousedown", (e) => {
+        e.preventDefault();
+        popup.hidden = true;
+        newThread(anchor);
+    });
+    document.addEventListener("mouseup", (e) => {
+        if (e.target === popup) {
+            return;
+        }
+        anchor = selectionAnchor(doc);
+        popup.hidden = anchor === null || anchor.quote === "";
+        if (!popup.hidden) {
+            popup.style.left = e.pageX + "px";
+            popup.style.top = (e.pageY + 12) + "px";
+        }
+    });
+})
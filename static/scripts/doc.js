@@ -25,16 +25,63 @@ document.addEventListener('keydown', (e) => {
     }
 })
 
+var searchIndex = null;
+
+function escapeHTML(text) {
+    var div = document.createElement("div");
+    div.textContent = text;
+    return div.innerHTML;
+}
+
+// static exports search the prebuilt index instead of the server
+function searchStatic(input, results) {
+    if (searchIndex === null) {
+        fetch(document.body.dataset.searchIndex)
+            .then((resp) => resp.json())
+            .then((data) => { searchIndex = data; searchStatic(input, results); });
+        return;
+    }
+
+    var key = input.toLowerCase();
+    var html = "";
+    searchIndex.filter((doc) => key !== "" &&
+        (doc.title.toLowerCase().includes(key) || doc.text.toLowerCase().includes(key)))
+        .slice(0, 20)
+        .forEach((doc) => {
+            var at = doc.text.toLowerCase().indexOf(key);
+            var snippet = doc.text.substring(Math.max(0, at - 40), at + 80);
+            html += '<div class="search_item"><a href="' + document.body.dataset.base + escapeHTML(doc.path) + '">' +
+                '<div class="search_item_title">' + escapeHTML(doc.title) + '</div>' +
+                '<div class="search_item_content">' + escapeHTML(snippet) + '</div></a></div>';
+        });
+    results.innerHTML = html;
+}
+
+// enter opens the full results of all repos
+document.addEventListener('keydown', (e) => {
+    if (e.target.id !== "search_input" || e.key !== "Enter" || document.body.dataset.searchIndex !== undefined) {
+        return;
+    }
+    window.location.href = "/search?q=" + encodeURIComponent(e.target.value);
+})
+
 document.addEventListener('input', (e) => {
+    if (e.target.id !== "search_input") {
+        return;
+    }
     var input = document.getElementById("search_input").value;
     results = document.getElementById("search_result");
+    if (document.body.dataset.searchIndex !== undefined) {
+        searchStatic(input, results);
+        return;
+    }
 
     $.ajax({
         type: "POST",
         url: "/api/doc/search",
-        data: JSON.stringify({ "key": input }),
+        data: JSON.stringify({ "key": input, "format": "html" }),
         dataType: "json",
-        contentType: "text/plain",
+        contentType: "application/json",
         success: function (data, status) {
             console.log(data, status)
             if (data.code === 200 && data.data !== null && data.data !== undefined) {
@@ -42,4 +89,148 @@ document.addEventListener('input', (e) => {
             }
         }
     })
-})
\ No newline at end of file
+})
+function copyCode(pre, button) {
+    var lines = pre.querySelectorAll(".cl");
+    var text = "";
+    if (lines.length > 0) {
+        lines.forEach((line) => { text += line.textContent; });
+    } else {
+        text = pre.textContent;
+    }
+
+    navigator.clipboard.writeText(text).then(() => {
+        button.textContent = "Copied";
+        setTimeout(() => { button.textContent = "Copy"; }, 1500);
+    });
+}
+
+document.addEventListener('DOMContentLoaded', () => {
+    document.querySelectorAll(".markdown-body pre.chroma").forEach((pre) => {
+        var button = document.createElement("button");
+        button.className = "copy_button";
+        button.textContent = "Copy";
+        button.addEventListener("click", () => copyCode(pre, button));
+        pre.classList.add("has_copy");
+        pre.appendChild(button);
+    });
+})
+
+function highlightLines() {
+    document.querySelectorAll(".source-view .line.hl").forEach((line) => line.classList.remove("hl"));
+    var m = /^#L(\d+)(?:-L(\d+))?$/.exec(location.hash);
+    if (m === null) {
+        return;
+    }
+
+    var from = parseInt(m[1]), to = parseInt(m[2] || m[1]);
+    if (from > to) {
+        [from, to] = [to, from];
+    }
+    for (var i = from; i <= to; i++) {
+        var ln = document.getElementById("L" + i);
+        if (ln !== null) {
+            ln.parentNode.classList.add("hl");
+        }
+    }
+    var first = document.getElementById("L" + from);
+    if (first !== null) {
+        first.scrollIntoView({ block: "center" });
+    }
+}
+
+window.addEventListener("hashchange", highlightLines);
+
+document.addEventListener('DOMContentLoaded', () => {
+    highlightLines();
+    // shift click on a line number selects a range
+    document.querySelectorAll(".source-view .ln a").forEach((a) => {
+        a.addEventListener("click", (e) => {
+            var m = /^#L(\d+)/.exec(location.hash);
+            if (!e.shiftKey || m === null) {
+                return;
+            }
+            e.preventDefault();
+            location.hash = "#L" + m[1] + "-" + a.getAttribute("href").substring(1);
+        });
+    });
+})
+
+function compareCells(a, b) {
+    var x = parseFloat(a.replace(/,/g, "")), y = parseFloat(b.replace(/,/g, ""));
+    if (!isNaN(x) && !isNaN(y)) {
+        return x - y;
+    }
+    return a.localeCompare(b);
+}
+
+// csv tables get a filter, sortable headers and pages
+function setupTable(container) {
+    var pageSize = 50;
+    var table = container.querySelector("table");
+    var body = table.tBodies[0];
+    if (body === undefined) {
+        return;
+    }
+    var rows = Array.from(body.rows);
+    var shown = rows;
+    var page = 0;
+
+    var filter = document.createElement("input");
+    filter.type = "text";
+    filter.className = "csv_filter";
+    filter.placeholder = "Filter...";
+    container.insertBefore(filter, table);
+
+    var pager = document.createElement("div");
+    pager.className = "csv_pager";
+    table.after(pager);
+
+    function draw() {
+        var pages = Math.max(1, Math.ceil(shown.length / pageSize));
+        page = Math.min(page, pages - 1);
+        body.replaceChildren(...shown.slice(page * pageSize, (page + 1) * pageSize));
+
+        pager.replaceChildren();
+        if (pages === 1) {
+            return;
+        }
+        var prev = document.createElement("button");
+        prev.textContent = "Prev";
+        prev.disabled = page === 0;
+        prev.addEventListener("click", () => { page--; draw(); });
+        var next = document.createElement("button");
+        next.textContent = "Next";
+        next.disabled = page === pages - 1;
+        next.addEventListener("click", () => { page++; draw(); });
+        var info = document.createElement("span");
+        info.textContent = (page + 1) + " / " + pages + " (" + shown.length + " rows)";
+        pager.append(prev, info, next);
+    }
+
+    filter.addEventListener("input", () => {
+        var key = filter.value.toLowerCase();
+        shown = rows.filter((row) => row.textContent.toLowerCase().includes(key));
+        page = 0;
+        draw();
+    });
+
+    table.querySelectorAll("thead th").forEach((th, col) => {
+        th.classList.add("sortable");
+        th.addEventListener("click", () => {
+            var asc = th.getAttribute("aria-sort") !== "ascending";
+            table.querySelectorAll("thead th").forEach((other) => other.removeAttribute("aria-sort"));
+            th.setAttribute("aria-sort", asc ? "ascending" : "descending");
+            var cell = (row) => row.cells[col] ? row.cells[col].textContent : "";
+            rows.sort((a, b) => asc ? compareCells(cell(a), cell(b)) : compareCells(cell(b), cell(a)));
+            shown = rows.filter((row) => shown.includes(row));
+            draw();
+        });
+    });
+
+    draw();
+}
+
+document.addEventListener('DOMContentLoaded', () => {
+    document.querySelectorAll(".csv-table").forEach(setupTable);
+})
@@ -0,0 +1,205 @@
+var previewTimer = null;
+
+function editorStatus(text, error) {
+    var status = document.getElementById("editor_status");
+    status.textContent = text;
+    status.classList.toggle("error", error === true);
+}
+
+function renderPreview() {
+    var editor = document.getElementById("editor");
+    $.ajax({
+        type: "POST",
+        url: "/api/render",
+        data: JSON.stringify({
+            "repo": editor.dataset.repo,
+            "path": editor.dataset.path,
+            "content": document.getElementById("editor_source").value,
+        }),
+        dataType: "json",
+        contentType: "application/json",
+        success: function (data) {
+            if (data.code === 200) {
+                document.getElementById("editor_preview").innerHTML = data.data;
+            }
+        },
+    });
+}
+
+function saveDoc(e) {
+    e.preventDefault();
+    var editor = document.getElementById("editor");
+    var message = document.getElementById("editor_message");
+    var propose = document.getElementById("editor_propose");
+    var title = document.getElementById("editor_title");
+    document.getElementById("editor_save").disabled = true;
+    editorStatus("Saving...");
+
+    $.ajax({
+        type: "POST",
+        url: "/api/doc/save",
+        data: JSON.stringify({
+            "repo": editor.dataset.repo,
+            "path": editor.dataset.path,
+            "content": document.getElementById("editor_source").value,
+            "base": editor.dataset.blob,
+            "message": message.value || message.placeholder,
+            "propose": propose !== null && propose.checked,
+            "title": title !== null ? title.value : "",
+            "proposal": Number(editor.dataset.proposal || 0),
+        }),
+        dataType: "json",
+        contentType: "application/json",
+        success: function (data) {
+            editor.dataset.blob = data.data.blob;
+            window.onbeforeunload = null;
+            window.location.href = data.data.url;
+        },
+        error: function (xhr) {
+            document.getElementById("editor_save").disabled = false;
+            var msg = xhr.responseJSON ? xhr.responseJSON.msg : xhr.statusText;
+            if (xhr.status === 409) {
+                // keep the text, the writer merges it by hand
+                msg += ". Open the document in another tab, merge your changes and reload this page.";
+            }
+            editorStatus(msg, true);
+        },
+    });
+}
+
+function postJSON(url, body, success) {
+    $.ajax({
+        type: "POST",
+        url: url,
+        data: JSON.stringify(body),
+        dataType: "json",
+        contentType: "application/json",
+        success: success,
+        error: function (xhr) {
+            var msg = xhr.responseJSON ? xhr.responseJSON.msg : xhr.statusText;
+            var status = document.getElementById("editor_status");
+            if (status !== null) {
+                editorStatus(msg, true);
+            } else {
+                alert(msg);
+            }
+        },
+    });
+}
+
+function moveDoc(e) {
+    e.preventDefault();
+    var actions = e.target.closest(".doc_actions");
+    var to = prompt("Move to", actions.dataset.path);
+    if (to === null || to === actions.dataset.path) {
+        return;
+    }
+    postJSON("/api/doc/move", {
+        "repo": actions.dataset.repo,
+        "path": actions.dataset.path,
+        "to": to,
+        "base": actions.dataset.blob,
+    }, (data) => { window.location.href = data.data.url; });
+}
+
+function deleteDoc(e) {
+    e.preventDefault();
+    var actions = e.target.closest(".doc_actions");
+    if (!confirm("Delete " + actions.dataset.path + "?")) {
+        return;
+    }
+    postJSON("/api/doc/delete", {
+        "repo": actions.dataset.repo,
+        "path": actions.dataset.path,
+        "base": actions.dataset.blob,
+    }, (data) => { window.location.href = data.data.url; });
+}
+
+function createDoc(e) {
+    e.preventDefault();
+    var form = document.getElementById("new_doc");
+    postJSON("/api/doc/create", {
+        "repo": form.dataset.repo,
+        "path": document.getElementById("new_path").value,
+        "title": document.getElementById("new_title").value,
+        "template": document.getElementById("new_template").value,
+    }, (data) => { window.location.href = data.data.url; });
+}
+
+function proposalAction(e, action) {
+    e.preventDefault();
+    var proposal = document.getElementById("proposal");
+    var comment = document.getElementById("proposal_comment");
+    if (action === "close" && !confirm("Close this proposal?")) {
+        return;
+    }
+    postJSON("/api/proposal/" + action, {
+        "repo": proposal.dataset.repo,
+        "id": Number(proposal.dataset.id),
+        "body": comment !== null ? comment.value : "",
+    }, () => { window.location.reload(); });
+}
+
+// uploads commit the image and put a link to it at the cursor
+function uploadImage(e) {
+    var editor = document.getElementById("editor");
+    var source = document.getElementById("editor_source");
+    var file = e.target.files[0];
+    if (file === undefined) {
+        return;
+    }
+    var form = new FormData();
+    form.append("repo", editor.dataset.repo);
+    form.append("doc", editor.dataset.path);
+    form.append("file", file);
+    editorStatus("Uploading...");
+
+    $.ajax({
+        type: "POST",
+        url: "/api/doc/upload",
+        data: form,
+        processData: false,
+        contentType: false,
+        dataType: "json",
+        success: function (data) {
+            var name = file.name.replace(/\.[^.]*$/, "");
+            var link = "![" + name + "](" + data.data.url + ")";
+            source.setRangeText(link, source.selectionStart, source.selectionEnd, "end");
+            source.dispatchEvent(new Event("input"));
+            editorStatus("Uploaded " + data.data.path);
+        },
+        error: function (xhr) {
+            editorStatus(xhr.responseJSON ? xhr.responseJSON.msg : xhr.statusText, true);
+        },
+    });
+    e.target.value = "";
+}
+
+document.addEventListener('DOMContentLoaded', () => {
+    var form = document.getElementById("new_doc");
+    if (form !== null) {
+        form.addEventListener('submit', createDoc);
+    }
+
+    var source = document.getElementById("editor_source");
+    if (source === null) {
+        return;
+    }
+    source.addEventListener('input', () => {
+        window.onbeforeunload = () => true;
+        clearTimeout(previewTimer);
+        previewTimer = setTimeout(renderPreview, 300);
+    });
+    document.getElementById("editor").addEventListener('submit', saveDoc);
+    var upload = document.getElementById("editor_upload");
+    if (upload !== null) {
+        upload.addEventListener('change', uploadImage);
+    }
+    var propose = document.getElementById("editor_propose");
+    if (propose !== null) {
+        propose.addEventListener('change', () => {
+            document.getElementById("editor_title").hidden = !propose.checked;
+            document.getElementById("editor_save").textContent = propose.checked ? "Propose" : "Save";
+        });
+    }
+})
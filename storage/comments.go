@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/scnon/md-doc/model"
+)
+
+type commentRepo struct {
+	db *sql.DB
+}
+
+const commentColumns = "id, repo, path, parent, author, author_email, body, heading, quote, prefix, suffix, blob_hash, outdated, resolved, created, updated"
+
+func scanComment(row rowScanner) (*model.Comment, error) {
+	var c model.Comment
+	var created, updated int64
+	err := row.Scan(&c.ID, &c.Repo, &c.Path, &c.Parent, &c.Author.Name, &c.Author.Email, &c.Body,
+		&c.Heading, &c.Quote, &c.Prefix, &c.Suffix, &c.Blob, &c.Outdated, &c.Resolved, &created, &updated)
+	if err != nil {
+		return nil, noRows(err)
+	}
+	c.Created, c.Updated = unixTime(created), unixTime(updated)
+	return &c, nil
+}
+
+func (r commentRepo) Create(c *model.Comment) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	res, err := tx.Exec("INSERT INTO comments (repo, path, parent, author, author_email, body, heading, quote, prefix, suffix, blob_hash, created, updated) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		c.Repo, c.Path, c.Parent, c.Author.Name, c.Author.Email, c.Body, c.Heading, c.Quote, c.Prefix, c.Suffix, c.Blob, now.Unix(), now.Unix())
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	for _, name := range c.Mentions {
+		if _, err := tx.Exec("INSERT INTO comment_mentions (comment, user) VALUES (?, ?)", id, name); err != nil {
+			return err
+		}
+	}
+	if c.Parent != 0 {
+		if _, err := tx.Exec("UPDATE comments SET updated = ? WHERE id = ?", now.Unix(), c.Parent); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	c.ID, c.Created, c.Updated = id, now, now
+	return nil
+}
+
+func (r commentRepo) Get(repo string, id int64) (*model.Comment, error) {
+	return scanComment(r.db.QueryRow("SELECT "+commentColumns+" FROM comments WHERE repo = ? AND id = ?", repo, id))
+}
+
+func (r commentRepo) list(query string, args ...interface{}) ([]*model.Comment, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []*model.Comment
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+func (r commentRepo) ListDoc(repo, path string) ([]*model.Comment, error) {
+	return r.list("SELECT "+commentColumns+" FROM comments WHERE repo = ? AND path = ? ORDER BY id", repo, path)
+}
+
+func (r commentRepo) UpdateAnchor(c *model.Comment) error {
+	_, err := r.db.Exec("UPDATE comments SET heading = ?, quote = ?, prefix = ?, suffix = ?, blob_hash = ?, outdated = ? WHERE id = ?",
+		c.Heading, c.Quote, c.Prefix, c.Suffix, c.Blob, c.Outdated, c.ID)
+	return err
+}
+
+func (r commentRepo) SetResolved(id int64, resolved bool) error {
+	_, err := r.db.Exec("UPDATE comments SET resolved = ?, updated = ? WHERE id = ?", resolved, time.Now().Unix(), id)
+	return err
+}
+
+func (r commentRepo) Mentioning(user string, limit int) ([]model.Comment, error) {
+	columns := "c." + strings.ReplaceAll(commentColumns, ", ", ", c.")
+	found, err := r.list("SELECT "+columns+" FROM comments c JOIN comment_mentions m ON m.comment = c.id WHERE m.user = ? ORDER BY c.id DESC LIMIT ?", user, limit)
+	if err != nil {
+		return nil, err
+	}
+	comments := make([]model.Comment, len(found))
+	for i, c := range found {
+		comments[i] = *c
+	}
+	return comments, nil
+}
@@ -0,0 +1,283 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Migration changes the schema from the version before it to Version
+type Migration struct {
+	Version int
+	Name    string
+	SQLite  string
+	MySQL   string
+}
+
+// migrations are applied in order, each once. Applied ones never change,
+// later changes go in a new migration.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "proposals",
+		SQLite: `
+CREATE TABLE IF NOT EXISTS proposals (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	repo VARCHAR(255) NOT NULL,
+	branch VARCHAR(255) NOT NULL,
+	target VARCHAR(255) NOT NULL,
+	title TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	author VARCHAR(255) NOT NULL,
+	author_email VARCHAR(255) NOT NULL,
+	status VARCHAR(16) NOT NULL,
+	created INTEGER NOT NULL,
+	updated INTEGER NOT NULL,
+	merged VARCHAR(64) NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS proposals_repo ON proposals (repo, status);
+CREATE TABLE IF NOT EXISTS proposal_comments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	proposal INTEGER NOT NULL REFERENCES proposals (id),
+	author VARCHAR(255) NOT NULL,
+	author_email VARCHAR(255) NOT NULL,
+	body TEXT NOT NULL,
+	created INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS proposal_approvals (
+	proposal INTEGER NOT NULL REFERENCES proposals (id),
+	author VARCHAR(255) NOT NULL,
+	author_email VARCHAR(255) NOT NULL,
+	commit_hash VARCHAR(64) NOT NULL,
+	created INTEGER NOT NULL,
+	PRIMARY KEY (proposal, author)
+)`,
+		MySQL: `
+CREATE TABLE IF NOT EXISTS proposals (
+	id BIGINT PRIMARY KEY AUTO_INCREMENT,
+	repo VARCHAR(191) NOT NULL,
+	branch VARCHAR(255) NOT NULL,
+	target VARCHAR(255) NOT NULL,
+	title TEXT NOT NULL,
+	description TEXT NOT NULL,
+	author VARCHAR(255) NOT NULL,
+	author_email VARCHAR(255) NOT NULL,
+	status VARCHAR(16) NOT NULL,
+	created BIGINT NOT NULL,
+	updated BIGINT NOT NULL,
+	merged VARCHAR(64) NOT NULL DEFAULT '',
+	INDEX proposals_repo (repo, status)
+) DEFAULT CHARSET=utf8mb4;
+CREATE TABLE IF NOT EXISTS proposal_comments (
+	id BIGINT PRIMARY KEY AUTO_INCREMENT,
+	proposal BIGINT NOT NULL,
+	author VARCHAR(255) NOT NULL,
+	author_email VARCHAR(255) NOT NULL,
+	body TEXT NOT NULL,
+	created BIGINT NOT NULL,
+	FOREIGN KEY (proposal) REFERENCES proposals (id)
+) DEFAULT CHARSET=utf8mb4;
+CREATE TABLE IF NOT EXISTS proposal_approvals (
+	proposal BIGINT NOT NULL,
+	author VARCHAR(191) NOT NULL,
+	author_email VARCHAR(255) NOT NULL,
+	commit_hash VARCHAR(64) NOT NULL,
+	created BIGINT NOT NULL,
+	PRIMARY KEY (proposal, author),
+	FOREIGN KEY (proposal) REFERENCES proposals (id)
+) DEFAULT CHARSET=utf8mb4`,
+	},
+	{
+		Version: 2,
+		Name:    "comments",
+		SQLite: `
+CREATE TABLE IF NOT EXISTS comments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	repo VARCHAR(255) NOT NULL,
+	path VARCHAR(1024) NOT NULL,
+	parent INTEGER NOT NULL DEFAULT 0,
+	author VARCHAR(255) NOT NULL,
+	author_email VARCHAR(255) NOT NULL,
+	body TEXT NOT NULL,
+	heading VARCHAR(255) NOT NULL DEFAULT '',
+	quote TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	suffix TEXT NOT NULL,
+	blob_hash VARCHAR(64) NOT NULL DEFAULT '',
+	outdated INTEGER NOT NULL DEFAULT 0,
+	resolved INTEGER NOT NULL DEFAULT 0,
+	created INTEGER NOT NULL,
+	updated INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS comments_doc ON comments (repo, path);
+CREATE TABLE IF NOT EXISTS comment_mentions (
+	comment INTEGER NOT NULL REFERENCES comments (id),
+	user VARCHAR(255) NOT NULL,
+	PRIMARY KEY (comment, user)
+);
+CREATE INDEX IF NOT EXISTS comment_mentions_user ON comment_mentions (user)`,
+		MySQL: `
+CREATE TABLE IF NOT EXISTS comments (
+	id BIGINT PRIMARY KEY AUTO_INCREMENT,
+	repo VARCHAR(191) NOT NULL,
+	path VARCHAR(1024) NOT NULL,
+	parent BIGINT NOT NULL DEFAULT 0,
+	author VARCHAR(255) NOT NULL,
+	author_email VARCHAR(255) NOT NULL,
+	body TEXT NOT NULL,
+	heading VARCHAR(255) NOT NULL DEFAULT '',
+	quote TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	suffix TEXT NOT NULL,
+	blob_hash VARCHAR(64) NOT NULL DEFAULT '',
+	outdated TINYINT NOT NULL DEFAULT 0,
+	resolved TINYINT NOT NULL DEFAULT 0,
+	created BIGINT NOT NULL,
+	updated BIGINT NOT NULL,
+	INDEX comments_doc (repo, path(191))
+) DEFAULT CHARSET=utf8mb4;
+CREATE TABLE IF NOT EXISTS comment_mentions (
+	comment BIGINT NOT NULL,
+	user VARCHAR(191) NOT NULL,
+	PRIMARY KEY (comment, user),
+	INDEX comment_mentions_user (user),
+	FOREIGN KEY (comment) REFERENCES comments (id)
+) DEFAULT CHARSET=utf8mb4`,
+	},
+	{
+		Version: 3,
+		Name:    "users, tokens, settings and webhooks",
+		SQLite: `
+CREATE TABLE users (
+	name VARCHAR(255) PRIMARY KEY,
+	email VARCHAR(255) NOT NULL,
+	created INTEGER NOT NULL,
+	last_seen INTEGER NOT NULL
+);
+CREATE TABLE tokens (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user VARCHAR(255) NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	hash VARCHAR(64) NOT NULL UNIQUE,
+	created INTEGER NOT NULL,
+	last_used INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX tokens_user ON tokens (user);
+CREATE TABLE repo_settings (
+	repo VARCHAR(255) NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	value TEXT NOT NULL,
+	PRIMARY KEY (repo, name)
+);
+CREATE TABLE webhooks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	repo VARCHAR(255) NOT NULL,
+	url VARCHAR(2048) NOT NULL,
+	secret VARCHAR(255) NOT NULL,
+	events VARCHAR(1024) NOT NULL,
+	active INTEGER NOT NULL DEFAULT 1,
+	created INTEGER NOT NULL
+);
+CREATE INDEX webhooks_repo ON webhooks (repo)`,
+		MySQL: `
+CREATE TABLE users (
+	name VARCHAR(191) PRIMARY KEY,
+	email VARCHAR(255) NOT NULL,
+	created BIGINT NOT NULL,
+	last_seen BIGINT NOT NULL
+) DEFAULT CHARSET=utf8mb4;
+CREATE TABLE tokens (
+	id BIGINT PRIMARY KEY AUTO_INCREMENT,
+	user VARCHAR(191) NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	hash VARCHAR(64) NOT NULL UNIQUE,
+	created BIGINT NOT NULL,
+	last_used BIGINT NOT NULL DEFAULT 0,
+	INDEX tokens_user (user)
+) DEFAULT CHARSET=utf8mb4;
+CREATE TABLE repo_settings (
+	repo VARCHAR(191) NOT NULL,
+	name VARCHAR(191) NOT NULL,
+	value TEXT NOT NULL,
+	PRIMARY KEY (repo, name)
+) DEFAULT CHARSET=utf8mb4;
+CREATE TABLE webhooks (
+	id BIGINT PRIMARY KEY AUTO_INCREMENT,
+	repo VARCHAR(191) NOT NULL,
+	url VARCHAR(2048) NOT NULL,
+	secret VARCHAR(255) NOT NULL,
+	events VARCHAR(1024) NOT NULL,
+	active TINYINT NOT NULL DEFAULT 1,
+	created BIGINT NOT NULL,
+	INDEX webhooks_repo (repo)
+) DEFAULT CHARSET=utf8mb4`,
+	},
+}
+
+// Migrations lists the migrations of the schema, oldest first
+func Migrations() []Migration {
+	return migrations
+}
+
+const versionTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	applied BIGINT NOT NULL
+)`
+
+func (s *sqlStore) Version() (int, error) {
+	if _, err := s.db.Exec(versionTable); err != nil {
+		return 0, err
+	}
+	var version sql.NullInt64
+	err := s.db.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&version)
+	return int(version.Int64), err
+}
+
+func (s *sqlStore) Migrate() ([]Migration, error) {
+	version, err := s.Version()
+	if err != nil {
+		return nil, err
+	}
+	var applied []Migration
+	for _, m := range migrations {
+		if m.Version <= version {
+			continue
+		}
+		if err := s.apply(m); err != nil {
+			return applied, fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+// apply runs a migration in a transaction, mysql commits each statement
+// that changes the schema on its own
+func (s *sqlStore) apply(m Migration) error {
+	schema := m.SQLite
+	if s.dialect == "mysql" {
+		schema = m.MySQL
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// mysql runs one statement per call
+	for _, stmt := range strings.Split(schema, ";") {
+		if strings.TrimSpace(stmt) == "" {
+			continue
+		}
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec("INSERT INTO schema_migrations (version, name, applied) VALUES (?, ?, ?)", m.Version, m.Name, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"database/sql"
+	"os"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// OpenMySQL opens a mysql database, an empty dsn is built from the
+// MYSQL_* variables docker-compose.yml sets
+func OpenMySQL(dsn string) (Store, error) {
+	if dsn == "" {
+		dsn = MySQLEnvDSN()
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// the server closes idle connections after wait_timeout
+	db.SetConnMaxLifetime(5 * time.Minute)
+	return &sqlStore{db: db, dialect: "mysql"}, nil
+}
+
+// MySQLEnvDSN builds a data source name from MYSQL_HOST, MYSQL_PORT,
+// MYSQL_DATABASE, MYSQL_USER and MYSQL_PASSWORD
+func MySQLEnvDSN() string {
+	config := mysql.NewConfig()
+	config.User = os.Getenv("MYSQL_USER")
+	config.Passwd = os.Getenv("MYSQL_PASSWORD")
+	config.Net = "tcp"
+	config.Addr = os.Getenv("MYSQL_HOST")
+	if port := os.Getenv("MYSQL_PORT"); port != "" {
+		config.Addr += ":" + port
+	}
+	config.DBName = os.Getenv("MYSQL_DATABASE")
+	config.Params = map[string]string{"charset": "utf8mb4"}
+	return config.FormatDSN()
+}
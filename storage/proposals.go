@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/scnon/md-doc/model"
+)
+
+type proposalRepo struct {
+	db *sql.DB
+}
+
+const proposalColumns = "id, repo, branch, target, title, description, author, author_email, status, created, updated, merged"
+
+func scanProposal(row rowScanner) (*model.Proposal, error) {
+	var p model.Proposal
+	var created, updated int64
+	err := row.Scan(&p.ID, &p.Repo, &p.Branch, &p.Target, &p.Title, &p.Description,
+		&p.Author.Name, &p.Author.Email, &p.Status, &created, &updated, &p.Merged)
+	if err != nil {
+		return nil, noRows(err)
+	}
+	p.Created, p.Updated = unixTime(created), unixTime(updated)
+	return &p, nil
+}
+
+func (r proposalRepo) Create(p *model.Proposal) error {
+	now := time.Now()
+	res, err := r.db.Exec("INSERT INTO proposals (repo, branch, target, title, description, author, author_email, status, created, updated, merged) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		p.Repo, p.Branch, p.Target, p.Title, p.Description, p.Author.Name, p.Author.Email, p.Status, now.Unix(), now.Unix(), p.Merged)
+	if err != nil {
+		return err
+	}
+	p.Created, p.Updated = now, now
+	p.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r proposalRepo) Get(repo string, id int64) (*model.Proposal, error) {
+	return scanProposal(r.db.QueryRow("SELECT "+proposalColumns+" FROM proposals WHERE repo = ? AND id = ?", repo, id))
+}
+
+func (r proposalRepo) List(repo string) ([]*model.Proposal, error) {
+	rows, err := r.db.Query("SELECT "+proposalColumns+" FROM proposals WHERE repo = ? ORDER BY id DESC", repo)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var proposals []*model.Proposal
+	for rows.Next() {
+		p, err := scanProposal(rows)
+		if err != nil {
+			return nil, err
+		}
+		proposals = append(proposals, p)
+	}
+	return proposals, rows.Err()
+}
+
+func (r proposalRepo) Delete(id int64) error {
+	_, err := r.db.Exec("DELETE FROM proposals WHERE id = ?", id)
+	return err
+}
+
+func (r proposalRepo) SetBranch(id int64, branch string) error {
+	_, err := r.db.Exec("UPDATE proposals SET branch = ? WHERE id = ?", branch, id)
+	return err
+}
+
+func (r proposalRepo) SetStatus(id int64, status, merged string) error {
+	_, err := r.db.Exec("UPDATE proposals SET status = ?, merged = ?, updated = ? WHERE id = ?",
+		status, merged, time.Now().Unix(), id)
+	return err
+}
+
+func (r proposalRepo) Touch(id int64) error {
+	_, err := r.db.Exec("UPDATE proposals SET updated = ? WHERE id = ?", time.Now().Unix(), id)
+	return err
+}
+
+func (r proposalRepo) AddComment(id int64, c *model.ProposalComment) error {
+	c.Created = time.Now()
+	res, err := r.db.Exec("INSERT INTO proposal_comments (proposal, author, author_email, body, created) VALUES (?, ?, ?, ?, ?)",
+		id, c.Author.Name, c.Author.Email, c.Body, c.Created.Unix())
+	if err != nil {
+		return err
+	}
+	if c.ID, err = res.LastInsertId(); err != nil {
+		return err
+	}
+	return r.Touch(id)
+}
+
+func (r proposalRepo) Comments(id int64) ([]model.ProposalComment, error) {
+	rows, err := r.db.Query("SELECT id, author, author_email, body, created FROM proposal_comments WHERE proposal = ? ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []model.ProposalComment
+	for rows.Next() {
+		var c model.ProposalComment
+		var created int64
+		if err := rows.Scan(&c.ID, &c.Author.Name, &c.Author.Email, &c.Body, &created); err != nil {
+			return nil, err
+		}
+		c.Created = unixTime(created)
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+func (r proposalRepo) Approve(id int64, a model.Approval) error {
+	_, err := r.db.Exec("REPLACE INTO proposal_approvals (proposal, author, author_email, commit_hash, created) VALUES (?, ?, ?, ?, ?)",
+		id, a.User.Name, a.User.Email, a.Commit, a.Created.Unix())
+	if err != nil {
+		return err
+	}
+	return r.Touch(id)
+}
+
+func (r proposalRepo) Approvals(id int64) ([]model.Approval, error) {
+	rows, err := r.db.Query("SELECT author, author_email, commit_hash, created FROM proposal_approvals WHERE proposal = ? ORDER BY created", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var approvals []model.Approval
+	for rows.Next() {
+		var a model.Approval
+		var created int64
+		if err := rows.Scan(&a.User.Name, &a.User.Email, &a.Commit, &created); err != nil {
+			return nil, err
+		}
+		a.Created = unixTime(created)
+		approvals = append(approvals, a)
+	}
+	return approvals, rows.Err()
+}
@@ -0,0 +1,36 @@
+package storage
+
+import "database/sql"
+
+type settingRepo struct {
+	db *sql.DB
+}
+
+func (r settingRepo) Get(repo, key string) (string, error) {
+	var value string
+	err := r.db.QueryRow("SELECT value FROM repo_settings WHERE repo = ? AND name = ?", repo, key).Scan(&value)
+	return value, noRows(err)
+}
+
+func (r settingRepo) Set(repo, key, value string) error {
+	_, err := r.db.Exec("REPLACE INTO repo_settings (repo, name, value) VALUES (?, ?, ?)", repo, key, value)
+	return err
+}
+
+func (r settingRepo) List(repo string) (map[string]string, error) {
+	rows, err := r.db.Query("SELECT name, value FROM repo_settings WHERE repo = ?", repo)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := map[string]string{}
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		settings[key] = value
+	}
+	return settings, rows.Err()
+}
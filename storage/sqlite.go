@@ -0,0 +1,19 @@
+package storage
+
+import (
+	"database/sql"
+
+	_ "modernc.org/sqlite"
+)
+
+// OpenSQLite opens a sqlite database file, ":memory:" keeps it in memory
+func OpenSQLite(path string) (Store, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)")
+	if err != nil {
+		return nil, err
+	}
+	// sqlite has one writer, queueing in database/sql avoids busy errors.
+	// it also keeps one in memory database for all queries.
+	db.SetMaxOpenConns(1)
+	return &sqlStore{db: db, dialect: "sqlite"}, nil
+}
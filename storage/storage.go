@@ -0,0 +1,135 @@
+// Package storage keeps the state of md-doc that does not live in the
+// repos: users, tokens, repo settings, webhooks, comments and proposals.
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+
+	"github.com/scnon/md-doc/model"
+)
+
+// ErrNotFound is os.ErrNotExist, callers may test for either
+var ErrNotFound = os.ErrNotExist
+
+// Store is the database of md-doc, one repository of records per kind
+type Store interface {
+	Users() Users
+	Tokens() Tokens
+	Settings() Settings
+	Webhooks() Webhooks
+	Comments() Comments
+	Proposals() Proposals
+	// Migrate brings the schema to the latest version and returns the
+	// migrations it applied
+	Migrate() ([]Migration, error)
+	// Version is the latest migration applied
+	Version() (int, error)
+	Close() error
+}
+
+// Users remembers who signed in
+type Users interface {
+	// Touch records that user was seen now
+	Touch(user model.User) error
+	Get(name string) (*model.Account, error)
+	List() ([]model.Account, error)
+}
+
+// Tokens are api tokens of users, only their hashes are stored
+type Tokens interface {
+	// Create makes a token and returns its secret, shown only once
+	Create(user, name string) (string, *model.Token, error)
+	// Lookup finds the token of a secret and marks it used
+	Lookup(secret string) (*model.Token, error)
+	List(user string) ([]model.Token, error)
+	Delete(user string, id int64) error
+}
+
+// Settings are values of a repo set at runtime
+type Settings interface {
+	Get(repo, key string) (string, error)
+	Set(repo, key, value string) error
+	List(repo string) (map[string]string, error)
+}
+
+// Webhooks are urls notified of events of a repo
+type Webhooks interface {
+	Create(hook *model.Webhook) error
+	List(repo string) ([]model.Webhook, error)
+	Delete(repo string, id int64) error
+}
+
+// Comments are the comment threads on documents
+type Comments interface {
+	// Create stores a comment with its mentions and sets its ID, replies
+	// mark their thread updated
+	Create(c *model.Comment) error
+	Get(repo string, id int64) (*model.Comment, error)
+	// ListDoc lists the comments of a document, oldest first
+	ListDoc(repo, path string) ([]*model.Comment, error)
+	// UpdateAnchor saves where a thread was found in a new version
+	UpdateAnchor(c *model.Comment) error
+	SetResolved(id int64, resolved bool) error
+	// Mentioning lists the latest comments mentioning a user
+	Mentioning(user string, limit int) ([]model.Comment, error)
+}
+
+// Proposals are changes waiting for review on their own branch
+type Proposals interface {
+	// Create stores a proposal and sets its ID
+	Create(p *model.Proposal) error
+	Get(repo string, id int64) (*model.Proposal, error)
+	// List lists the proposals of a repo, newest first
+	List(repo string) ([]*model.Proposal, error)
+	Delete(id int64) error
+	SetBranch(id int64, branch string) error
+	SetStatus(id int64, status, merged string) error
+	// Touch marks a proposal updated now
+	Touch(id int64) error
+	AddComment(id int64, c *model.ProposalComment) error
+	Comments(id int64) ([]model.ProposalComment, error)
+	// Approve records an approval, replacing an earlier one of the user
+	Approve(id int64, a model.Approval) error
+	Approvals(id int64) ([]model.Approval, error)
+}
+
+// Open opens the database of a driver, sqlite takes a file path and mysql
+// a data source name
+func Open(driver, dsn string) (Store, error) {
+	switch driver {
+	case "sqlite":
+		return OpenSQLite(dsn)
+	case "mysql":
+		return OpenMySQL(dsn)
+	}
+	return nil, fmt.Errorf("unknown database driver %q", driver)
+}
+
+// sqlStore implements Store on database/sql, the dialects differ in their
+// migrations only
+type sqlStore struct {
+	db      *sql.DB
+	dialect string
+}
+
+func (s *sqlStore) Users() Users         { return userRepo{s.db} }
+func (s *sqlStore) Tokens() Tokens       { return tokenRepo{s.db} }
+func (s *sqlStore) Settings() Settings   { return settingRepo{s.db} }
+func (s *sqlStore) Webhooks() Webhooks   { return webhookRepo{s.db} }
+func (s *sqlStore) Comments() Comments   { return commentRepo{s.db} }
+func (s *sqlStore) Proposals() Proposals { return proposalRepo{s.db} }
+func (s *sqlStore) Close() error         { return s.db.Close() }
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// noRows turns sql.ErrNoRows into ErrNotFound
+func noRows(err error) error {
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,321 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/scnon/md-doc/model"
+)
+
+var (
+	alice = model.User{Name: "alice", Email: "alice@example.com"}
+	bob   = model.User{Name: "bob", Email: "bob@example.com"}
+)
+
+func openTest(t *testing.T) Store {
+	t.Helper()
+	s, err := OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	if _, err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestMigrate(t *testing.T) {
+	s, err := OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if v, err := s.Version(); err != nil || v != 0 {
+		t.Fatalf("version of a new database: %d, %v", v, err)
+	}
+	applied, err := s.Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := migrations[len(migrations)-1].Version
+	if len(applied) != len(migrations) {
+		t.Errorf("applied %d migrations, want %d", len(applied), len(migrations))
+	}
+	if v, err := s.Version(); err != nil || v != latest {
+		t.Errorf("version %d, %v, want %d", v, err, latest)
+	}
+
+	// migrating again changes nothing
+	applied, err = s.Migrate()
+	if err != nil || len(applied) != 0 {
+		t.Errorf("second migration applied %v, %v", applied, err)
+	}
+	if v, _ := s.Version(); v != latest {
+		t.Errorf("version after the second migration %d, want %d", v, latest)
+	}
+}
+
+func TestMigrationVersions(t *testing.T) {
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %d %q has version %d", i, m.Name, m.Version)
+		}
+		if m.SQLite == "" || m.MySQL == "" {
+			t.Errorf("migration %d %q misses a dialect", m.Version, m.Name)
+		}
+	}
+}
+
+func TestUsers(t *testing.T) {
+	users := openTest(t).Users()
+
+	if _, err := users.Get("alice"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("unknown user: %v", err)
+	}
+	if err := users.Touch(alice); err != nil {
+		t.Fatal(err)
+	}
+	// a new email is remembered
+	if err := users.Touch(model.User{Name: "alice", Email: "alice@new.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Touch(bob); err != nil {
+		t.Fatal(err)
+	}
+
+	account, err := users.Get("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Email != "alice@new.example.com" || account.Created.IsZero() || account.LastSeen.IsZero() {
+		t.Errorf("account %+v", account)
+	}
+	list, err := users.List()
+	if err != nil || len(list) != 2 {
+		t.Errorf("list %+v, %v", list, err)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	tokens := openTest(t).Tokens()
+
+	secret, token, err := tokens.Create("alice", "ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.ID == 0 || token.User != "alice" || token.Hash == secret || token.Hash == "" {
+		t.Errorf("token %+v", token)
+	}
+
+	found, err := tokens.Lookup(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != token.ID || found.Name != "ci" || found.LastUsed.IsZero() {
+		t.Errorf("lookup %+v", found)
+	}
+	if _, err := tokens.Lookup(secret + "x"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("lookup of a wrong secret: %v", err)
+	}
+
+	list, err := tokens.List("alice")
+	if err != nil || len(list) != 1 || list[0].LastUsed.IsZero() {
+		t.Errorf("list %+v, %v", list, err)
+	}
+
+	// users only delete their own tokens
+	if err := tokens.Delete("bob", token.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("delete by another user: %v", err)
+	}
+	if err := tokens.Delete("alice", token.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tokens.Lookup(secret); !errors.Is(err, ErrNotFound) {
+		t.Errorf("lookup of a deleted token: %v", err)
+	}
+}
+
+func TestSettings(t *testing.T) {
+	settings := openTest(t).Settings()
+
+	if _, err := settings.Get("demo", "sanitize"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unset setting: %v", err)
+	}
+	for _, value := range []string{"iframe", "strict"} {
+		if err := settings.Set("demo", "sanitize", value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := settings.Set("demo", "write", "alice,bob"); err != nil {
+		t.Fatal(err)
+	}
+	if err := settings.Set("other", "write", "carol"); err != nil {
+		t.Fatal(err)
+	}
+
+	if value, err := settings.Get("demo", "sanitize"); err != nil || value != "strict" {
+		t.Errorf("sanitize %q, %v", value, err)
+	}
+	list, err := settings.List("demo")
+	if err != nil || len(list) != 2 || list["write"] != "alice,bob" {
+		t.Errorf("list %v, %v", list, err)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	webhooks := openTest(t).Webhooks()
+
+	hook := &model.Webhook{Repo: "demo", URL: "https://ci.example.com/hook", Secret: "s3cret",
+		Events: []string{"push", "comment"}, Active: true}
+	if err := webhooks.Create(hook); err != nil {
+		t.Fatal(err)
+	}
+	if hook.ID == 0 || hook.Created.IsZero() {
+		t.Errorf("created %+v", hook)
+	}
+	if err := webhooks.Create(&model.Webhook{Repo: "other", URL: "https://other.example.com/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := webhooks.List("demo")
+	if err != nil || len(list) != 1 {
+		t.Fatalf("list %+v, %v", list, err)
+	}
+	if got := list[0]; got.URL != hook.URL || got.Secret != "s3cret" || !got.Active ||
+		len(got.Events) != 2 || got.Events[1] != "comment" || got.Created.Unix() != hook.Created.Unix() {
+		t.Errorf("listed %+v", got)
+	}
+
+	// hooks are deleted through their repo
+	if err := webhooks.Delete("other", hook.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("delete through another repo: %v", err)
+	}
+	if err := webhooks.Delete("demo", hook.ID); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := webhooks.List("demo"); len(list) != 0 {
+		t.Errorf("list after delete %+v", list)
+	}
+}
+
+func TestComments(t *testing.T) {
+	comments := openTest(t).Comments()
+
+	thread := &model.Comment{Repo: "demo", Path: "a.md", Author: alice, Body: "why @bob?",
+		Heading: "intro", Quote: "text", Blob: "b1", Mentions: []string{"bob"}}
+	if err := comments.Create(thread); err != nil {
+		t.Fatal(err)
+	}
+	if thread.ID == 0 || thread.Created.IsZero() {
+		t.Errorf("created %+v", thread)
+	}
+	time.Sleep(time.Second)
+	reply := &model.Comment{Repo: "demo", Path: "a.md", Parent: thread.ID, Author: bob, Body: "because"}
+	if err := comments.Create(reply); err != nil {
+		t.Fatal(err)
+	}
+	other := &model.Comment{Repo: "demo", Path: "b.md", Author: bob, Body: "@bob note", Mentions: []string{"bob"}}
+	if err := comments.Create(other); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := comments.Get("demo", thread.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Body != thread.Body || got.Author != alice || got.Quote != "text" || !got.Updated.After(got.Created) {
+		t.Errorf("thread %+v, a reply marks it updated", got)
+	}
+	if _, err := comments.Get("other", thread.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("comment of another repo: %v", err)
+	}
+
+	doc, err := comments.ListDoc("demo", "a.md")
+	if err != nil || len(doc) != 2 || doc[0].ID != thread.ID || doc[1].Parent != thread.ID {
+		t.Errorf("list %+v, %v", doc, err)
+	}
+
+	got.Quote, got.Blob, got.Outdated = "new text", "b2", true
+	if err := comments.UpdateAnchor(got); err != nil {
+		t.Fatal(err)
+	}
+	if err := comments.SetResolved(thread.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = comments.Get("demo", thread.ID)
+	if got.Quote != "new text" || got.Blob != "b2" || !got.Outdated || !got.Resolved {
+		t.Errorf("updated thread %+v", got)
+	}
+
+	mentions, err := comments.Mentioning("bob", 10)
+	if err != nil || len(mentions) != 2 || mentions[0].ID != other.ID {
+		t.Errorf("mentions %+v, %v", mentions, err)
+	}
+	if mentions, _ := comments.Mentioning("bob", 1); len(mentions) != 1 {
+		t.Errorf("limited mentions %+v", mentions)
+	}
+}
+
+func TestProposals(t *testing.T) {
+	proposals := openTest(t).Proposals()
+
+	p := &model.Proposal{Repo: "demo", Target: "master", Title: "Fix typo", Author: bob, Status: model.ProposalOpen}
+	if err := proposals.Create(p); err != nil {
+		t.Fatal(err)
+	}
+	second := &model.Proposal{Repo: "demo", Target: "master", Title: "Other", Author: bob, Status: model.ProposalOpen}
+	if err := proposals.Create(second); err != nil {
+		t.Fatal(err)
+	}
+	if err := proposals.SetBranch(p.ID, "proposals/1"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := proposals.Get("demo", p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "Fix typo" || got.Branch != "proposals/1" || got.Author != bob || got.Status != model.ProposalOpen {
+		t.Errorf("proposal %+v", got)
+	}
+	list, err := proposals.List("demo")
+	if err != nil || len(list) != 2 || list[0].ID != second.ID {
+		t.Errorf("list, newest first: %+v, %v", list, err)
+	}
+
+	c := &model.ProposalComment{Author: alice, Body: "looks good"}
+	if err := proposals.AddComment(p.ID, c); err != nil {
+		t.Fatal(err)
+	}
+	if comments, err := proposals.Comments(p.ID); err != nil || len(comments) != 1 || comments[0].ID != c.ID || comments[0].Body != "looks good" {
+		t.Errorf("comments %+v, %v", comments, err)
+	}
+
+	// a second approval of a user replaces the first
+	for _, commit := range []string{"c1", "c2"} {
+		if err := proposals.Approve(p.ID, model.Approval{User: alice, Commit: commit, Created: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if approvals, err := proposals.Approvals(p.ID); err != nil || len(approvals) != 1 || approvals[0].Commit != "c2" {
+		t.Errorf("approvals %+v, %v", approvals, err)
+	}
+
+	if err := proposals.SetStatus(p.ID, model.ProposalMerged, "c2"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := proposals.Get("demo", p.ID); got.Status != model.ProposalMerged || got.Merged != "c2" {
+		t.Errorf("merged proposal %+v", got)
+	}
+
+	if err := proposals.Delete(second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := proposals.Get("demo", second.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleted proposal: %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"time"
+
+	"github.com/scnon/md-doc/model"
+)
+
+// tokenPrefix marks md-doc secrets, e.g. for secret scanners
+const tokenPrefix = "mdd_"
+
+// unixTime is the time of a stored unix timestamp, zero stays zero
+func unixTime(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
+
+type userRepo struct {
+	db *sql.DB
+}
+
+func (r userRepo) Touch(user model.User) error {
+	now := time.Now().Unix()
+	res, err := r.db.Exec("UPDATE users SET email = ?, last_seen = ? WHERE name = ?", user.Email, now, user.Name)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	_, err = r.db.Exec("INSERT INTO users (name, email, created, last_seen) VALUES (?, ?, ?, ?)", user.Name, user.Email, now, now)
+	return err
+}
+
+func scanAccount(row rowScanner) (*model.Account, error) {
+	var a model.Account
+	var created, seen int64
+	if err := row.Scan(&a.Name, &a.Email, &created, &seen); err != nil {
+		return nil, noRows(err)
+	}
+	a.Created, a.LastSeen = unixTime(created), unixTime(seen)
+	return &a, nil
+}
+
+func (r userRepo) Get(name string) (*model.Account, error) {
+	return scanAccount(r.db.QueryRow("SELECT name, email, created, last_seen FROM users WHERE name = ?", name))
+}
+
+func (r userRepo) List() ([]model.Account, error) {
+	rows, err := r.db.Query("SELECT name, email, created, last_seen FROM users ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []model.Account
+	for rows.Next() {
+		a, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, *a)
+	}
+	return accounts, rows.Err()
+}
+
+type tokenRepo struct {
+	db *sql.DB
+}
+
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func (r tokenRepo) Create(user, name string) (string, *model.Token, error) {
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return "", nil, err
+	}
+	secret := tokenPrefix + hex.EncodeToString(random)
+	t := model.Token{User: user, Name: name, Hash: hashToken(secret), Created: time.Now()}
+
+	res, err := r.db.Exec("INSERT INTO tokens (user, name, hash, created) VALUES (?, ?, ?, ?)", t.User, t.Name, t.Hash, t.Created.Unix())
+	if err != nil {
+		return "", nil, err
+	}
+	if t.ID, err = res.LastInsertId(); err != nil {
+		return "", nil, err
+	}
+	return secret, &t, nil
+}
+
+const tokenColumns = "id, user, name, hash, created, last_used"
+
+func scanToken(row rowScanner) (*model.Token, error) {
+	var t model.Token
+	var created, used int64
+	if err := row.Scan(&t.ID, &t.User, &t.Name, &t.Hash, &created, &used); err != nil {
+		return nil, noRows(err)
+	}
+	t.Created, t.LastUsed = unixTime(created), unixTime(used)
+	return &t, nil
+}
+
+func (r tokenRepo) Lookup(secret string) (*model.Token, error) {
+	t, err := scanToken(r.db.QueryRow("SELECT "+tokenColumns+" FROM tokens WHERE hash = ?", hashToken(secret)))
+	if err != nil {
+		return nil, err
+	}
+	t.LastUsed = time.Now()
+	_, err = r.db.Exec("UPDATE tokens SET last_used = ? WHERE id = ?", t.LastUsed.Unix(), t.ID)
+	return t, err
+}
+
+func (r tokenRepo) List(user string) ([]model.Token, error) {
+	rows, err := r.db.Query("SELECT "+tokenColumns+" FROM tokens WHERE user = ? ORDER BY id", user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []model.Token
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *t)
+	}
+	return tokens, rows.Err()
+}
+
+func (r tokenRepo) Delete(user string, id int64) error {
+	res, err := r.db.Exec("DELETE FROM tokens WHERE user = ? AND id = ?", user, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
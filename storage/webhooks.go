@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/scnon/md-doc/model"
+)
+
+type webhookRepo struct {
+	db *sql.DB
+}
+
+func (r webhookRepo) Create(hook *model.Webhook) error {
+	hook.Created = time.Now()
+	res, err := r.db.Exec("INSERT INTO webhooks (repo, url, secret, events, active, created) VALUES (?, ?, ?, ?, ?, ?)",
+		hook.Repo, hook.URL, hook.Secret, strings.Join(hook.Events, ","), hook.Active, hook.Created.Unix())
+	if err != nil {
+		return err
+	}
+	hook.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r webhookRepo) List(repo string) ([]model.Webhook, error) {
+	rows, err := r.db.Query("SELECT id, repo, url, secret, events, active, created FROM webhooks WHERE repo = ? ORDER BY id", repo)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hooks []model.Webhook
+	for rows.Next() {
+		var h model.Webhook
+		var events string
+		var created int64
+		if err := rows.Scan(&h.ID, &h.Repo, &h.URL, &h.Secret, &events, &h.Active, &created); err != nil {
+			return nil, err
+		}
+		if events != "" {
+			h.Events = strings.Split(events, ",")
+		}
+		h.Created = unixTime(created)
+		hooks = append(hooks, h)
+	}
+	return hooks, rows.Err()
+}
+
+func (r webhookRepo) Delete(repo string, id int64) error {
+	res, err := r.db.Exec("DELETE FROM webhooks WHERE repo = ? AND id = ?", repo, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
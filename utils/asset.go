@@ -0,0 +1,235 @@
+package utils
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+var ErrOutsideRepo = errors.New("path outside of repo")
+
+// types the system mime table may not know
+var assetTypes = map[string]string{
+	".svg":   "image/svg+xml",
+	".webp":  "image/webp",
+	".avif":  "image/avif",
+	".gif":   "image/gif",
+	".ico":   "image/x-icon",
+	".pdf":   "application/pdf",
+	".mp4":   "video/mp4",
+	".webm":  "video/webm",
+	".ogv":   "video/ogg",
+	".mov":   "video/quicktime",
+	".mp3":   "audio/mpeg",
+	".ogg":   "audio/ogg",
+	".wav":   "audio/wav",
+	".m4a":   "audio/mp4",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+	".ttf":   "font/ttf",
+	".otf":   "font/otf",
+}
+
+// svg and markup may run scripts, they are sandboxed
+const assetCSP = "default-src 'none'; style-src 'unsafe-inline'; img-src data:; sandbox"
+
+type assetHashEntry struct {
+	size    int64
+	modtime time.Time
+	hash    string
+}
+
+var (
+	assetHashes    = map[string]assetHashEntry{}
+	assetHashLock  sync.Mutex
+	assetCacheTime = 365 * 24 * time.Hour
+)
+
+func GetAssetUrl(repo, file string) string {
+	return fmt.Sprint("/asset/", repo, "/", file)
+}
+
+// ResolveFile maps a path of a repo to the file in its checkout. Paths
+// leaving the checkout, also through symlinks, and .git are rejected.
+func ResolveFile(repo, file string) (string, error) {
+	if repo == "" || repo == "." || repo == ".." || strings.ContainsAny(repo, `/\`) {
+		return "", ErrOutsideRepo
+	}
+	clean := path.Clean("/" + filepath.ToSlash(file))
+	for _, part := range strings.Split(clean, "/") {
+		if part == ".git" {
+			return "", ErrOutsideRepo
+		}
+	}
+
+	root, err := filepath.EvalSymlinks(GetGitPath(repo))
+	if err != nil {
+		return "", err
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	real, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(clean)))
+	if err != nil {
+		return "", err
+	}
+	real, err = filepath.Abs(real)
+	if err != nil {
+		return "", err
+	}
+	if real != root && !strings.HasPrefix(real, root+string(filepath.Separator)) {
+		return "", ErrOutsideRepo
+	}
+	return real, nil
+}
+
+// AssetType is the mime type of file by its extension, or sniffed from
+// the first bytes of its content
+func AssetType(file string, head []byte) string {
+	ext := strings.ToLower(path.Ext(file))
+	if t, ok := assetTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return http.DetectContentType(head)
+}
+
+// IsMediaFile reports whether file is an image, video, audio, font or pdf
+func IsMediaFile(file string) bool {
+	t := AssetType(file, nil)
+	for _, prefix := range []string{"image/", "video/", "audio/", "font/", "application/pdf"} {
+		if strings.HasPrefix(t, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// assetHash is the blob hash of a file, remembered until it changes
+func assetHash(file string, info os.FileInfo) (string, error) {
+	assetHashLock.Lock()
+	entry, ok := assetHashes[file]
+	assetHashLock.Unlock()
+	if ok && entry.size == info.Size() && entry.modtime.Equal(info.ModTime()) {
+		return entry.hash, nil
+	}
+
+	// streamed, media files may be large
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", info.Size())
+	if _, err := io.CopyN(h, f, info.Size()); err != nil {
+		return "", err
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	assetHashLock.Lock()
+	assetHashes[file] = assetHashEntry{info.Size(), info.ModTime(), hash}
+	assetHashLock.Unlock()
+	return hash, nil
+}
+
+// forgetAssetHashes drops the hashes remembered for files of repo that
+// are not among its assets any more, so deleted and moved files don't
+// pile up
+func forgetAssetHashes(repo string, assets map[string]string) {
+	root, err := filepath.EvalSymlinks(GetGitPath(repo))
+	if err != nil {
+		return
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return
+	}
+
+	assetHashLock.Lock()
+	defer assetHashLock.Unlock()
+	for file := range assetHashes {
+		if !strings.HasPrefix(file, root+string(filepath.Separator)) {
+			continue
+		}
+		if _, ok := assets[filepath.ToSlash(file[len(root)+1:])]; !ok {
+			delete(assetHashes, file)
+		}
+	}
+}
+
+// AssetVersion is the blob hash of a file of a repo, for ?v= in asset urls
+func AssetVersion(repo, file string) (string, error) {
+	real, err := ResolveFile(repo, file)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(real)
+	if err != nil {
+		return "", err
+	}
+	return assetHash(real, info)
+}
+
+// ServeAsset sends a file of a repo with its content type, answering
+// range and conditional requests. Requests carrying ?v=<blob hash> are
+// cached for a year.
+func ServeAsset(c echo.Context, repo, file string) error {
+	real, err := ResolveFile(repo, file)
+	if err != nil {
+		return Resp404(c)
+	}
+	f, err := os.Open(real)
+	if err != nil {
+		return Resp404(c)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		return Resp404(c)
+	}
+
+	hash, err := assetHash(real, info)
+	if err != nil {
+		return Resp500(c, err)
+	}
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return Resp500(c, err)
+	}
+
+	contentType := AssetType(real, head[:n])
+	header := c.Response().Header()
+	switch {
+	case strings.HasPrefix(contentType, "text/html"), strings.Contains(contentType, "xml"),
+		strings.HasPrefix(contentType, "application/javascript"), strings.HasPrefix(contentType, "text/javascript"):
+		header.Set("Content-Security-Policy", assetCSP)
+	}
+	header.Set(echo.HeaderContentType, contentType)
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("ETag", `"`+hash+`"`)
+	if c.QueryParam("v") == hash {
+		header.Set(echo.HeaderCacheControl, fmt.Sprintf("public, max-age=%d, immutable", int(assetCacheTime.Seconds())))
+	} else {
+		header.Set(echo.HeaderCacheControl, "no-cache")
+	}
+
+	http.ServeContent(c.Response(), c.Request(), info.Name(), info.ModTime(), f)
+	return nil
+}
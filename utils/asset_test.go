@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveFile(t *testing.T) {
+	testRepos(t)
+	root := GetGitPath("demo")
+	// next to the checkout, where a .. leaving it lands
+	outside := filepath.Join(filepath.Dir(filepath.Clean(root)), "secret.txt")
+	for _, dir := range []string{root + "docs", root + ".git"} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for file, content := range map[string]string{root + "docs/a.png": "png", root + ".git/config": "", outside: "secret"} {
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		root + "docs/inside.png": "a.png",
+		root + "secret.txt":      outside,
+		root + "up":              "..",
+		root + "docs/relative":   "../../secret.txt",
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, file := range []string{"docs/a.png", "/docs/a.png", "docs/inside.png", "docs/../docs/a.png", "../docs/a.png"} {
+		real, err := ResolveFile("demo", file)
+		if err != nil || filepath.Base(real) != "a.png" {
+			t.Errorf("ResolveFile(%q) = %q, %v", file, real, err)
+		}
+	}
+	escapes := []struct{ repo, file string }{
+		{"demo", "secret.txt"},
+		{"demo", "up/secret.txt"},
+		{"demo", "docs/relative"},
+		{"demo", ".git/config"},
+		{"demo", "docs/../.git/config"},
+		{"..", "secret.txt"},
+		{"demo/../demo", "docs/a.png"},
+		{"", "secret.txt"},
+	}
+	for _, test := range escapes {
+		if real, err := ResolveFile(test.repo, test.file); !errors.Is(err, ErrOutsideRepo) {
+			t.Errorf("ResolveFile(%q, %q) = %q, %v", test.repo, test.file, real, err)
+		}
+	}
+}
+
+func TestAssetVersion(t *testing.T) {
+	testRepos(t)
+	if err := os.MkdirAll(GetGitPath("demo"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	content := []byte(strings.Repeat("frame", 100000))
+	if err := os.WriteFile(GetGitPath("demo")+"a.mp4", content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if hash, err := AssetVersion("demo", "a.mp4"); err != nil || hash != BlobHash(content) {
+		t.Errorf("version %q, %v, want %s", hash, err, BlobHash(content))
+	}
+}
+
+func TestRenderVersionsAssets(t *testing.T) {
+	testRepos(t, "media")
+	testCommit(t, "media", map[string]string{
+		"docs/a.md":      "# A\n\n![diagram](img/a.png) ![talk](/media/talk.mp4) ![remote](https://example.com/b.png) :party:\n",
+		"docs/img/a.png": "png",
+		"media/talk.mp4": "mp4",
+	})
+	SyncRepo("media")
+	emoji := GetGitPath("media") + ConfigDir + "/emoji/"
+	if err := os.MkdirAll(emoji, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(emoji+"party.png", []byte("party"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	UpdateIndex("media")
+
+	content, err := GetFile("media", "docs/a.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := RenderDoc("media", "docs/a.md", content)
+	for _, want := range []string{
+		`src="/asset/media/docs/img/a.png?v=` + BlobHash([]byte("png")) + `"`,
+		`src="/asset/media/media/talk.mp4?v=` + BlobHash([]byte("mp4")) + `"`,
+		`src="/asset/media/` + ConfigDir + `/emoji/party.png?v=` + BlobHash([]byte("party")) + `"`,
+		`src="https://example.com/b.png"`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("rendered html lacks %s: %s", want, html)
+		}
+	}
+
+	// a changed asset is rendered with its new version
+	if err := os.WriteFile(GetGitPath("media")+"docs/img/a.png", []byte("png2"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	UpdateIndex("media")
+	if html := RenderDoc("media", "docs/a.md", content); !strings.Contains(html, "?v="+BlobHash([]byte("png2"))) {
+		t.Errorf("stale asset version: %s", html)
+	}
+}
+
+func TestUpdateIndexForgetsAssets(t *testing.T) {
+	testRepos(t, "media", "other")
+	testCommit(t, "media", map[string]string{"a.png": "a", "b.png": "b", "a.md": "# A\n"})
+	testCommit(t, "other", map[string]string{"c.png": "c"})
+	SyncRepo("media")
+	SyncRepo("other")
+	UpdateIndex("media")
+	UpdateIndex("other")
+	cached := func(repo, file string) bool {
+		root, err := filepath.EvalSymlinks(GetGitPath(repo))
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, _ = filepath.Abs(root)
+		assetHashLock.Lock()
+		defer assetHashLock.Unlock()
+		_, ok := assetHashes[filepath.Join(root, file)]
+		return ok
+	}
+	if !cached("media", "a.png") || !cached("media", "b.png") || !cached("other", "c.png") {
+		t.Fatal("asset hashes not remembered")
+	}
+
+	if err := os.Remove(GetGitPath("media") + "b.png"); err != nil {
+		t.Fatal(err)
+	}
+	UpdateIndex("media")
+	if cached("media", "b.png") {
+		t.Error("hash of a deleted asset kept")
+	}
+	if !cached("media", "a.png") || !cached("other", "c.png") {
+		t.Error("hashes of present assets dropped")
+	}
+}
@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/scnon/md-doc/model"
+)
+
+var (
+	// UserHeader names the header an authenticating proxy sets to the
+	// signed in user, without it nobody is signed in and nothing can be
+	// edited
+	UserHeader = ""
+	// UserEmailHeader names the header with the email of the user
+	UserEmailHeader = ""
+
+	// users are recorded as seen at most once a minute
+	seenUsers sync.Map
+)
+
+// requestUser is the user of a request, kept in its context
+type requestUser struct {
+	user     model.User
+	signedIn bool
+}
+
+// CurrentUser is the user a request is made by, named by the proxy or by
+// an api token in the Authorization header
+func CurrentUser(c echo.Context) (model.User, bool) {
+	if u, ok := c.Get("user").(requestUser); ok {
+		return u.user, u.signedIn
+	}
+	user, ok := findUser(c)
+	c.Set("user", requestUser{user, ok})
+	return user, ok
+}
+
+func findUser(c echo.Context) (model.User, bool) {
+	if secret, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer "); ok {
+		return tokenUser(strings.TrimSpace(secret))
+	}
+	if UserHeader == "" {
+		return model.User{}, false
+	}
+	name := strings.TrimSpace(c.Request().Header.Get(UserHeader))
+	if name == "" {
+		return model.User{}, false
+	}
+
+	email := ""
+	if UserEmailHeader != "" {
+		email = strings.TrimSpace(c.Request().Header.Get(UserEmailHeader))
+	}
+	if email == "" {
+		email = name + "@localhost"
+	}
+	user := model.User{Name: name, Email: email}
+	touchUser(user)
+	return user, true
+}
+
+// tokenUser is the owner of an api token, with the email they were last
+// seen with
+func tokenUser(secret string) (model.User, bool) {
+	store, err := GetStore()
+	if err != nil {
+		log.Println("token lookup failed:", err)
+		return model.User{}, false
+	}
+	token, err := store.Tokens().Lookup(secret)
+	if err != nil {
+		return model.User{}, false
+	}
+	user := model.User{Name: token.User, Email: token.User + "@localhost"}
+	if account, err := store.Users().Get(token.User); err == nil {
+		user.Email = account.Email
+	}
+	return user, true
+}
+
+func touchUser(user model.User) {
+	now := time.Now()
+	if last, ok := seenUsers.Load(user); ok && now.Sub(last.(time.Time)) < time.Minute {
+		return
+	}
+	seenUsers.Store(user, now)
+	store, err := GetStore()
+	if err == nil {
+		err = store.Users().Touch(user)
+	}
+	if err != nil {
+		log.Println("recording user failed:", user.Name, err)
+	}
+}
+
+func hasUser(names []string, user model.User) bool {
+	for _, name := range names {
+		if name == user.Name || name == user.Email {
+			return true
+		}
+	}
+	return false
+}
+
+// CanRead reports whether user may read the repo, an empty read role
+// lets everyone read. Writers can read.
+func CanRead(repo string, user model.User) bool {
+	roles := GetRepoConfig(repo).Roles
+	if len(roles.Read) == 0 {
+		return true
+	}
+	return user.Name != "" && (hasUser(roles.Read, user) || hasUser(roles.Write, user))
+}
+
+// CanWrite reports whether user may change the repo, an empty write
+// role lets every signed in reader write
+func CanWrite(repo string, user model.User) bool {
+	if user.Name == "" {
+		return false
+	}
+	writers := GetRepoConfig(repo).Roles.Write
+	if len(writers) == 0 {
+		return CanRead(repo, user)
+	}
+	return hasUser(writers, user)
+}
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	// RenderCacheSize is the number of rendered documents kept in memory
+	RenderCacheSize = 512
+	// RenderCacheDir enables the on-disk tier when not empty
+	RenderCacheDir = ""
+
+	renderCache = &lruCache{items: map[string]*list.Element{}, order: list.New()}
+)
+
+type cacheEntry struct {
+	key   string
+	value string
+}
+
+type lruCache struct {
+	lock  sync.Mutex
+	items map[string]*list.Element
+	order *list.List
+}
+
+func (c *lruCache) Get(key string) (string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.order.MoveToFront(elem)
+		return elem.Value.(*cacheEntry).value, true
+	}
+	return "", false
+}
+
+func (c *lruCache) Put(key, value string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*cacheEntry).value = value
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.order.PushFront(&cacheEntry{key, value})
+	for c.order.Len() > RenderCacheSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// BlobHash is the git object id of content stored as a blob
+func BlobHash(content []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func hashStrings(parts ...string) string {
+	h := sha1.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func cacheFile(key string) string {
+	return filepath.Join(RenderCacheDir, key[:2], key[2:]+".html")
+}
+
+// GetCache looks a rendered document up in memory, then on disk
+func GetCache(key string) (string, bool) {
+	if value, ok := renderCache.Get(key); ok {
+		return value, true
+	}
+	if RenderCacheDir == "" {
+		return "", false
+	}
+
+	data, err := os.ReadFile(cacheFile(key))
+	if err != nil {
+		return "", false
+	}
+	renderCache.Put(key, string(data))
+	return string(data), true
+}
+
+func PutCache(key, value string) {
+	renderCache.Put(key, value)
+	if RenderCacheDir == "" {
+		return
+	}
+
+	file := cacheFile(key)
+	if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		log.Println("render cache:", err)
+		return
+	}
+	if err := os.WriteFile(file, []byte(value), 0644); err != nil {
+		log.Println("render cache:", err)
+	}
+}
@@ -0,0 +1,191 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"regexp"
+
+	"github.com/scnon/md-doc/internal"
+	"github.com/scnon/md-doc/model"
+)
+
+// MaxQuoteLength bounds the passage a thread quotes, in runes
+const MaxQuoteLength = 1000
+
+var (
+	ErrNoAnchor    = errors.New("a thread needs a heading or a quote")
+	ErrNotThread   = errors.New("only threads can be resolved or replied to")
+	ErrQuoteLength = errors.New("the quote is too long")
+
+	// @name, not the domain of an email address
+	mentionRe = regexp.MustCompile(`(?:^|[^\w@.])@(\w(?:[\w.-]*\w)?)`)
+)
+
+// Mentions lists the users a comment mentions with @name
+func Mentions(body string) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, m := range mentionRe.FindAllStringSubmatch(body, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// GetComment reads a comment of a repo
+func GetComment(repo string, id int64) (*model.Comment, error) {
+	store, err := GetStore()
+	if err != nil {
+		return nil, err
+	}
+	c, err := store.Comments().Get(repo, id)
+	if err != nil {
+		return nil, err
+	}
+	c.Mentions = Mentions(c.Body)
+	return c, nil
+}
+
+// AddComment starts a thread on a document, or replies to one when
+// req.Parent is set
+func AddComment(req model.CommentReq, user model.User) (*model.Comment, error) {
+	c := model.Comment{Repo: req.Repo, Path: req.Path, Parent: req.Parent, Author: user, Body: req.Body}
+	if req.Parent != 0 {
+		parent, err := GetComment(req.Repo, req.Parent)
+		if err != nil {
+			return nil, err
+		}
+		if parent.Parent != 0 || parent.Path != req.Path {
+			return nil, ErrNotThread
+		}
+	} else {
+		content, err := GetFile(req.Repo, req.Path)
+		if err != nil {
+			return nil, err
+		}
+		c.Heading = req.Heading
+		c.Quote = internal.CollapseSpace(req.Quote)
+		c.Prefix, c.Suffix = internal.CollapseSpace(req.Prefix), internal.CollapseSpace(req.Suffix)
+		c.Blob = BlobHash(content)
+		if c.Quote == "" {
+			return nil, ErrNoAnchor
+		}
+		if len([]rune(c.Quote)) > MaxQuoteLength {
+			return nil, ErrQuoteLength
+		}
+	}
+
+	store, err := GetStore()
+	if err != nil {
+		return nil, err
+	}
+	c.Mentions = Mentions(c.Body)
+	if err := store.Comments().Create(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ResolveComment resolves or reopens a thread, its author and writers may
+func ResolveComment(repo string, id int64, resolved bool, user model.User) error {
+	c, err := GetComment(repo, id)
+	if err != nil {
+		return err
+	}
+	if c.Parent != 0 {
+		return ErrNotThread
+	}
+	if c.Author.Name != user.Name && !CanWrite(repo, user) {
+		return os.ErrPermission
+	}
+	store, err := GetStore()
+	if err != nil {
+		return err
+	}
+	return store.Comments().SetResolved(id, resolved)
+}
+
+// DocComments lists the threads on a document with their replies. Threads
+// made on an older version are attached to the passage their quote moved
+// to, or marked outdated when it is gone.
+func DocComments(repo, file string) ([]model.Comment, error) {
+	store, err := GetStore()
+	if err != nil {
+		return nil, err
+	}
+	comments, err := store.Comments().ListDoc(repo, file)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := GetFile(repo, file)
+	if err != nil {
+		return nil, err
+	}
+	blob := BlobHash(content)
+	var text string
+	var headings []internal.Heading
+	for _, c := range comments {
+		if c.Parent != 0 || c.Blob == blob {
+			continue
+		}
+		if text == "" {
+			text = internal.HTMLText(RenderDoc(repo, file, content))
+			headings = internal.Headings(file, expandDoc(repo, file, content))
+		}
+		reanchor(c, text, headings)
+		c.Blob = blob
+		if err := store.Comments().UpdateAnchor(c); err != nil {
+			return nil, err
+		}
+	}
+
+	var threads []model.Comment
+	index := map[int64]int{}
+	for _, c := range comments {
+		c.Mentions = Mentions(c.Body)
+		if c.Parent == 0 {
+			index[c.ID] = len(threads)
+			threads = append(threads, *c)
+		} else if i, ok := index[c.Parent]; ok {
+			threads[i].Replies = append(threads[i].Replies, *c)
+		}
+	}
+	return threads, nil
+}
+
+// reanchor finds the heading or passage of a thread in a new version of
+// its document, an outdated thread keeps its old quote
+func reanchor(c *model.Comment, text string, headings []internal.Heading) {
+	if c.Heading != "" {
+		h, ok := internal.MatchHeading(headings, c.Heading, c.Quote)
+		c.Outdated = !ok
+		if ok {
+			c.Heading, c.Quote = h.ID, internal.CollapseSpace(h.Text)
+		}
+		return
+	}
+	a, ok := internal.FindQuote(text, internal.Anchor{Quote: c.Quote, Prefix: c.Prefix, Suffix: c.Suffix})
+	c.Outdated = !ok
+	if ok {
+		c.Quote, c.Prefix, c.Suffix = a.Quote, a.Prefix, a.Suffix
+	}
+}
+
+// MentionedComments lists the latest comments that mention user
+func MentionedComments(user model.User, limit int) ([]model.Comment, error) {
+	store, err := GetStore()
+	if err != nil {
+		return nil, err
+	}
+	comments, err := store.Comments().Mentioning(user.Name, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range comments {
+		comments[i].Mentions = Mentions(comments[i].Body)
+	}
+	return comments, nil
+}
@@ -0,0 +1,396 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/scnon/md-doc/model"
+)
+
+var (
+	ErrNoChanges   = errors.New("nothing to commit")
+	ErrInvalidPath = errors.New("invalid path")
+	ErrExists      = errors.New("file exists")
+	ErrConfigPath  = errors.New("the repo config can only be changed by a push")
+
+	commitLocks sync.Map
+)
+
+// ConflictError is returned when a file changed since the edit started
+type ConflictError struct {
+	Path string
+	// Blob is the hash of the file now, empty when it was deleted
+	Blob string
+}
+
+func (e *ConflictError) Error() string {
+	return "conflict: " + e.Path + " was changed by someone else"
+}
+
+// FileChange is one file of a commit, Blob reuses a stored blob instead
+// of Content
+type FileChange struct {
+	Path    string
+	Content []byte
+	Blob    string
+	Delete  bool
+}
+
+// CommitOptions describes a commit made from the web
+type CommitOptions struct {
+	// Branch is committed to, empty is the branch HEAD points at
+	Branch string
+	// From is the commit a new branch starts at
+	From string
+	// Merge is the second parent of a merge commit
+	Merge string
+	// Base maps paths to the blob hashes the changes were made on, a
+	// different blob is a conflict. An empty hash means the file must
+	// not exist yet.
+	Base    map[string]string
+	Message string
+	Author  model.User
+}
+
+// CleanPath checks a path of a repo given by a user, it must stay in the
+// repo and must not touch .git
+func CleanPath(file string) (string, error) {
+	clean := path.Clean("/" + file)[1:]
+	if clean == "" {
+		return "", ErrInvalidPath
+	}
+	for _, part := range strings.Split(clean, "/") {
+		if part == ".git" {
+			return "", ErrInvalidPath
+		}
+	}
+	return clean, nil
+}
+
+// WritablePath checks a path of a repo the web writes to, the config dir
+// is left to pushes
+func WritablePath(file string) (string, error) {
+	clean, err := CleanPath(file)
+	if err != nil {
+		return "", err
+	}
+	if isConfigPath(clean) {
+		return "", ErrConfigPath
+	}
+	return clean, nil
+}
+
+func isConfigPath(file string) bool {
+	return file == ConfigDir || strings.HasPrefix(file, ConfigDir+"/")
+}
+
+func commitLock(repo string) *sync.Mutex {
+	lock, _ := commitLocks.LoadOrStore(repo, &sync.Mutex{})
+	return lock.(*sync.Mutex)
+}
+
+// CommitFiles commits changes to a branch of the bare repo and returns
+// the new commit. The branch only moves if nobody else moved it meanwhile.
+func CommitFiles(repo string, changes []FileChange, opts CommitOptions) (string, error) {
+	lock := commitLock(repo)
+	lock.Lock()
+	defer lock.Unlock()
+
+	r, err := git.PlainOpen(GetRepoPath(repo))
+	if err != nil {
+		return "", err
+	}
+
+	name := plumbing.NewBranchReferenceName(opts.Branch)
+	if opts.Branch == "" {
+		head, err := r.Storer.Reference(plumbing.HEAD)
+		if err != nil {
+			return "", err
+		}
+		name = head.Target()
+	}
+
+	var parent *object.Commit
+	var tree *object.Tree
+	old, err := r.Storer.Reference(name)
+	start := plumbing.NewHash(opts.From)
+	switch {
+	case err == plumbing.ErrReferenceNotFound:
+		old = nil
+	case err != nil:
+		return "", err
+	default:
+		start = old.Hash()
+	}
+	if !start.IsZero() {
+		if parent, err = r.CommitObject(start); err != nil {
+			return "", err
+		}
+		if tree, err = parent.Tree(); err != nil {
+			return "", err
+		}
+	}
+
+	for file, base := range opts.Base {
+		if current := treeBlob(tree, file); current != base {
+			return "", &ConflictError{Path: file, Blob: current}
+		}
+	}
+
+	byPath := map[string]*FileChange{}
+	for i := range changes {
+		file, err := WritablePath(changes[i].Path)
+		if err != nil {
+			return "", err
+		}
+		if !changes[i].Delete && pathTaken(tree, file) {
+			return "", ErrExists
+		}
+		byPath[file] = &changes[i]
+	}
+	treeHash, empty, err := writeTree(r.Storer, tree, byPath)
+	if err == nil && empty {
+		treeHash, err = writeObject(r.Storer, &object.Tree{})
+	}
+	if err != nil {
+		return "", err
+	}
+	if tree != nil && treeHash == tree.Hash && opts.Merge == "" {
+		return "", ErrNoChanges
+	}
+
+	when := time.Now()
+	signature := object.Signature{Name: opts.Author.Name, Email: opts.Author.Email, When: when}
+	commit := &object.Commit{
+		Author:    signature,
+		Committer: signature,
+		Message:   strings.TrimSpace(opts.Message) + "\n",
+		TreeHash:  treeHash,
+	}
+	if parent != nil {
+		commit.ParentHashes = []plumbing.Hash{parent.Hash}
+	}
+	if opts.Merge != "" {
+		commit.ParentHashes = append(commit.ParentHashes, plumbing.NewHash(opts.Merge))
+	}
+	hash, err := writeObject(r.Storer, commit)
+	if err != nil {
+		return "", err
+	}
+
+	if err := r.Storer.CheckAndSetReference(plumbing.NewHashReference(name, hash), old); err != nil {
+		return "", fmt.Errorf("update %s: %w", name.Short(), err)
+	}
+	return hash.String(), nil
+}
+
+// MoveBranch points branch at commit to, if it still is at from
+func MoveBranch(repo, branch, from, to string) error {
+	lock := commitLock(repo)
+	lock.Lock()
+	defer lock.Unlock()
+
+	r, err := git.PlainOpen(GetRepoPath(repo))
+	if err != nil {
+		return err
+	}
+	name := plumbing.NewBranchReferenceName(branch)
+	old := plumbing.NewHashReference(name, plumbing.NewHash(from))
+	if err := r.Storer.CheckAndSetReference(plumbing.NewHashReference(name, plumbing.NewHash(to)), old); err != nil {
+		return fmt.Errorf("update %s: %w", branch, err)
+	}
+	return nil
+}
+
+// ReadBranchFile reads a file and its blob hash at the tip of a branch
+// of the bare repo, empty branch is HEAD
+func ReadBranchFile(repo, branch, file string) ([]byte, string, error) {
+	tree, err := branchTree(repo, branch)
+	if err != nil {
+		return nil, "", err
+	}
+	if tree == nil {
+		return nil, "", os.ErrNotExist
+	}
+	f, err := tree.File(file)
+	if err == object.ErrFileNotFound {
+		return nil, "", os.ErrNotExist
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	content, err := f.Contents()
+	if err != nil {
+		return nil, "", err
+	}
+	return []byte(content), f.Hash.String(), nil
+}
+
+// branchTree is the tree at the tip of a branch, nil for an empty repo
+func branchTree(repo, branch string) (*object.Tree, error) {
+	r, err := git.PlainOpen(GetRepoPath(repo))
+	if err != nil {
+		return nil, err
+	}
+	name := plumbing.NewBranchReferenceName(branch)
+	if branch == "" {
+		name = plumbing.HEAD
+	}
+	ref, err := r.Reference(name, true)
+	if err == plumbing.ErrReferenceNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	commit, err := r.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, err
+	}
+	return commit.Tree()
+}
+
+// pathTaken reports whether a file can't be written at file, because it
+// is a directory or one of its parents is a file
+func pathTaken(tree *object.Tree, file string) bool {
+	if tree == nil {
+		return false
+	}
+	if entry, err := tree.FindEntry(file); err == nil && entry.Mode == filemode.Dir {
+		return true
+	}
+	for dir := path.Dir(file); dir != "."; dir = path.Dir(dir) {
+		if entry, err := tree.FindEntry(dir); err == nil && entry.Mode != filemode.Dir {
+			return true
+		}
+	}
+	return false
+}
+
+func treeBlob(tree *object.Tree, file string) string {
+	if tree == nil {
+		return ""
+	}
+	entry, err := tree.FindEntry(file)
+	if err != nil || !entry.Mode.IsFile() {
+		return ""
+	}
+	return entry.Hash.String()
+}
+
+type encoder interface {
+	Encode(plumbing.EncodedObject) error
+}
+
+func writeObject(s storer.EncodedObjectStorer, obj encoder) (plumbing.Hash, error) {
+	encoded := s.NewEncodedObject()
+	if err := obj.Encode(encoded); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return s.SetEncodedObject(encoded)
+}
+
+func writeBlob(s storer.EncodedObjectStorer, content []byte) (plumbing.Hash, error) {
+	obj := s.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if _, err := w.Write(content); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return s.SetEncodedObject(obj)
+}
+
+// writeTree stores tree with changes applied, paths relative to it.
+// Trees left empty are reported instead, git has no empty directories.
+func writeTree(s storer.EncodedObjectStorer, tree *object.Tree, changes map[string]*FileChange) (plumbing.Hash, bool, error) {
+	entries := map[string]object.TreeEntry{}
+	if tree != nil {
+		for _, entry := range tree.Entries {
+			entries[entry.Name] = entry
+		}
+	}
+
+	subdirs := map[string]map[string]*FileChange{}
+	for file, change := range changes {
+		if dir, rest, ok := strings.Cut(file, "/"); ok {
+			if subdirs[dir] == nil {
+				subdirs[dir] = map[string]*FileChange{}
+			}
+			subdirs[dir][rest] = change
+			continue
+		}
+		if change.Delete {
+			delete(entries, file)
+			continue
+		}
+		hash := plumbing.NewHash(change.Blob)
+		if change.Blob == "" {
+			var err error
+			if hash, err = writeBlob(s, change.Content); err != nil {
+				return plumbing.ZeroHash, false, err
+			}
+		}
+		mode := filemode.Regular
+		if entry, ok := entries[file]; ok && entry.Mode == filemode.Executable {
+			mode = entry.Mode
+		}
+		entries[file] = object.TreeEntry{Name: file, Mode: mode, Hash: hash}
+	}
+
+	for dir, sub := range subdirs {
+		var subtree *object.Tree
+		if entry, ok := entries[dir]; ok && entry.Mode == filemode.Dir {
+			t, err := object.GetTree(s, entry.Hash)
+			if err != nil {
+				return plumbing.ZeroHash, false, err
+			}
+			subtree = t
+		}
+		hash, empty, err := writeTree(s, subtree, sub)
+		if err != nil {
+			return plumbing.ZeroHash, false, err
+		}
+		if empty {
+			delete(entries, dir)
+		} else {
+			entries[dir] = object.TreeEntry{Name: dir, Mode: filemode.Dir, Hash: hash}
+		}
+	}
+
+	result := &object.Tree{}
+	for _, entry := range entries {
+		result.Entries = append(result.Entries, entry)
+	}
+	// git sorts directories as if their names ended in a slash
+	sortName := func(entry object.TreeEntry) string {
+		if entry.Mode == filemode.Dir {
+			return entry.Name + "/"
+		}
+		return entry.Name
+	}
+	sort.Slice(result.Entries, func(i, j int) bool {
+		return sortName(result.Entries[i]) < sortName(result.Entries[j])
+	})
+	if len(result.Entries) == 0 {
+		return plumbing.ZeroHash, true, nil
+	}
+	hash, err := writeObject(s, result)
+	return hash, false, err
+}
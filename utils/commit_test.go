@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/scnon/md-doc/model"
+)
+
+var testUser = model.User{Name: "alice", Email: "alice@localhost"}
+
+// testRepos creates empty bare repos under a temporary data dir, the
+// background syncs finish before it is removed
+func testRepos(t *testing.T, names ...string) {
+	t.Helper()
+	DataPath = t.TempDir() + "/"
+	t.Cleanup(syncs.Wait)
+	for _, name := range names {
+		if _, err := git.PlainInit(GetRepoPath(name), true); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func testCommit(t *testing.T, repo string, files map[string]string) string {
+	t.Helper()
+	var changes []FileChange
+	for file, content := range files {
+		changes = append(changes, FileChange{Path: file, Content: []byte(content)})
+	}
+	commit, err := CommitFiles(repo, changes, CommitOptions{Message: "test", Author: testUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return commit
+}
+
+func TestWritablePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+		err  error
+	}{
+		{"docs/a.md", "docs/a.md", nil},
+		{"/docs/../a.md", "a.md", nil},
+		{".md-docs/a.md", ".md-docs/a.md", nil},
+		{".md-doc/config.json", "", ErrConfigPath},
+		{".md-doc", "", ErrConfigPath},
+		{"docs/../.md-doc/templates/x.md", "", ErrConfigPath},
+		{"./.md-doc/config.json", "", ErrConfigPath},
+		{".git/config", "", ErrInvalidPath},
+		{"", "", ErrInvalidPath},
+	}
+	for _, test := range tests {
+		got, err := WritablePath(test.path)
+		if got != test.want || !errors.Is(err, test.err) {
+			t.Errorf("WritablePath(%q) = %q, %v, want %q, %v", test.path, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestCommitFilesConflicts(t *testing.T) {
+	testRepos(t, "conflicts")
+	testCommit(t, "conflicts", map[string]string{"a.md": "one\n", "b.md": "b\n"})
+	v1 := BlobHash([]byte("one\n"))
+
+	save := func(content, base string) error {
+		_, err := CommitFiles("conflicts", []FileChange{{Path: "a.md", Content: []byte(content)}}, CommitOptions{
+			Base:    map[string]string{"a.md": base},
+			Message: "edit",
+			Author:  testUser,
+		})
+		return err
+	}
+
+	if err := save("two\n", v1); err != nil {
+		t.Fatal(err)
+	}
+	v2 := BlobHash([]byte("two\n"))
+
+	// a second edit of the first version
+	var conflict *ConflictError
+	if err := save("three\n", v1); !errors.As(err, &conflict) || conflict.Blob != v2 || conflict.Path != "a.md" {
+		t.Errorf("edit of an old version: %v, want conflict with blob %s", err, v2)
+	}
+	// creating a file that exists
+	if err := save("new\n", ""); !errors.As(err, &conflict) || conflict.Blob != v2 {
+		t.Errorf("create over an existing file: %v", err)
+	}
+	if err := save("two\n", v2); !errors.Is(err, ErrNoChanges) {
+		t.Errorf("unchanged save: %v, want ErrNoChanges", err)
+	}
+
+	// an edit of a deleted file conflicts with an empty blob
+	_, err := CommitFiles("conflicts", []FileChange{{Path: "a.md", Delete: true}}, CommitOptions{
+		Base: map[string]string{"a.md": v2}, Message: "delete", Author: testUser,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := save("four\n", v2); !errors.As(err, &conflict) || conflict.Blob != "" {
+		t.Errorf("edit of a deleted file: %v, want conflict without blob", err)
+	}
+}
+
+func TestCommitFilesRefusesConfig(t *testing.T) {
+	testRepos(t, "config")
+	testCommit(t, "config", map[string]string{"a.md": "a\n"})
+	_, err := CommitFiles("config", []FileChange{{Path: ".md-doc/config.json", Content: []byte("{}")}}, CommitOptions{
+		Message: "config", Author: testUser,
+	})
+	if !errors.Is(err, ErrConfigPath) {
+		t.Errorf("commit to the config dir: %v, want ErrConfigPath", err)
+	}
+}
+
+func TestSaveDocSyncsFromDisk(t *testing.T) {
+	testRepos(t, "sync")
+	testCommit(t, "sync", map[string]string{"a.md": "# A\n"})
+	SyncRepo("sync")
+
+	if _, err := SaveDoc("sync", "a.md", []byte("# A\n\nsaved\n"), BlobHash([]byte("# A\n")), "", testUser); err != nil {
+		t.Fatal(err)
+	}
+	syncs.Wait()
+	data, err := os.ReadFile(GetGitPath("sync") + "a.md")
+	if err != nil || string(data) != "# A\n\nsaved\n" {
+		t.Errorf("checkout after save: %q, %v", data, err)
+	}
+}
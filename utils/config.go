@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/scnon/md-doc/internal"
+)
+
+var (
+	ConfigDir = ".md-doc"
+
+	// site wide highlight styles, repos may override them
+	LightTheme = internal.DefaultLightStyle
+	DarkTheme  = internal.DefaultDarkStyle
+)
+
+// Theme names the chroma styles used for light and dark color schemes
+type Theme struct {
+	Light string `json:"light"`
+	Dark  string `json:"dark"`
+}
+
+// Roles lists the users, by name or email, allowed to do something, they
+// come from the read and write settings of the repo
+type Roles struct {
+	// Read empty lets everyone read, signed in or not
+	Read  []string
+	Write []string
+}
+
+// RepoConfig is read from .md-doc/config.json in the repo checkout, anyone
+// who can push can change it so the security settings come from the
+// database
+type RepoConfig struct {
+	// Sanitize is the html policy: strict, iframe or trusted, the file may
+	// only pick a stricter one than the setting
+	Sanitize    string   `json:"sanitize"`
+	IframeHosts []string `json:"-"`
+	Theme       Theme    `json:"theme"`
+	LineNumbers bool     `json:"line_numbers"`
+	Roles       Roles    `json:"-"`
+	// SearchTags is a glob of the tags searchable besides the default
+	// branch, e.g. v*
+	SearchTags string `json:"search_tags"`
+}
+
+// settings of a repo kept in the database
+const (
+	SettingSanitize    = "sanitize"
+	SettingIframeHosts = "iframe_hosts"
+	SettingRead        = "read"
+	SettingWrite       = "write"
+)
+
+// RepoSettings are the settings a repo can have
+var RepoSettings = []string{SettingSanitize, SettingIframeHosts, SettingRead, SettingWrite}
+
+// sanitizeLevels orders the policies from the strictest
+var sanitizeLevels = map[string]int{
+	internal.SanitizeStrict:  0,
+	internal.SanitizeIframe:  1,
+	internal.SanitizeTrusted: 2,
+}
+
+func GetConfigPath(repo string) string {
+	return fmt.Sprint(GetGitPath(repo), ConfigDir, "/")
+}
+
+func defaultRepoConfig() RepoConfig {
+	return RepoConfig{
+		Theme: Theme{Light: LightTheme, Dark: DarkTheme},
+	}
+}
+
+func GetRepoConfig(repo string) RepoConfig {
+	config := readRepoConfig(repo)
+	settings := GetRepoSettings(repo)
+	config.Sanitize = sanitizePolicy(settings[SettingSanitize], config.Sanitize)
+	config.IframeHosts = splitSetting(settings[SettingIframeHosts])
+	config.Roles.Read = splitSetting(settings[SettingRead])
+	config.Roles.Write = splitSetting(settings[SettingWrite])
+	return config
+}
+
+func readRepoConfig(repo string) RepoConfig {
+	config := defaultRepoConfig()
+
+	data, err := os.ReadFile(fmt.Sprint(GetConfigPath(repo), "config.json"))
+	if err != nil {
+		return config
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return defaultRepoConfig()
+	}
+	if !internal.HasStyle(config.Theme.Light) {
+		config.Theme.Light = LightTheme
+	}
+	if !internal.HasStyle(config.Theme.Dark) {
+		config.Theme.Dark = DarkTheme
+	}
+
+	return config
+}
+
+// sanitizePolicy is the policy of the setting, strict when unset, or the
+// one of the repo file when it is stricter
+func sanitizePolicy(setting, file string) string {
+	policy := internal.SanitizeStrict
+	if _, ok := sanitizeLevels[setting]; ok {
+		policy = setting
+	}
+	if level, ok := sanitizeLevels[file]; ok && level < sanitizeLevels[policy] {
+		policy = file
+	}
+	return policy
+}
+
+// GetRepoSettings reads the settings of a repo, none when the database
+// can't be opened
+func GetRepoSettings(repo string) map[string]string {
+	store, err := GetStore()
+	if err != nil {
+		log.Println("settings:", err)
+		return nil
+	}
+	settings, err := store.Settings().List(repo)
+	if err != nil {
+		log.Println("settings:", err)
+		return nil
+	}
+	return settings
+}
+
+// SetRepoSetting checks and saves a setting of a repo, lists are comma
+// separated
+func SetRepoSetting(repo, name, value string) error {
+	switch name {
+	case SettingSanitize:
+		if _, ok := sanitizeLevels[value]; !ok {
+			return fmt.Errorf("unknown sanitize policy %q", value)
+		}
+	case SettingIframeHosts, SettingRead, SettingWrite:
+		value = strings.Join(splitSetting(value), ",")
+	default:
+		return fmt.Errorf("unknown setting %q", name)
+	}
+
+	store, err := GetStore()
+	if err != nil {
+		return err
+	}
+	return store.Settings().Set(repo, name, value)
+}
+
+func splitSetting(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/scnon/md-doc/internal"
+)
+
+func TestSanitizePolicy(t *testing.T) {
+	tests := []struct {
+		setting, file, want string
+	}{
+		{"", "", internal.SanitizeStrict},
+		{"", internal.SanitizeTrusted, internal.SanitizeStrict},
+		{"", internal.SanitizeIframe, internal.SanitizeStrict},
+		{"bogus", "", internal.SanitizeStrict},
+		{internal.SanitizeIframe, internal.SanitizeTrusted, internal.SanitizeIframe},
+		{internal.SanitizeIframe, internal.SanitizeStrict, internal.SanitizeStrict},
+		{internal.SanitizeTrusted, "", internal.SanitizeTrusted},
+		{internal.SanitizeTrusted, internal.SanitizeIframe, internal.SanitizeIframe},
+	}
+	for _, test := range tests {
+		if got := sanitizePolicy(test.setting, test.file); got != test.want {
+			t.Errorf("sanitizePolicy(%q, %q) = %q, want %q", test.setting, test.file, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/scnon/md-doc/storage"
+)
+
+var (
+	// DBDriver is sqlite or mysql, mysql when the MYSQL_* variables of
+	// docker-compose.yml are set
+	DBDriver = defaultDBDriver()
+	// DBPath is the sqlite database with the state that is not in the repos
+	DBPath = "./data/md-doc.db"
+	// DBDSN connects to mysql, built from the MYSQL_* variables when empty
+	DBDSN = ""
+)
+
+var (
+	store     storage.Store
+	storeErr  error
+	storeOnce sync.Once
+)
+
+func defaultDBDriver() string {
+	if os.Getenv("MYSQL_HOST") != "" {
+		return "mysql"
+	}
+	return "sqlite"
+}
+
+// OpenStore opens the configured database without migrating it
+func OpenStore() (storage.Store, error) {
+	if DBDriver == "mysql" {
+		return storage.OpenMySQL(DBDSN)
+	}
+	if DBPath != ":memory:" {
+		if err := os.MkdirAll(filepath.Dir(DBPath), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return storage.Open(DBDriver, DBPath)
+}
+
+// GetStore opens the database on first use and migrates its schema
+func GetStore() (storage.Store, error) {
+	storeOnce.Do(func() {
+		if store, storeErr = OpenStore(); storeErr != nil {
+			return
+		}
+		applied, err := store.Migrate()
+		for _, m := range applied {
+			log.Printf("database migrated to %d: %s", m.Version, m.Name)
+		}
+		storeErr = err
+	})
+	return store, storeErr
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"bytes"
+	"html/template"
+
+	"github.com/scnon/md-doc/internal"
+	"github.com/scnon/md-doc/model"
+)
+
+// Editable reports whether user may edit file in the browser, only text
+// documents small enough to show are
+func Editable(repo, file string, user model.User, content []byte) bool {
+	return CanWrite(repo, user) && EditableDoc(file, content)
+}
+
+// EditableDoc reports whether file can be edited in the browser by anyone,
+// users without write access propose their edits
+func EditableDoc(file string, content []byte) bool {
+	return IsDocFile(file) && int64(len(content)) <= SourceSizeLimit && internal.IsText(content)
+}
+
+// PreviewDoc renders unsaved content of a document like RenderDoc does,
+// without caching it
+func PreviewDoc(repo, file string, content []byte) string {
+	renderer, ok := internal.GetRenderer(file)
+	if !ok {
+		return internal.RenderSource(file, content, GetRawUrl(repo, file))
+	}
+
+	config := GetRepoConfig(repo)
+	html := renderer.Render(expandDoc(repo, file, content), renderOptions(repo, file, config, GetIndex(repo)))
+	return internal.Sanitize(html, config.Sanitize, config.IframeHosts)
+}
+
+// SaveDoc commits new content of a document edited from the blob base
+// and syncs the checkout in the background
+func SaveDoc(repo, file string, content []byte, base, message string, user model.User) (string, error) {
+	if message == "" {
+		message = "Update " + file
+	}
+	commit, err := CommitFiles(repo, []FileChange{{Path: file, Content: content}}, CommitOptions{
+		Base:    map[string]string{file: base},
+		Message: message,
+		Author:  user,
+	})
+	if err != nil {
+		return "", err
+	}
+	SyncRepoLater(repo)
+	return commit, nil
+}
+
+// RenderEditPage renders the editor of a document, base is the blob of
+// content. Edits go to proposal when it is set.
+func RenderEditPage(repo, file string, content []byte, base string, user model.User, proposal *model.Proposal) (string, error) {
+	tmpl, err := getTemplate("edit.html")
+	if err != nil {
+		return "", err
+	}
+
+	title := file
+	if doc, ok := GetIndex(repo).Docs[file]; ok {
+		title = doc.Title
+	}
+	var page bytes.Buffer
+	err = tmpl.Execute(&page, map[string]interface{}{
+		"Title":   title,
+		"Repo":    repo,
+		"Path":    file,
+		"Content": string(content),
+		"Preview": template.HTML(PreviewDoc(repo, file, content)),
+		"Blob":    base,
+		"DocUrl":  GetDocUrl(repo, file),
+		"Theme":   GetRepoConfig(repo).Theme,
+		"User":    user,
+		// users without write access can only propose
+		"CanCommit": proposal == nil && CanWrite(repo, user),
+		"Proposal":  proposal,
+		"Base":      "/",
+	})
+	if err != nil {
+		return "", err
+	}
+	return page.String(), nil
+}
+
+// RenderNewPage renders the form for a new document in dir
+func RenderNewPage(repo, dir string, user model.User) (string, error) {
+	tmpl, err := getTemplate("new.html")
+	if err != nil {
+		return "", err
+	}
+
+	prefix := ""
+	if dir != "" {
+		prefix = dir + "/"
+	}
+	var page bytes.Buffer
+	err = tmpl.Execute(&page, map[string]interface{}{
+		"Repo":      repo,
+		"Dir":       prefix,
+		"Templates": TemplateNames(DocTemplates(repo)),
+		"User":      user,
+		"Base":      "/",
+	})
+	if err != nil {
+		return "", err
+	}
+	return page.String(), nil
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/scnon/md-doc/internal"
+)
+
+// epubPath is the chapter a document becomes in a book
+func epubPath(file string) string {
+	return strings.TrimSuffix(file, path.Ext(file)) + ".xhtml"
+}
+
+// ExportEPUB writes the documents of target in sidebar order as an epub
+// book, target is a document, a directory or empty for the whole repo.
+// Images and media the documents show are embedded.
+func ExportEPUB(w io.Writer, repo, target string) error {
+	files, err := BookFiles(repo, target)
+	if err != nil {
+		return err
+	}
+	commit, date, err := GetCommit(repo)
+	if err != nil {
+		return err
+	}
+
+	index := GetIndex(repo)
+	inBook := map[string]bool{}
+	for _, file := range files {
+		inBook[file] = true
+	}
+	embedded := map[string]internal.EPUBResource{}
+
+	var chapters []internal.EPUBChapter
+	for _, file := range files {
+		content, err := GetFile(repo, file)
+		if err != nil {
+			return err
+		}
+		html := mapLinks(repo, file, RenderDoc(repo, file, content), func(to string, relative bool) (string, bool) {
+			if inBook[to] {
+				return RelativeUrl(file, epubPath(to)), true
+			}
+			if _, ok := index.Docs[to]; ok {
+				return "", false
+			}
+			if _, ok := embedded[to]; !ok {
+				t := AssetType(to, nil)
+				if !strings.HasPrefix(t, "image/") && !strings.HasPrefix(t, "audio/") && !strings.HasPrefix(t, "video/") {
+					return "", false
+				}
+				data, err := GetFile(repo, to)
+				if err != nil {
+					return "", false
+				}
+				embedded[to] = internal.EPUBResource{Path: to, MediaType: t, Data: data}
+			}
+			return RelativeUrl(file, to), true
+		})
+		chapters = append(chapters, internal.EPUBChapter{
+			Path:     epubPath(file),
+			Title:    index.Docs[file].Title,
+			HTML:     html,
+			Headings: internal.Headings(file, expandDoc(repo, file, content)),
+		})
+	}
+
+	var resources []internal.EPUBResource
+	for _, resource := range embedded {
+		resources = append(resources, resource)
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].Path < resources[j].Path })
+
+	var css strings.Builder
+	if err := internal.WriteChromaCSS(&css, GetRepoConfig(repo).Theme.Light); err != nil {
+		return err
+	}
+
+	return internal.WriteEPUB(w, chapters, resources, internal.EPUBOptions{
+		Title:      bookTitle(repo, target, files),
+		Identifier: "urn:md-doc:" + repo + ":" + commit,
+		Date:       date,
+		CSS:        css.String(),
+	})
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestExportEPUB(t *testing.T) {
+	testRepos(t, "book")
+	testCommit(t, "book", map[string]string{
+		"index.md":          "# Welcome\n\nRead the [guide](docs/guide.md#setup).\n",
+		"docs/guide.md":     "# Guide\n\n## Setup\n\n![diagram](img/flow.png) ![talk](/media/talk.mp3)\n\n[home](../index.md) [data](data.json)<br>\n",
+		"docs/img/flow.png": "png",
+		"media/talk.mp3":    "mp3",
+		"docs/data.json":    "{}",
+	})
+	SyncRepo("book")
+
+	var book bytes.Buffer
+	if err := ExportEPUB(&book, "book", ""); err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(book.Bytes()), int64(book.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first := r.File[0]; first.Name != "mimetype" || first.Method != zip.Store {
+		t.Errorf("first entry %s, method %d", first.Name, first.Method)
+	}
+	files := map[string]string{}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+
+	for name, want := range map[string]string{
+		"EPUB/content/index.xhtml":       `href="docs/guide.xhtml#setup"`,
+		"EPUB/content/docs/guide.xhtml":  `src="img/flow.png`,
+		"EPUB/content/docs/img/flow.png": "png",
+		"EPUB/content/media/talk.mp3":    "mp3",
+		"EPUB/nav.xhtml":                 `href="content/docs/guide.xhtml#setup"`,
+		"EPUB/package.opf":               `media-type="image/png"`,
+		"META-INF/container.xml":         "EPUB/package.opf",
+	} {
+		if !strings.Contains(files[name], want) {
+			t.Errorf("%s lacks %s: %s", name, want, files[name])
+		}
+	}
+	guide := files["EPUB/content/docs/guide.xhtml"]
+	for _, want := range []string{`href="../index.xhtml"`, `src="../media/talk.mp3`, "<br/>"} {
+		if !strings.Contains(guide, want) {
+			t.Errorf("guide lacks %s: %s", want, guide)
+		}
+	}
+	if _, ok := files["EPUB/content/docs/data.json"]; ok {
+		t.Error("non media file embedded")
+	}
+
+	// books of the same commit are identical
+	var again bytes.Buffer
+	if err := ExportEPUB(&again, "book", ""); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(book.Bytes(), again.Bytes()) {
+		t.Error("two exports of one commit differ")
+	}
+}
@@ -0,0 +1,397 @@
+package utils
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/scnon/md-doc/internal"
+)
+
+// ExportOptions describes a static export of a repo
+type ExportOptions struct {
+	Repo string
+	// Ref is a branch, tag or commit of the repo
+	Ref string
+	Out string
+	// BaseURL is where the site is published, sitemap urls are relative
+	// without it
+	BaseURL string
+}
+
+// SearchEntry is a document in the search index of an export
+type SearchEntry struct {
+	Path  string `json:"path"`
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+var linkAttrRegexp = regexp.MustCompile(`\b(href|src|data)="([^"]*)"`)
+
+// CheckoutRef checks ref of a repo out into a temporary directory and
+// points the data paths at it until cleanup is called. It changes
+// globals, so it is meant for commands, not for the server.
+func CheckoutRef(repo, ref string) (commit string, cleanup func(), err error) {
+	bare, err := filepath.Abs(GetRepoPath(repo))
+	if err != nil {
+		return "", nil, err
+	}
+	out, err := gitOutput(bare, "rev-parse", "--verify", ref+"^{commit}")
+	if err != nil {
+		return "", nil, fmt.Errorf("unknown ref %s: %w", ref, err)
+	}
+	commit = strings.TrimSpace(out)
+
+	tmp, err := os.MkdirTemp("", "md-doc-export-")
+	if err != nil {
+		return "", nil, err
+	}
+	dir := filepath.Join(tmp, "git", repo)
+	if _, err := gitOutput(tmp, "clone", "--quiet", "--no-checkout", bare, dir); err != nil {
+		os.RemoveAll(tmp)
+		return "", nil, err
+	}
+	if _, err := gitOutput(dir, "checkout", "--quiet", "--detach", commit); err != nil {
+		os.RemoveAll(tmp)
+		return "", nil, err
+	}
+
+	dataPath, repoPrefix, gitPrefix := DataPath, RepoPrefix, GitPrefix
+	DataPath, RepoPrefix, GitPrefix = tmp+"/", "git", "git"
+	dropIndex(repo)
+
+	return commit, func() {
+		DataPath, RepoPrefix, GitPrefix = dataPath, repoPrefix, gitPrefix
+		dropIndex(repo)
+		os.RemoveAll(tmp)
+	}, nil
+}
+
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return string(out), err
+}
+
+func dropIndex(repo string) {
+	indexLock.Lock()
+	delete(indexes, repo)
+	indexLock.Unlock()
+}
+
+// ExportPath is the file a document is exported to
+func ExportPath(file string) string {
+	return strings.TrimSuffix(file, path.Ext(file)) + ".html"
+}
+
+// RelativeUrl is the link from the page of file to target, both relative
+// to the site root
+func RelativeUrl(file, target string) string {
+	rel, err := filepath.Rel(filepath.FromSlash(path.Dir(file)), filepath.FromSlash(target))
+	if err != nil {
+		return target
+	}
+	return filepath.ToSlash(rel)
+}
+
+// ExportSite renders every document of a repo at a ref into a static
+// site. The output only depends on the commit, so exports of the same
+// commit are identical.
+func ExportSite(opts ExportOptions) error {
+	if entries, err := os.ReadDir(opts.Out); err == nil && len(entries) > 0 {
+		return errors.New("output directory is not empty: " + opts.Out)
+	}
+	if err := LoadTemplates(); err != nil {
+		return err
+	}
+
+	commit, cleanup, err := CheckoutRef(opts.Repo, opts.Ref)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	log.Println("export", opts.Repo, "at", commit)
+
+	repo := opts.Repo
+	at, err := ResolveRef(repo, commit)
+	if err != nil {
+		return err
+	}
+	index := UpdateIndex(repo)
+	root := GetGitPath(repo)
+	var search []SearchEntry
+
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// the config stays private, custom emoji are published
+		if strings.HasPrefix(rel, ConfigDir+"/") && !strings.HasPrefix(rel, ConfigDir+"/emoji/") {
+			return nil
+		}
+
+		doc, ok := index.Docs[rel]
+		if !ok {
+			return copyFile(p, filepath.Join(opts.Out, filepath.FromSlash(rel)))
+		}
+
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		page, err := exportPage(repo, at, rel, content)
+		if err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		search = append(search, SearchEntry{
+			Path:  ExportPath(rel),
+			Title: doc.Title,
+			Text:  internal.HTMLText(RenderDoc(repo, rel, content)),
+		})
+		return writeFile(filepath.Join(opts.Out, filepath.FromSlash(ExportPath(rel))), []byte(page))
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := exportStatic(repo, opts.Out); err != nil {
+		return err
+	}
+	if err := exportIndexPage(repo, opts.Out); err != nil {
+		return err
+	}
+
+	sort.Slice(search, func(i, j int) bool { return search[i].Path < search[j].Path })
+	data, err := json.Marshal(search)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(opts.Out, "search.json"), data); err != nil {
+		return err
+	}
+	return exportSitemap(repo, opts)
+}
+
+// exportPage renders a document of commit, its dates are shown in UTC so
+// the page is the same wherever it is exported
+func exportPage(repo string, commit *object.Commit, file string, content []byte) (string, error) {
+	created, updated, err := FileHistory(repo, commit, file)
+	if err != nil {
+		return "", err
+	}
+	author, createdAt, updatedAt := "unknown", "unknown", "unknown"
+	if updated != nil {
+		author = updated.Author.Name
+		createdAt = created.Date.UTC().Format(InfoTimeFormat)
+		updatedAt = updated.Date.UTC().Format(InfoTimeFormat)
+	}
+	page, err := RenderPage(repo, file, content, DocPage{
+		Author:  author,
+		Created: createdAt,
+		Updated: updatedAt,
+		Base:    strings.Repeat("../", strings.Count(file, "/")),
+		Export:  true,
+		DocUrl: func(to string) string {
+			return RelativeUrl(file, ExportPath(to))
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return rewriteLinks(repo, file, page), nil
+}
+
+// rewriteLinks points the server urls and the links between documents
+// of a page at the exported files
+func rewriteLinks(repo, file, page string) string {
+	index := GetIndex(repo)
+	return mapLinks(repo, file, page, func(target string, relative bool) (string, bool) {
+		if _, ok := index.Docs[target]; ok {
+			return RelativeUrl(file, ExportPath(target)), true
+		}
+		// relative links to other files are exported as they are
+		if relative {
+			return "", false
+		}
+		return RelativeUrl(file, target), true
+	})
+}
+
+// mapLinks passes the repo file each server url or relative link of a
+// page points at to link, which returns the new url or false to keep it
+func mapLinks(repo, file, page string, link func(target string, relative bool) (string, bool)) string {
+	return linkAttrRegexp.ReplaceAllStringFunc(page, func(attr string) string {
+		m := linkAttrRegexp.FindStringSubmatch(attr)
+		u, err := url.Parse(html.UnescapeString(m[2]))
+		if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+			return attr
+		}
+
+		var target string
+		for _, prefix := range []string{"/doc/", "/asset/", "/raw/"} {
+			if strings.HasPrefix(u.Path, prefix+repo+"/") {
+				target = strings.TrimPrefix(u.Path, prefix+repo+"/")
+			}
+		}
+		relative := false
+		switch {
+		case target != "":
+		case strings.HasPrefix(u.Path, "/"):
+			return attr
+		default:
+			target = path.Join(path.Dir(file), u.Path)
+			relative = true
+		}
+
+		to, ok := link(target, relative)
+		if !ok {
+			return attr
+		}
+		if u.Fragment != "" {
+			to += "#" + u.Fragment
+		}
+		return m[1] + `="` + html.EscapeString(to) + `"`
+	})
+}
+
+// exportStatic copies the stylesheets and scripts and writes the chroma
+// styles of the repo
+func exportStatic(repo, out string) error {
+	static := filepath.Join(out, "static")
+	err := filepath.WalkDir(TemplateDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasSuffix(p, ".html") {
+			return err
+		}
+		rel, err := filepath.Rel(TemplateDir, p)
+		if err != nil {
+			return err
+		}
+		return copyFile(p, filepath.Join(static, rel))
+	})
+	if err != nil {
+		return err
+	}
+
+	theme := GetRepoConfig(repo).Theme
+	for _, style := range []string{theme.Light, theme.Dark} {
+		var css strings.Builder
+		if err := internal.WriteChromaCSS(&css, style); err != nil {
+			return err
+		}
+		if err := writeFile(filepath.Join(static, "chroma", style+".css"), []byte(css.String())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportIndexPage sends visitors of the site root to the first document
+func exportIndexPage(repo, out string) error {
+	if _, err := os.Stat(filepath.Join(out, "index.html")); err == nil {
+		return nil
+	}
+	order := SidebarOrder(repo)
+	if len(order) == 0 {
+		return nil
+	}
+	first := html.EscapeString(ExportPath(order[0]))
+	page := fmt.Sprintf("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n"+
+		"<meta http-equiv=\"refresh\" content=\"0; url=%s\">\n</head>\n<body>\n<a href=\"%s\">%s</a>\n</body>\n</html>\n",
+		first, first, first)
+	return writeFile(filepath.Join(out, "index.html"), []byte(page))
+}
+
+type sitemapUrl struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemap struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Urls    []sitemapUrl `xml:"url"`
+}
+
+func exportSitemap(repo string, opts ExportOptions) error {
+	var files []string
+	for file := range GetIndex(repo).Docs {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	site := sitemap{Xmlns: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	base := strings.TrimSuffix(opts.BaseURL, "/")
+	for _, file := range files {
+		loc := ExportPath(file)
+		if base != "" {
+			loc = base + "/" + loc
+		}
+		entry := sitemapUrl{Loc: loc}
+		if modtime := GetFileModTime(repo, file); !modtime.IsZero() {
+			entry.LastMod = modtime.UTC().Format("2006-01-02")
+		}
+		site.Urls = append(site.Urls, entry)
+	}
+
+	data, err := xml.MarshalIndent(site, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(opts.Out, "sitemap.xml"), append([]byte(xml.Header), append(data, '\n')...))
+}
+
+func writeFile(file string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
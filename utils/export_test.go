@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readTree reads the files under dir by their relative paths
+func readTree(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+	files := map[string][]byte{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		files[rel], err = os.ReadFile(p)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestExportSiteReproducible(t *testing.T) {
+	testRepos(t, "site")
+	testCommit(t, "site", map[string]string{
+		"index.md":       "# Home\n\nSee [the guide](docs/guide.md).\n",
+		"docs/guide.md":  "# Guide\n\n![diagram](img/a.png) $x^2$\n",
+		"docs/img/a.png": "png",
+	})
+	commit, err := ResolveRef("site", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	templateDir, local := TemplateDir, time.Local
+	TemplateDir = "../static/"
+	defer func() { TemplateDir, time.Local = templateDir, local }()
+
+	// the exports run in different time zones
+	var exports []map[string][]byte
+	for _, zone := range []*time.Location{time.UTC, time.FixedZone("UTC+9", 9*3600)} {
+		time.Local = zone
+		out := t.TempDir()
+		if err := ExportSite(ExportOptions{Repo: "site", Ref: "HEAD", Out: out, BaseURL: "https://docs.example.com"}); err != nil {
+			t.Fatal(err)
+		}
+		exports = append(exports, readTree(t, out))
+	}
+
+	first, second := exports[0], exports[1]
+	if len(first) == 0 || len(first) != len(second) {
+		t.Fatalf("exported %d and %d files", len(first), len(second))
+	}
+	for file, data := range first {
+		if !bytes.Equal(data, second[file]) {
+			t.Errorf("%s differs between the exports", file)
+		}
+	}
+	page := string(first[filepath.Join("docs", "guide.html")])
+	if date := commit.Author.When.UTC().Format(InfoTimeFormat); !strings.Contains(page, date) {
+		t.Errorf("page lacks the UTC date %s", date)
+	}
+	for _, file := range []string{"index.html", "search.json", "sitemap.xml", filepath.Join("docs", "img", "a.png")} {
+		if _, ok := first[file]; !ok {
+			t.Errorf("%s not exported", file)
+		}
+	}
+}
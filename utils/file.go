@@ -1,5 +1,275 @@
 package utils
 
-func UpdateIndex(repo string) {
+import (
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 
+	"github.com/scnon/md-doc/internal"
+)
+
+// DocInfo is a document of a repo as seen by the index
+type DocInfo struct {
+	Path  string
+	Title string
+	// Links are the paths of the documents this one links to
+	Links []string
+}
+
+// RepoIndex holds the documents of a repo checkout and the link graph
+// between them
+type RepoIndex struct {
+	Repo      string
+	Docs      map[string]*DocInfo
+	Backlinks map[string][]string
+	// Emoji maps the custom emoji of .md-doc/emoji/ to their urls
+	Emoji map[string]string
+	// Assets are the blob hashes of the images and media, by path
+	Assets map[string]string
+	// Version changes when documents or emoji are added, moved or renamed
+	// and when an asset changes
+	Version string
+}
+
+var emojiExts = map[string]bool{".png": true, ".gif": true, ".jpg": true, ".jpeg": true, ".webp": true}
+
+var (
+	indexes   = map[string]*RepoIndex{}
+	indexLock sync.RWMutex
+)
+
+func IsDocFile(file string) bool {
+	_, ok := internal.GetRenderer(file)
+	return ok
+}
+
+// GetIndex returns the index of a repo, building it on first use
+func GetIndex(repo string) *RepoIndex {
+	indexLock.RLock()
+	index, ok := indexes[repo]
+	indexLock.RUnlock()
+	if ok {
+		return index
+	}
+
+	return UpdateIndex(repo)
+}
+
+// UpdateIndex rebuilds the index from the data/git/<repo> checkout
+func UpdateIndex(repo string) *RepoIndex {
+	index := &RepoIndex{
+		Repo:      repo,
+		Docs:      map[string]*DocInfo{},
+		Backlinks: map[string][]string{},
+		Emoji:     map[string]string{},
+		Assets:    map[string]string{},
+	}
+	contents := map[string][]byte{}
+
+	root := GetGitPath(repo)
+	filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if !IsDocFile(rel) && IsMediaFile(rel) {
+			if hash, err := AssetVersion(repo, rel); err == nil {
+				index.Assets[rel] = hash
+			}
+		}
+		if ext := strings.ToLower(path.Ext(rel)); path.Dir(rel) == ConfigDir+"/emoji" && emojiExts[ext] {
+			index.Emoji[strings.TrimSuffix(path.Base(rel), path.Ext(rel))] = index.AssetUrl(rel)
+			return nil
+		}
+		if !IsDocFile(rel) {
+			return nil
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return nil
+		}
+
+		contents[rel] = content
+		index.Docs[rel] = &DocInfo{Path: rel, Title: docTitle(rel, content)}
+		return nil
+	})
+
+	for file, content := range contents {
+		doc := index.Docs[file]
+		if !internal.IsMarkdown(file) {
+			continue
+		}
+		seen := map[string]bool{}
+		wiki, links := internal.ExtractLinks(content)
+		for _, target := range wiki {
+			if to, _, ok := index.ResolveWikiLink(file, target); ok && !seen[to] {
+				seen[to] = true
+				doc.Links = append(doc.Links, to)
+			}
+		}
+		for _, target := range links {
+			if to, ok := index.resolvePath(file, target); ok && !seen[to] {
+				seen[to] = true
+				doc.Links = append(doc.Links, to)
+			}
+		}
+		sort.Strings(doc.Links)
+		for _, to := range doc.Links {
+			if to != file {
+				index.Backlinks[to] = append(index.Backlinks[to], file)
+			}
+		}
+	}
+	for _, from := range index.Backlinks {
+		sort.Strings(from)
+	}
+
+	var names []string
+	for file, doc := range index.Docs {
+		names = append(names, file, doc.Title)
+	}
+	for name, url := range index.Emoji {
+		names = append(names, ":"+name+":", url)
+	}
+	for file, hash := range index.Assets {
+		names = append(names, file, hash)
+	}
+	sort.Strings(names)
+	index.Version = hashStrings(names...)
+
+	forgetAssetHashes(repo, index.Assets)
+
+	indexLock.Lock()
+	indexes[repo] = index
+	indexLock.Unlock()
+
+	log.Println("index updated:", repo, len(index.Docs), "docs")
+	return index
+}
+
+// docTitle is the title found by the renderer, or the file name
+func docTitle(file string, content []byte) string {
+	if r, ok := internal.GetRenderer(file); ok {
+		if title := r.Title(content); title != "" {
+			return title
+		}
+	}
+	return strings.TrimSuffix(path.Base(file), path.Ext(file))
+}
+
+// resolvePath resolves a relative link from a document to a document path
+func (index *RepoIndex) resolvePath(from, target string) (string, bool) {
+	if i := strings.IndexAny(target, "?#"); i >= 0 {
+		target = target[:i]
+	}
+	if target == "" {
+		return "", false
+	}
+
+	var file string
+	if strings.HasPrefix(target, "/") {
+		file = path.Clean(strings.TrimPrefix(target, "/"))
+	} else {
+		file = path.Join(path.Dir(from), target)
+	}
+	for _, candidate := range []string{file, file + ".md", file + ".markdown"} {
+		if _, ok := index.Docs[candidate]; ok {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// AssetUrl is the url of an image or media file, versioned by its blob
+// so browsers keep it until it changes
+func (index *RepoIndex) AssetUrl(file string) string {
+	if hash, ok := index.Assets[file]; ok {
+		return GetAssetUrl(index.Repo, file) + "?v=" + hash
+	}
+	return GetAssetUrl(index.Repo, file)
+}
+
+// resolveAsset finds the url of the image or media file a local src of
+// from points to
+func (index *RepoIndex) resolveAsset(from, src string) (string, bool) {
+	u, err := url.Parse(src)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.RawQuery != "" || u.Path == "" {
+		return "", false
+	}
+	var file string
+	if strings.HasPrefix(u.Path, "/") {
+		file = path.Clean(strings.TrimPrefix(u.Path, "/"))
+	} else {
+		file = path.Join(path.Dir(from), u.Path)
+	}
+	if _, ok := index.Assets[file]; !ok {
+		return "", false
+	}
+	if u.Fragment != "" {
+		return index.AssetUrl(file) + "#" + u.Fragment, true
+	}
+	return index.AssetUrl(file), true
+}
+
+// ResolveWikiLink finds the document a [[target]] points to, by path
+// from the repo root or the current directory, then by title, then by
+// file name. anchor is the heading id of a #heading suffix.
+func (index *RepoIndex) ResolveWikiLink(from, target string) (file, anchor string, ok bool) {
+	if i := strings.Index(target, "#"); i >= 0 {
+		anchor = internal.HeadingID(target[i+1:])
+		target = strings.TrimSpace(target[:i])
+	}
+	if target == "" {
+		return from, anchor, true
+	}
+
+	if file, ok := index.resolvePath("", target); ok {
+		return file, anchor, true
+	}
+	if file, ok := index.resolvePath(from, target); ok {
+		return file, anchor, true
+	}
+
+	var byTitle, byName []string
+	for _, doc := range index.Docs {
+		name := strings.TrimSuffix(path.Base(doc.Path), path.Ext(doc.Path))
+		if strings.EqualFold(doc.Title, target) {
+			byTitle = append(byTitle, doc.Path)
+		} else if strings.EqualFold(name, target) || strings.EqualFold(strings.ReplaceAll(name, "-", " "), target) {
+			byName = append(byName, doc.Path)
+		}
+	}
+	for _, found := range [][]string{byTitle, byName} {
+		if len(found) > 0 {
+			sort.Strings(found)
+			return found[0], anchor, true
+		}
+	}
+
+	return "", "", false
+}
+
+// GetBacklinks returns the documents linking to file
+func (index *RepoIndex) GetBacklinks(file string) []*DocInfo {
+	var docs []*DocInfo
+	for _, from := range index.Backlinks[file] {
+		docs = append(docs, index.Docs[from])
+	}
+	return docs
 }
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestResolveWikiLink(t *testing.T) {
+	testRepos(t, "wiki")
+	testCommit(t, "wiki", map[string]string{
+		"deploy.md":            "# Deployment Guide\n\nSee [[ops/runbook#Roll back]].\n",
+		"ops/runbook.md":       "# Runbook\n\n## Roll back\n\n[[Deployment Guide]] [[release-notes]]\n",
+		"ops/release-notes.md": "# Changes\n\n[guide](../deploy.md) [[Runbook]]\n",
+	})
+	SyncRepo("wiki")
+	index := UpdateIndex("wiki")
+
+	tests := []struct {
+		from, target string
+		file, anchor string
+		ok           bool
+	}{
+		{"deploy.md", "ops/runbook", "ops/runbook.md", "", true},
+		{"deploy.md", "ops/runbook.md#Roll back", "ops/runbook.md", "roll-back", true},
+		{"ops/runbook.md", "release-notes", "ops/release-notes.md", "", true},
+		{"deploy.md", "release notes", "ops/release-notes.md", "", true},
+		{"ops/runbook.md", "deployment guide", "deploy.md", "", true},
+		{"ops/runbook.md", "#Roll back", "ops/runbook.md", "roll-back", true},
+		{"deploy.md", "missing", "", "", false},
+	}
+	for _, test := range tests {
+		file, anchor, ok := index.ResolveWikiLink(test.from, test.target)
+		if file != test.file || anchor != test.anchor || ok != test.ok {
+			t.Errorf("ResolveWikiLink(%q, %q) = %q, %q, %v, want %q, %q, %v", test.from, test.target,
+				file, anchor, ok, test.file, test.anchor, test.ok)
+		}
+	}
+
+	backlinks := map[string]string{
+		"deploy.md":            "[ops/release-notes.md ops/runbook.md]",
+		"ops/runbook.md":       "[deploy.md ops/release-notes.md]",
+		"ops/release-notes.md": "[ops/runbook.md]",
+	}
+	for file, want := range backlinks {
+		var got []string
+		for _, doc := range index.GetBacklinks(file) {
+			got = append(got, doc.Path)
+		}
+		if fmt.Sprint(got) != want {
+			t.Errorf("backlinks of %s = %v, want %s", file, got, want)
+		}
+	}
+}
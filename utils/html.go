@@ -2,22 +2,209 @@ package utils
 
 import (
 	"bytes"
-	"text/template"
+	"crypto/sha1"
+	"encoding/hex"
+	"html/template"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/scnon/md-doc/model"
 )
 
-func RenderSearchItem(data []model.SearchItem) string {
-	tmpl, err := template.ParseFiles("./static/search_item.html")
+var (
+	// DevMode reparses the templates on every request
+	DevMode     = false
+	TemplateDir = "./static/"
+
+	templateNames   = []string{"doc.html", "edit.html", "new.html", "proposal.html", "proposals.html", "search.html", "search_item.html"}
+	templates       = map[string]*template.Template{}
+	templateVersion string
+	templateLock    sync.RWMutex
+)
+
+// LoadTemplates parses the page templates, it runs once at startup
+// unless DevMode is set
+func LoadTemplates() error {
+	loaded := map[string]*template.Template{}
+	h := sha1.New()
+	for _, name := range templateNames {
+		data, err := os.ReadFile(filepath.Join(TemplateDir, name))
+		if err != nil {
+			return err
+		}
+		tmpl, err := template.New(name).Parse(string(data))
+		if err != nil {
+			return err
+		}
+		loaded[name] = tmpl
+		h.Write(data)
+	}
+
+	templateLock.Lock()
+	templates = loaded
+	templateVersion = hex.EncodeToString(h.Sum(nil))
+	templateLock.Unlock()
+	return nil
+}
+
+func getTemplate(name string) (*template.Template, error) {
+	templateLock.RLock()
+	tmpl, ok := templates[name]
+	templateLock.RUnlock()
+	if ok && !DevMode {
+		return tmpl, nil
+	}
+
+	if err := LoadTemplates(); err != nil {
+		return nil, err
+	}
+	templateLock.RLock()
+	defer templateLock.RUnlock()
+	return templates[name], nil
+}
+
+func TemplateVersion() string {
+	templateLock.RLock()
+	defer templateLock.RUnlock()
+	return templateVersion
+}
+
+// highlightSnippet marks the matches in the snippet of a search result
+func highlightSnippet(res model.SearchResult) template.HTML {
+	snippet := []rune(res.Snippet)
+	var content strings.Builder
+	last := 0
+	for _, span := range res.Highlights {
+		content.WriteString(template.HTMLEscapeString(string(snippet[last:span.Start])))
+		content.WriteString(`<span class="search_item_highlight">`)
+		content.WriteString(template.HTMLEscapeString(string(snippet[span.Start:span.End])))
+		content.WriteString("</span>")
+		last = span.End
+	}
+	content.WriteString(template.HTMLEscapeString(string(snippet[last:])))
+	return template.HTML(content.String())
+}
+
+// SearchGroup is the search results of a repo
+type SearchGroup struct {
+	Repo  string
+	Total int
+	Items []model.SearchItem
+}
+
+// groupResults groups the results of a page by repo, in the order of
+// their best results
+func groupResults(res *model.SearchResults) []*SearchGroup {
+	groups := map[string]*SearchGroup{}
+	var order []*SearchGroup
+	for _, r := range res.Results {
+		group, ok := groups[r.Repo]
+		if !ok {
+			group = &SearchGroup{Repo: r.Repo}
+			groups[r.Repo] = group
+			order = append(order, group)
+		}
+		heading := r.Heading
+		if heading == r.Title {
+			heading = ""
+		}
+		group.Items = append(group.Items, model.SearchItem{
+			Title:   r.Title,
+			Heading: heading,
+			URL:     r.URL,
+			Content: highlightSnippet(r),
+			Class:   "search_item",
+		})
+	}
+	for _, repo := range res.Repos {
+		if group, ok := groups[repo.Repo]; ok {
+			group.Total = repo.Total
+		}
+	}
+	return order
+}
+
+// GetSearchUrl is the search page of a query
+func GetSearchUrl(key string) string {
+	return "/search?q=" + url.QueryEscape(key)
+}
+
+// RenderSearchItems renders search results for the search popup grouped
+// by repo, with the matches in their snippets marked
+func RenderSearchItems(res *model.SearchResults, showRepo bool) string {
+	tmpl, err := getTemplate("search_item.html")
 	if err != nil {
 		return ""
 	}
 
+	groups := groupResults(res)
+	if n := len(groups); n > 0 && !res.More {
+		items := groups[n-1].Items
+		items[len(items)-1].Class = "search_item_last"
+	}
+
 	var reader bytes.Buffer
 	tmpl.Execute(&reader, map[string]interface{}{
-		"Data": data,
-		"Last": len(data) - 1,
+		"Groups":   groups,
+		"ShowRepo": showRepo,
+		"More":     res.More,
+		"MoreUrl":  GetSearchUrl(res.Key),
 	})
 
 	return reader.String()
 }
+
+// RenderSearchPage renders a page of the results of a search
+func RenderSearchPage(req model.SearchReq, res *model.SearchResults) (string, error) {
+	tmpl, err := getTemplate("search.html")
+	if err != nil {
+		return "", err
+	}
+
+	page := func(offset int) string {
+		query := url.Values{"q": {req.Key}}
+		for name, value := range map[string]string{"repo": req.Repo, "ref": req.Ref, "path": req.Path, "tag": req.Tag, "author": req.Author} {
+			if value != "" {
+				query.Set(name, value)
+			}
+		}
+		if offset > 0 {
+			query.Set("offset", strconv.Itoa(offset))
+		}
+		return "/search?" + query.Encode()
+	}
+	var prev, next string
+	if req.Offset > 0 {
+		prev = page(maxInt(0, req.Offset-req.Limit))
+	}
+	if res.More {
+		next = page(req.Offset + req.Limit)
+	}
+
+	var reader bytes.Buffer
+	err = tmpl.Execute(&reader, map[string]interface{}{
+		"Req":    req,
+		"Res":    res,
+		"Groups": groupResults(res),
+		"First":  res.Offset + 1,
+		"Last":   res.Offset + len(res.Results),
+		"Prev":   prev,
+		"Next":   next,
+		"Base":   "/",
+	})
+	if err != nil {
+		return "", err
+	}
+	return reader.String(), nil
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// the database is opened once, the tests share one in a temporary dir
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "md-doc-test")
+	if err != nil {
+		panic(err)
+	}
+	DBPath = filepath.Join(dir, "md-doc.db")
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
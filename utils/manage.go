@@ -0,0 +1,291 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/scnon/md-doc/internal"
+	"github.com/scnon/md-doc/model"
+)
+
+var (
+	// UploadSizeLimit is the largest file that can be uploaded
+	UploadSizeLimit int64 = 10 << 20
+	// AssetDir holds the images uploaded from the web
+	AssetDir = "assets"
+)
+
+// DefaultTemplate is used for new documents when the repo has none in
+// .md-doc/templates/
+const DefaultTemplate = "# {{title}}\n"
+
+// DocTemplates lists the templates for new documents by name, from
+// .md-doc/templates/*.md
+func DocTemplates(repo string) map[string]string {
+	templates := map[string]string{"blank": DefaultTemplate}
+	dir := GetConfigPath(repo) + "templates/"
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return templates
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !internal.IsMarkdown(entry.Name()) {
+			continue
+		}
+		data, err := os.ReadFile(dir + entry.Name())
+		if err != nil {
+			continue
+		}
+		templates[strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))] = string(data)
+	}
+	return templates
+}
+
+// TemplateNames are the template names in order, blank first
+func TemplateNames(templates map[string]string) []string {
+	var names []string
+	for name := range templates {
+		if name != "blank" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append([]string{"blank"}, names...)
+}
+
+// CreateDoc commits a new document from a template
+func CreateDoc(repo, file, template, title string, user model.User) (string, error) {
+	content, ok := DocTemplates(repo)[template]
+	if !ok {
+		return "", fmt.Errorf("unknown template %s", template)
+	}
+	if title == "" {
+		title = strings.TrimSuffix(path.Base(file), path.Ext(file))
+	}
+	content = strings.NewReplacer(
+		"{{title}}", title,
+		"{{date}}", time.Now().Format("2006-01-02"),
+		"{{author}}", user.Name,
+	).Replace(content)
+
+	commit, err := CommitFiles(repo, []FileChange{{Path: file, Content: []byte(content)}}, CommitOptions{
+		Base:    map[string]string{file: ""},
+		Message: "Create " + file,
+		Author:  user,
+	})
+	var conflict *ConflictError
+	if errors.As(err, &conflict) {
+		return "", ErrExists
+	}
+	if err != nil {
+		return "", err
+	}
+	SyncRepoLater(repo)
+	return commit, nil
+}
+
+// UploadAsset commits an uploaded file into the asset directory, a
+// number is added to names already taken. It returns the path.
+func UploadAsset(repo, name string, data []byte, user model.User) (string, error) {
+	name = path.Base(path.Clean("/" + name))
+	if name == "/" || strings.HasPrefix(name, ".") {
+		return "", ErrInvalidPath
+	}
+	ext := path.Ext(name)
+	for i := 0; i < 100; i++ {
+		file := AssetDir + "/" + name
+		if i > 0 {
+			file = fmt.Sprintf("%s/%s-%d%s", AssetDir, strings.TrimSuffix(name, ext), i, ext)
+		}
+		_, err := CommitFiles(repo, []FileChange{{Path: file, Content: data}}, CommitOptions{
+			Base:    map[string]string{file: ""},
+			Message: "Upload " + file,
+			Author:  user,
+		})
+		var conflict *ConflictError
+		if errors.As(err, &conflict) || err == ErrExists {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		SyncRepoLater(repo)
+		return file, nil
+	}
+	return "", ErrExists
+}
+
+// DeleteDoc commits the removal of a file, base is the blob it was
+// deleted from
+func DeleteDoc(repo, file, base string, user model.User) (string, error) {
+	commit, err := CommitFiles(repo, []FileChange{{Path: file, Delete: true}}, CommitOptions{
+		Base:    map[string]string{file: base},
+		Message: "Delete " + file,
+		Author:  user,
+	})
+	if err != nil {
+		return "", err
+	}
+	SyncRepoLater(repo)
+	return commit, nil
+}
+
+// MoveDoc renames a file in one commit, relative links of the markdown
+// documents pointing at it, and those of the file itself, are updated
+func MoveDoc(repo, from, to, base string, user model.User) (string, error) {
+	blobs, contents, err := readBranchFiles(repo, "", internal.IsMarkdown)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := blobs[to]; ok {
+		return "", ErrExists
+	}
+	blob, ok := blobs[from]
+	if !ok {
+		return "", os.ErrNotExist
+	}
+
+	data, err := readBlob(repo, blob)
+	if err != nil {
+		return "", err
+	}
+	changes := []FileChange{{Path: from, Delete: true}, {Path: to, Content: data}}
+	bases := map[string]string{from: base, to: ""}
+
+	exists := func(file string) bool {
+		_, ok := blobs[file]
+		return ok
+	}
+	for file, source := range contents {
+		if isConfigPath(file) {
+			continue
+		}
+		moved := file == from
+		rewritten := internal.RewriteLinks(source, func(dest string) (string, bool) {
+			return moveLink(dest, file, from, to, exists)
+		})
+		if string(rewritten) == string(source) {
+			continue
+		}
+		if moved {
+			changes[1].Content = rewritten
+			continue
+		}
+		changes = append(changes, FileChange{Path: file, Content: rewritten})
+		bases[file] = blobs[file]
+	}
+
+	commit, err := CommitFiles(repo, changes, CommitOptions{
+		Base:    bases,
+		Message: fmt.Sprintf("Move %s to %s", from, to),
+		Author:  user,
+	})
+	if err != nil {
+		return "", err
+	}
+	SyncRepoLater(repo)
+	return commit, nil
+}
+
+// moveLink rewrites a link dest of file for the move of from to to, exists
+// tells the files of the repo. Links are resolved like the index does,
+// extensionless links name documents. Relative links of the moved file
+// itself are kept pointing at their targets.
+func moveLink(dest, file, from, to string, exists func(file string) bool) (string, bool) {
+	target, suffix := dest, ""
+	if i := strings.IndexAny(dest, "?#"); i >= 0 {
+		target, suffix = dest[:i], dest[i:]
+	}
+	if target == "" || strings.Contains(target, ":") {
+		return "", false
+	}
+	moved := file == from
+	newFile := file
+	if moved {
+		newFile = to
+	}
+
+	absolute := strings.HasPrefix(target, "/")
+	resolved := path.Join(path.Dir(file), target)
+	if absolute {
+		resolved = path.Clean(strings.TrimPrefix(target, "/"))
+	}
+	found := resolved
+	for _, candidate := range []string{resolved, resolved + ".md", resolved + ".markdown"} {
+		if exists(candidate) {
+			found = candidate
+			break
+		}
+	}
+	if found != from && (!moved || absolute) {
+		return "", false
+	}
+
+	newTarget := found
+	if found == from {
+		newTarget = to
+		// keep links without extension without one
+		if found != resolved && path.Ext(to) == path.Ext(from) {
+			newTarget = strings.TrimSuffix(to, path.Ext(to))
+		}
+	} else if found != resolved {
+		newTarget = resolved
+	}
+	if absolute {
+		return "/" + newTarget + suffix, true
+	}
+	return RelativeUrl(newFile, newTarget) + suffix, true
+}
+
+// readBranchFiles lists the blobs of the files at the tip of a branch and
+// reads the files matching match
+func readBranchFiles(repo, branch string, match func(file string) bool) (map[string]string, map[string][]byte, error) {
+	tree, err := branchTree(repo, branch)
+	if err != nil {
+		return nil, nil, err
+	}
+	blobs := map[string]string{}
+	contents := map[string][]byte{}
+	if tree == nil {
+		return blobs, contents, nil
+	}
+	err = tree.Files().ForEach(func(f *object.File) error {
+		blobs[f.Name] = f.Hash.String()
+		if !match(f.Name) {
+			return nil
+		}
+		content, err := f.Contents()
+		if err != nil {
+			return err
+		}
+		contents[f.Name] = []byte(content)
+		return nil
+	})
+	return blobs, contents, err
+}
+
+func readBlob(repo, hash string) ([]byte, error) {
+	r, err := git.PlainOpen(GetRepoPath(repo))
+	if err != nil {
+		return nil, err
+	}
+	blob, err := r.BlobObject(plumbing.NewHash(hash))
+	if err != nil {
+		return nil, err
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestMoveLink(t *testing.T) {
+	files := map[string]bool{"docs/a.md": true, "docs/guide.md": true, "img/x.png": true, "other.md": true}
+	exists := func(file string) bool { return files[file] }
+	from, to := "docs/guide.md", "manual/guide.md"
+
+	tests := []struct {
+		file, dest string
+		want       string
+		ok         bool
+	}{
+		{"docs/a.md", "guide.md", "../manual/guide.md", true},
+		{"docs/a.md", "./guide.md", "../manual/guide.md", true},
+		{"docs/a.md", "guide", "../manual/guide", true},
+		{"docs/a.md", "guide.md#setup", "../manual/guide.md#setup", true},
+		{"docs/a.md", "guide#setup", "../manual/guide#setup", true},
+		{"docs/a.md", "../docs/guide.md", "../manual/guide.md", true},
+		{"other.md", "docs/guide.md", "manual/guide.md", true},
+		{"other.md", "/docs/guide.md", "/manual/guide.md", true},
+		{"other.md", "/docs/guide", "/manual/guide", true},
+		{"docs/a.md", "https://example.com/docs/guide.md", "", false},
+		{"docs/a.md", "other.md", "", false},
+		{"docs/a.md", "#top", "", false},
+		{"docs/a.md", "../x", "", false},
+		// links of the moved document keep their targets
+		{"docs/guide.md", "a.md", "../docs/a.md", true},
+		{"docs/guide.md", "a#intro", "../docs/a#intro", true},
+		{"docs/guide.md", "../img/x.png", "../img/x.png", true},
+		{"docs/guide.md", "../x", "../x", true},
+		{"docs/guide.md", "guide.md#top", "guide.md#top", true},
+		{"docs/guide.md", "/img/x.png", "", false},
+		{"docs/guide.md", "#top", "", false},
+	}
+	for _, test := range tests {
+		got, ok := moveLink(test.dest, test.file, from, to, exists)
+		if got != test.want || ok != test.ok {
+			t.Errorf("moveLink(%q) in %s = %q, %v, want %q, %v", test.dest, test.file, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestMoveDoc(t *testing.T) {
+	testRepos(t, "move")
+	testCommit(t, "move", map[string]string{
+		"docs/a.md":     "[guide](guide.md) `[guide](guide.md)`\n\n```\n[guide](guide.md)\n```\n",
+		"docs/guide.md": "# Guide\n\n[a](a.md) [self](#top)\n",
+		"other.md":      "[guide](/docs/guide)\n",
+	})
+	blob := BlobHash([]byte("# Guide\n\n[a](a.md) [self](#top)\n"))
+	if _, err := MoveDoc("move", "docs/guide.md", "manual/guide.md", blob, testUser); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"docs/a.md":       "[guide](../manual/guide.md) `[guide](guide.md)`\n\n```\n[guide](guide.md)\n```\n",
+		"manual/guide.md": "# Guide\n\n[a](../docs/a.md) [self](#top)\n",
+		"other.md":        "[guide](/manual/guide)\n",
+	}
+	for file, content := range want {
+		got, _, _, err := ReadRefFile("move", "", file)
+		if err != nil || string(got) != content {
+			t.Errorf("%s = %q, %v, want %q", file, got, err, content)
+		}
+	}
+	if _, _, _, err := ReadRefFile("move", "", "docs/guide.md"); err == nil {
+		t.Error("moved document still at its old path")
+	}
+}
@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scnon/md-doc/internal"
+)
+
+// PDFFontDir holds the DejaVu fonts for pdfs, the usual system
+// directories are searched when it is empty
+var PDFFontDir = ""
+
+var pdfFontDirs = []string{
+	"/usr/share/fonts/truetype/dejavu",
+	"/usr/share/fonts/dejavu",
+	"/usr/share/fonts/TTF",
+	"/usr/local/share/fonts",
+	"/Library/Fonts",
+}
+
+func findFontDir() string {
+	if PDFFontDir != "" {
+		return PDFFontDir
+	}
+	for _, dir := range pdfFontDirs {
+		if _, err := os.Stat(filepath.Join(dir, "DejaVuSans.ttf")); err == nil {
+			return dir
+		}
+	}
+	return ""
+}
+
+// GetCommit is the hash and time of the commit the checkout of a repo is
+// at, the documents are read from it
+func GetCommit(repo string) (string, time.Time, error) {
+	out, err := gitOutput(GetGitPath(repo), "log", "-1", "--format=%H %ct", "HEAD")
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return "", time.Time{}, errors.New("no commits")
+	}
+	sec, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return fields[0], time.Unix(sec, 0), nil
+}
+
+// BookFiles lists the documents of target in sidebar order, target is a
+// document, a directory or empty for the whole repo
+func BookFiles(repo, target string) ([]string, error) {
+	target = strings.Trim(path.Clean("/"+target), "/")
+	if _, ok := GetIndex(repo).Docs[target]; ok {
+		return []string{target}, nil
+	}
+
+	var files []string
+	for _, file := range SidebarOrder(repo) {
+		if target == "" || strings.HasPrefix(file, target+"/") {
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no documents in " + target)
+	}
+	return files, nil
+}
+
+// bookTitle is the title of a single document, or the name of the
+// directory or repo of a book
+func bookTitle(repo, target string, files []string) string {
+	if len(files) == 1 && files[0] == strings.Trim(target, "/") {
+		return GetIndex(repo).Docs[files[0]].Title
+	}
+	if target = strings.Trim(target, "/"); target != "" {
+		return path.Base(target)
+	}
+	return repo
+}
+
+// ExportPDF writes a document, or the documents of a directory as a
+// book, as pdf
+func ExportPDF(w io.Writer, repo, target string) error {
+	files, err := BookFiles(repo, target)
+	if err != nil {
+		return err
+	}
+	commit, date, err := GetCommit(repo)
+	if err != nil {
+		return err
+	}
+	// the checkout may be pulled meanwhile, the footer names the commit
+	// everything is read from
+	at, err := ResolveRef(repo, commit)
+	if err != nil {
+		return err
+	}
+	read := commitReader(at)
+
+	index := GetIndex(repo)
+	var sections []internal.PDFSection
+	for _, file := range files {
+		content, err := read(file)
+		if err != nil {
+			return err
+		}
+		sections = append(sections, internal.PDFSection{
+			File:    file,
+			Title:   index.Docs[file].Title,
+			Content: expandDocAt(repo, at, file, content),
+		})
+	}
+
+	subtitle := repo
+	if target = strings.Trim(target, "/"); target != "" {
+		subtitle += " / " + target
+	}
+	return internal.RenderPDF(w, sections, read, internal.PDFOptions{
+		Title:    bookTitle(repo, target, files),
+		Subtitle: subtitle,
+		Commit:   commit,
+		Date:     date,
+		FontDir:  findFontDir(),
+	})
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestExportPDFReadsOneCommit(t *testing.T) {
+	testRepos(t, "book")
+	synced := testCommit(t, "book", map[string]string{
+		"guide.md": "# Guide\n\n{{< include \"part.md\" >}}\n",
+		"part.md":  "Part one.\n",
+	})
+	SyncRepo("book")
+	// pushed, the checkout is not pulled yet
+	pushed := testCommit(t, "book", map[string]string{"part.md": "Part two.\n"})
+
+	commit, _, err := GetCommit("book")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit != synced || commit == pushed {
+		t.Errorf("commit %s, want the checkout at %s", commit, synced)
+	}
+
+	// the documents come from the commit, not from the files of the checkout
+	if err := os.Remove(GetGitPath("book") + "guide.md"); err != nil {
+		t.Fatal(err)
+	}
+	var pdf bytes.Buffer
+	if err := ExportPDF(&pdf, "book", "guide.md"); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(pdf.Bytes(), []byte("%PDF-")) {
+		t.Errorf("no pdf: %.20q", pdf.Bytes())
+	}
+}
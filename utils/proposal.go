@@ -0,0 +1,542 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/scnon/md-doc/internal"
+	"github.com/scnon/md-doc/model"
+)
+
+var (
+	ErrNotOpen     = errors.New("the proposal is not open")
+	ErrNotApproved = errors.New("the latest changes of the proposal are not approved")
+	ErrSelfApprove = errors.New("authors can't approve their own proposal")
+)
+
+// MergeConflictError lists the files changed on both sides of a merge
+type MergeConflictError struct {
+	Paths []string
+}
+
+func (e *MergeConflictError) Error() string {
+	return "merge conflict in " + strings.Join(e.Paths, ", ")
+}
+
+// ProposalFile is a file changed by a proposal
+type ProposalFile struct {
+	Path string
+	// Status is added, modified or deleted
+	Status string
+	// Diff is the rendered diff of documents, empty for other files
+	Diff template.HTML
+}
+
+// DefaultBranch is the branch HEAD of the bare repo points at
+func DefaultBranch(repo string) (string, error) {
+	r, err := git.PlainOpen(GetRepoPath(repo))
+	if err != nil {
+		return "", err
+	}
+	head, err := r.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return "", err
+	}
+	return head.Target().Short(), nil
+}
+
+func branchCommit(repo, branch string) (*object.Commit, error) {
+	r, err := git.PlainOpen(GetRepoPath(repo))
+	if err != nil {
+		return nil, err
+	}
+	ref, err := r.Reference(plumbing.NewBranchReferenceName(branch), true)
+	if err != nil {
+		return nil, err
+	}
+	return r.CommitObject(ref.Hash())
+}
+
+// GetProposal reads a proposal of a repo
+func GetProposal(repo string, id int64) (*model.Proposal, error) {
+	store, err := GetStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.Proposals().Get(repo, id)
+}
+
+// ListProposals lists the proposals of a repo, newest first
+func ListProposals(repo string) ([]*model.Proposal, error) {
+	store, err := GetStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.Proposals().List(repo)
+}
+
+// CreateProposal commits an edit of a document to a new branch started
+// from the tip of the default branch
+func CreateProposal(repo, file string, content []byte, base, title, message string, user model.User) (*model.Proposal, error) {
+	store, err := GetStore()
+	if err != nil {
+		return nil, err
+	}
+	target, err := DefaultBranch(repo)
+	if err != nil {
+		return nil, err
+	}
+	tip, err := branchCommit(repo, target)
+	if err != nil {
+		return nil, err
+	}
+	if title == "" {
+		title = "Update " + file
+	}
+
+	p := &model.Proposal{Repo: repo, Target: target, Title: title, Description: message, Author: user, Status: model.ProposalOpen}
+	proposals := store.Proposals()
+	if err := proposals.Create(p); err != nil {
+		return nil, err
+	}
+
+	p.Branch = fmt.Sprintf("proposals/%d", p.ID)
+	if message == "" {
+		message = title
+	}
+	_, err = CommitFiles(repo, []FileChange{{Path: file, Content: content}}, CommitOptions{
+		Branch:  p.Branch,
+		From:    tip.Hash.String(),
+		Base:    map[string]string{file: base},
+		Message: message,
+		Author:  user,
+	})
+	if err != nil {
+		proposals.Delete(p.ID)
+		return nil, err
+	}
+	if err := proposals.SetBranch(p.ID, p.Branch); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// CanChangeProposal reports whether user may add edits to or close p
+func CanChangeProposal(p *model.Proposal, user model.User) bool {
+	return p.Author.Name == user.Name || CanWrite(p.Repo, user)
+}
+
+// AddToProposal commits another edit to the branch of an open proposal
+func AddToProposal(p *model.Proposal, file string, content []byte, base, message string, user model.User) error {
+	if p.Status != model.ProposalOpen {
+		return ErrNotOpen
+	}
+	if message == "" {
+		message = "Update " + file
+	}
+	_, err := CommitFiles(p.Repo, []FileChange{{Path: file, Content: content}}, CommitOptions{
+		Branch:  p.Branch,
+		Base:    map[string]string{file: base},
+		Message: message,
+		Author:  user,
+	})
+	if err != nil {
+		return err
+	}
+	return touchProposal(p.ID)
+}
+
+func touchProposal(id int64) error {
+	store, err := GetStore()
+	if err != nil {
+		return err
+	}
+	return store.Proposals().Touch(id)
+}
+
+// ProposalComments lists the comments of a proposal, oldest first
+func ProposalComments(id int64) ([]model.ProposalComment, error) {
+	store, err := GetStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.Proposals().Comments(id)
+}
+
+// CommentProposal adds a comment to a proposal
+func CommentProposal(p *model.Proposal, body string, user model.User) error {
+	store, err := GetStore()
+	if err != nil {
+		return err
+	}
+	return store.Proposals().AddComment(p.ID, &model.ProposalComment{Author: user, Body: body})
+}
+
+// ProposalApprovals lists who approved a proposal and at which commit
+func ProposalApprovals(id int64) ([]model.Approval, error) {
+	store, err := GetStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.Proposals().Approvals(id)
+}
+
+// ApproveProposal approves the current head of a proposal, later edits
+// need a new approval
+func ApproveProposal(p *model.Proposal, user model.User) error {
+	if p.Status != model.ProposalOpen {
+		return ErrNotOpen
+	}
+	if p.Author.Name == user.Name {
+		return ErrSelfApprove
+	}
+	head, err := branchCommit(p.Repo, p.Branch)
+	if err != nil {
+		return err
+	}
+	store, err := GetStore()
+	if err != nil {
+		return err
+	}
+	return store.Proposals().Approve(p.ID, model.Approval{User: user, Commit: head.Hash.String(), Created: time.Now()})
+}
+
+// CloseProposal closes a proposal without merging it
+func CloseProposal(p *model.Proposal) error {
+	if p.Status != model.ProposalOpen {
+		return ErrNotOpen
+	}
+	return setProposalStatus(p, model.ProposalClosed, "")
+}
+
+func setProposalStatus(p *model.Proposal, status, merged string) error {
+	store, err := GetStore()
+	if err != nil {
+		return err
+	}
+	if err := store.Proposals().SetStatus(p.ID, status, merged); err != nil {
+		return err
+	}
+	p.Status, p.Merged = status, merged
+	return nil
+}
+
+// ApprovedHead reports whether the head of a proposal is approved
+func ApprovedHead(p *model.Proposal) (bool, error) {
+	head, err := branchCommit(p.Repo, p.Branch)
+	if err != nil {
+		return false, err
+	}
+	return approved(p, head)
+}
+
+// approved reports whether someone approved exactly commit
+func approved(p *model.Proposal, commit *object.Commit) (bool, error) {
+	approvals, err := ProposalApprovals(p.ID)
+	if err != nil {
+		return false, err
+	}
+	for _, a := range approvals {
+		if a.Commit == commit.Hash.String() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// MergeProposal merges an approved proposal into its target branch. The
+// target is fast-forwarded when it did not move, otherwise a merge commit
+// is made unless both sides changed the same file.
+func MergeProposal(p *model.Proposal, user model.User) (string, error) {
+	if p.Status != model.ProposalOpen {
+		return "", ErrNotOpen
+	}
+	// the head is read once, a push after the check can't get merged
+	head, err := branchCommit(p.Repo, p.Branch)
+	if err != nil {
+		return "", err
+	}
+	if ok, err := approved(p, head); err != nil {
+		return "", err
+	} else if !ok {
+		return "", ErrNotApproved
+	}
+	target, err := branchCommit(p.Repo, p.Target)
+	if err != nil {
+		return "", err
+	}
+
+	var merged string
+	if ok, err := target.IsAncestor(head); err != nil {
+		return "", err
+	} else if ok {
+		if err := MoveBranch(p.Repo, p.Target, target.Hash.String(), head.Hash.String()); err != nil {
+			return "", err
+		}
+		merged = head.Hash.String()
+	} else {
+		changes, bases, err := mergeChanges(head, target)
+		if err != nil {
+			return "", err
+		}
+		merged, err = CommitFiles(p.Repo, changes, CommitOptions{
+			Branch:  p.Target,
+			Base:    bases,
+			Merge:   head.Hash.String(),
+			Message: fmt.Sprintf("Merge proposal #%d: %s", p.ID, p.Title),
+			Author:  user,
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if err := setProposalStatus(p, model.ProposalMerged, merged); err != nil {
+		return "", err
+	}
+	SyncRepoLater(p.Repo)
+	return merged, nil
+}
+
+// mergeChanges are the changes that bring the changes of head since the
+// merge base onto target, with the target blobs they apply to
+func mergeChanges(head, target *object.Commit) ([]FileChange, map[string]string, error) {
+	bases, err := head.MergeBase(target)
+	if err != nil {
+		return nil, nil, err
+	}
+	base := map[string]string{}
+	if len(bases) > 0 {
+		if base, err = commitBlobs(bases[0]); err != nil {
+			return nil, nil, err
+		}
+	}
+	theirs, err := commitBlobs(head)
+	if err != nil {
+		return nil, nil, err
+	}
+	ours, err := commitBlobs(target)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	paths := map[string]bool{}
+	for _, files := range []map[string]string{base, theirs, ours} {
+		for file := range files {
+			paths[file] = true
+		}
+	}
+	var changes []FileChange
+	var conflicts []string
+	blobs := map[string]string{}
+	for file := range paths {
+		b, o, t := base[file], ours[file], theirs[file]
+		switch {
+		case o == t || b == t:
+		case b == o && t == "":
+			changes = append(changes, FileChange{Path: file, Delete: true})
+			blobs[file] = o
+		case b == o:
+			changes = append(changes, FileChange{Path: file, Blob: t})
+			blobs[file] = o
+		default:
+			conflicts = append(conflicts, file)
+		}
+	}
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return nil, nil, &MergeConflictError{Paths: conflicts}
+	}
+	return changes, blobs, nil
+}
+
+// commitBlobs maps the files of a commit to their blobs
+func commitBlobs(commit *object.Commit) (map[string]string, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	blobs := map[string]string{}
+	err = tree.Files().ForEach(func(f *object.File) error {
+		blobs[f.Name] = f.Hash.String()
+		return nil
+	})
+	return blobs, err
+}
+
+// ProposalChanges lists the files a proposal changed since it branched
+// off, documents with a rendered diff
+func ProposalChanges(p *model.Proposal) ([]ProposalFile, error) {
+	head, err := branchCommit(p.Repo, p.Branch)
+	if err != nil {
+		return nil, err
+	}
+	// merged proposals are compared with the target before the merge
+	from := p.Target
+	var against *object.Commit
+	if p.Status == model.ProposalMerged {
+		if merged, err := commitObject(p.Repo, p.Merged); err == nil && merged.NumParents() > 0 {
+			against, err = merged.Parent(0)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if against == nil {
+		if against, err = branchCommit(p.Repo, from); err != nil {
+			return nil, err
+		}
+	}
+	bases, err := head.MergeBase(against)
+	if err != nil || len(bases) == 0 {
+		return nil, err
+	}
+
+	baseTree, err := bases[0].Tree()
+	if err != nil {
+		return nil, err
+	}
+	headTree, err := head.Tree()
+	if err != nil {
+		return nil, err
+	}
+	diff, err := object.DiffTree(baseTree, headTree)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []ProposalFile
+	for _, change := range diff {
+		file := ProposalFile{Path: change.To.Name, Status: "modified"}
+		switch {
+		case change.From.Name == "":
+			file.Status = "added"
+		case change.To.Name == "":
+			file.Path, file.Status = change.From.Name, "deleted"
+		}
+
+		if IsDocFile(file.Path) {
+			old, _ := blobContent(baseTree, change.From.Name)
+			new, _ := blobContent(headTree, change.To.Name)
+			oldHTML, newHTML := "", ""
+			if change.From.Name != "" {
+				oldHTML = PreviewDoc(p.Repo, file.Path, old)
+			}
+			if change.To.Name != "" {
+				newHTML = PreviewDoc(p.Repo, file.Path, new)
+			}
+			file.Diff = template.HTML(internal.RenderDiff(oldHTML, newHTML))
+		}
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+func commitObject(repo, hash string) (*object.Commit, error) {
+	r, err := git.PlainOpen(GetRepoPath(repo))
+	if err != nil {
+		return nil, err
+	}
+	return r.CommitObject(plumbing.NewHash(hash))
+}
+
+func blobContent(tree *object.Tree, file string) ([]byte, error) {
+	if file == "" {
+		return nil, nil
+	}
+	f, err := tree.File(file)
+	if err != nil {
+		return nil, err
+	}
+	content, err := f.Contents()
+	return []byte(content), err
+}
+
+// RenderProposalPage renders a proposal with its changes, comments and
+// the review actions user can take
+func RenderProposalPage(p *model.Proposal, user model.User, signedIn bool) (string, error) {
+	tmpl, err := getTemplate("proposal.html")
+	if err != nil {
+		return "", err
+	}
+	files, err := ProposalChanges(p)
+	if err != nil {
+		return "", err
+	}
+	comments, err := ProposalComments(p.ID)
+	if err != nil {
+		return "", err
+	}
+	approvals, err := ProposalApprovals(p.ID)
+	if err != nil {
+		return "", err
+	}
+	approved := false
+	if p.Status == model.ProposalOpen {
+		if approved, err = ApprovedHead(p); err != nil {
+			return "", err
+		}
+	}
+
+	open := p.Status == model.ProposalOpen
+	writer := signedIn && CanWrite(p.Repo, user)
+	edit := map[string]string{}
+	if open && signedIn && CanChangeProposal(p, user) {
+		for _, file := range files {
+			if file.Status != "deleted" && IsDocFile(file.Path) {
+				edit[file.Path] = fmt.Sprint(GetEditUrl(p.Repo, file.Path), "?proposal=", p.ID)
+			}
+		}
+	}
+
+	var page bytes.Buffer
+	err = tmpl.Execute(&page, map[string]interface{}{
+		"Proposal":  p,
+		"Repo":      p.Repo,
+		"Files":     files,
+		"EditUrls":  edit,
+		"Comments":  comments,
+		"Approvals": approvals,
+		"Approved":  approved,
+		"SignedIn":  signedIn,
+		"CanReview": open && writer && p.Author.Name != user.Name,
+		"CanMerge":  open && writer && approved,
+		"CanClose":  open && signedIn && CanChangeProposal(p, user),
+		"ListUrl":   GetProposalsUrl(p.Repo),
+		"DocUrl":    func(file string) string { return GetDocUrl(p.Repo, file) },
+		"Theme":     GetRepoConfig(p.Repo).Theme,
+		"Base":      "/",
+	})
+	if err != nil {
+		return "", err
+	}
+	return page.String(), nil
+}
+
+// RenderProposalsPage renders the list of proposals of a repo
+func RenderProposalsPage(repo string, proposals []*model.Proposal) (string, error) {
+	tmpl, err := getTemplate("proposals.html")
+	if err != nil {
+		return "", err
+	}
+	var page bytes.Buffer
+	err = tmpl.Execute(&page, map[string]interface{}{
+		"Repo":      repo,
+		"Proposals": proposals,
+		"Url":       func(id int64) string { return GetProposalUrl(repo, id) },
+		"Base":      "/",
+	})
+	if err != nil {
+		return "", err
+	}
+	return page.String(), nil
+}
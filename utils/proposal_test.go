@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/scnon/md-doc/model"
+)
+
+func TestMergeProposalNeedsApprovedHead(t *testing.T) {
+	testRepos(t, "proposals")
+	testCommit(t, "proposals", map[string]string{"a.md": "a\n"})
+	bob := model.User{Name: "bob", Email: "bob@localhost"}
+
+	p, err := CreateProposal("proposals", "a.md", []byte("b\n"), BlobHash([]byte("a\n")), "", "", bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ApproveProposal(p, testUser); err != nil {
+		t.Fatal(err)
+	}
+	// an edit after the approval
+	if err := AddToProposal(p, "a.md", []byte("c\n"), BlobHash([]byte("b\n")), "", bob); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MergeProposal(p, testUser); !errors.Is(err, ErrNotApproved) {
+		t.Fatalf("merge of an unapproved head: %v, want ErrNotApproved", err)
+	}
+
+	if err := ApproveProposal(p, testUser); err != nil {
+		t.Fatal(err)
+	}
+	head, err := branchCommit("proposals", p.Branch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged, err := MergeProposal(p, testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged != head.Hash.String() {
+		t.Errorf("merged %s, want the approved head %s", merged, head.Hash)
+	}
+}
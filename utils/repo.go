@@ -2,16 +2,23 @@ package utils
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
-	"text/template"
+	"sync"
+	"time"
 
 	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/scnon/md-doc/internal"
 )
@@ -20,6 +27,12 @@ var (
 	DataPath   = "./data/"
 	RepoPrefix = "repo"
 	GitPrefix  = "git"
+	// SourceSizeLimit is the largest source file shown highlighted
+	SourceSizeLimit int64 = 1 << 20
+
+	syncLocks sync.Map
+	// syncs are the syncs running in the background
+	syncs sync.WaitGroup
 )
 
 func GetRepoBase() string {
@@ -30,10 +43,6 @@ func GetGitBase() string {
 	return fmt.Sprint(DataPath, GitPrefix, "/")
 }
 
-func GetGitUrl(name string) string {
-	return fmt.Sprint("http://localhost/repo/", name)
-}
-
 func GetRepoPath(name string) string {
 	return fmt.Sprint(GetRepoBase(), name, "/")
 }
@@ -42,6 +51,30 @@ func GetGitPath(name string) string {
 	return fmt.Sprint(GetGitBase(), name, "/")
 }
 
+func GetDocUrl(repo, file string) string {
+	return fmt.Sprint("/doc/", repo, "/", file)
+}
+
+func GetRawUrl(repo, file string) string {
+	return fmt.Sprint("/raw/", repo, "/", file)
+}
+
+func GetEditUrl(repo, file string) string {
+	return fmt.Sprint("/edit/", repo, "/", file)
+}
+
+func GetNewUrl(repo, dir string) string {
+	return fmt.Sprint("/new/", repo, "/", dir)
+}
+
+func GetProposalUrl(repo string, id int64) string {
+	return fmt.Sprint("/proposal/", repo, "/", id)
+}
+
+func GetProposalsUrl(repo string) string {
+	return fmt.Sprint("/proposals/", repo)
+}
+
 func CreateRepo(name string) error {
 	path := GetRepoPath(name)
 
@@ -78,20 +111,233 @@ func CheckRepoExist(name string) bool {
 	return !os.IsNotExist(err)
 }
 
-func ReaderDoc(repo, file, author, created, updated string, content []byte) (string, error) {
-	tmpl, err := template.ParseFiles("./static/doc.html")
+// RenderDoc renders the body of a document, results are cached by the
+// blob of the expanded source, the renderer and repo config and the index
+func RenderDoc(repo, file string, content []byte) string {
+	return RenderDocAt(repo, nil, file, content)
+}
+
+// RenderDocAt renders the body of a document of commit, its includes are
+// read from the commit, or from the checkout when commit is nil
+func RenderDocAt(repo string, commit *object.Commit, file string, content []byte) string {
+	renderer, ok := internal.GetRenderer(file)
+	if !ok {
+		return renderSource(repo, file, content)
+	}
+
+	config := GetRepoConfig(repo)
+	index := GetIndex(repo)
+	content = expandDocAt(repo, commit, file, content)
+
+	configJson, _ := json.Marshal(config)
+	key := hashStrings(BlobHash(content), file, internal.RendererVersion, string(configJson),
+		strings.Join(config.IframeHosts, ","), index.Version, TemplateVersion())
+	if html, ok := GetCache(key); ok {
+		return html
+	}
+
+	html := renderer.Render(content, renderOptions(repo, file, config, index))
+	html = internal.Sanitize(html, config.Sanitize, config.IframeHosts)
+
+	PutCache(key, html)
+	return html
+}
+
+func renderOptions(repo, file string, config RepoConfig, index *RepoIndex) internal.RenderOptions {
+	return internal.RenderOptions{
+		ResolveWikiLink: func(target string) (string, bool) {
+			to, anchor, ok := index.ResolveWikiLink(file, target)
+			if !ok {
+				return "", false
+			}
+			if anchor != "" {
+				anchor = "#" + anchor
+			}
+			return GetDocUrl(repo, to) + anchor, true
+		},
+		ResolveAsset: func(src string) (string, bool) {
+			return index.resolveAsset(file, src)
+		},
+		LineNumbers: config.LineNumbers,
+		CustomEmoji: index.Emoji,
+	}
+}
+
+// expandDoc expands the include directives of markdown documents
+func expandDoc(repo, file string, content []byte) []byte {
+	return expandDocAt(repo, nil, file, content)
+}
+
+// expandDocAt expands the include directives of a document of commit
+// with the files of the commit, or of the checkout when commit is nil
+func expandDocAt(repo string, commit *object.Commit, file string, content []byte) []byte {
+	if !internal.IsMarkdown(file) {
+		return content
+	}
+	read := func(p string) ([]byte, error) {
+		return GetFile(repo, p)
+	}
+	if commit != nil {
+		read = commitReader(commit)
+	}
+	return internal.ExpandIncludes(content, file, read)
+}
+
+// commitReader reads the files of a commit
+func commitReader(commit *object.Commit) internal.ReadFunc {
+	return func(file string) ([]byte, error) {
+		f, err := commit.File(file)
+		if err != nil {
+			return nil, os.ErrNotExist
+		}
+		content, err := f.Contents()
+		return []byte(content), err
+	}
+}
+
+// renderSource shows files that are no documents as highlighted source
+func renderSource(repo, file string, content []byte) string {
+	download := GetRawUrl(repo, file) + "?download=1"
+	if int64(len(content)) > SourceSizeLimit {
+		return internal.RenderDownload("File is too large to display", int64(len(content)), download)
+	}
+	if !internal.IsText(content) {
+		return internal.RenderDownload("Binary file not shown", int64(len(content)), download)
+	}
+
+	key := hashStrings(BlobHash(content), file, internal.RendererVersion, "source")
+	if html, ok := GetCache(key); ok {
+		return html
+	}
+	html := internal.RenderSource(file, content, GetRawUrl(repo, file))
+	PutCache(key, html)
+	return html
+}
+
+// WarmCache renders every document of a repo into the cache
+func WarmCache(repo string) {
+	for file := range GetIndex(repo).Docs {
+		content, err := GetFile(repo, file)
+		if err != nil {
+			continue
+		}
+		RenderDoc(repo, file, content)
+	}
+}
+
+// DocPage carries what doc.html shows around a document
+type DocPage struct {
+	Author  string
+	Created string
+	Updated string
+	// Base prefixes the site urls of the page, "/" when served
+	Base string
+	// Export marks pages of a static export, they search a prebuilt index
+	Export bool
+	// DocUrl is the url of a document of the repo
+	DocUrl func(file string) string
+	// EditUrl links the editor, empty when the reader can't edit
+	EditUrl string
+	// Propose is set for readers who can only propose edits
+	Propose bool
+	// Comments shows the comment threads, User is who is signed in
+	Comments bool
+	User     string
+	// Ref is the branch, tag or commit an old version is shown at,
+	// Commit is what it resolves to, includes are read from it. Pages of
+	// a commit have no sidebar and backlinks.
+	Ref    string
+	Commit *object.Commit
+}
+
+// DocLink is a link to a document of the repo
+type DocLink struct {
+	Title string
+	Path  string
+	URL   string
+}
+
+// ServerPage is a page served by the server
+func ServerPage(repo, author, created, updated string) DocPage {
+	return DocPage{
+		Author:   author,
+		Created:  created,
+		Updated:  updated,
+		Base:     "/",
+		Comments: true,
+		DocUrl: func(to string) string {
+			return GetDocUrl(repo, to)
+		},
+	}
+}
+
+// RenderPage renders a document into the doc.html layout
+func RenderPage(repo, file string, content []byte, page DocPage) (string, error) {
+	tmpl, err := getTemplate("doc.html")
 	if err != nil {
 		return "", err
 	}
 
+	config := GetRepoConfig(repo)
+	index := GetIndex(repo)
+	html := RenderDocAt(repo, page.Commit, file, content)
+
+	title := file
+	if doc, ok := index.Docs[file]; ok {
+		title = doc.Title
+	}
+	var backlinks []DocLink
+	var sidebar []*SidebarLink
+	if page.Commit == nil {
+		for _, doc := range index.GetBacklinks(file) {
+			backlinks = append(backlinks, DocLink{Title: doc.Title, Path: doc.Path, URL: page.DocUrl(doc.Path)})
+		}
+		sidebar = SidebarLinks(GetSidebar(repo), file, page.DocUrl)
+	} else {
+		// the index is the checkout's, an old version only shows itself
+		title = docTitle(file, content)
+	}
+	var toc []internal.Heading
+	for _, h := range internal.Headings(file, expandDocAt(repo, page.Commit, file, content)) {
+		if h.Level == 2 || h.Level == 3 {
+			toc = append(toc, h)
+		}
+	}
+
+	// writers get the actions on the document
+	blob, newUrl := "", ""
+	if page.EditUrl != "" && !page.Propose {
+		blob = BlobHash(content)
+		dir := path.Dir(file)
+		if dir == "." {
+			dir = ""
+		}
+		newUrl = GetNewUrl(repo, dir)
+	}
+
 	var reader bytes.Buffer
-	err = tmpl.Execute(&reader, map[string]string{
-		"Title":   file,
-		"Repo":    repo,
-		"Author":  author,
-		"Created": created,
-		"Updated": updated,
-		"Content": string(internal.Render2Html(content)),
+	err = tmpl.Execute(&reader, map[string]interface{}{
+		"Title":     title,
+		"Repo":      repo,
+		"Author":    page.Author,
+		"Created":   page.Created,
+		"Updated":   page.Updated,
+		"Content":   template.HTML(html),
+		"Backlinks": backlinks,
+		"Sidebar":   sidebar,
+		"Toc":       toc,
+		"Theme":     config.Theme,
+		"Base":      page.Base,
+		"Export":    page.Export,
+		"EditUrl":   page.EditUrl,
+		"Propose":   page.Propose,
+		"NewUrl":    newUrl,
+		"Proposals": GetProposalsUrl(repo),
+		"Path":      file,
+		"Blob":      blob,
+		"Comments":  page.Comments,
+		"User":      page.User,
+		"Ref":       page.Ref,
 	})
 	if err != nil {
 		return "", err
@@ -143,6 +389,25 @@ func GetFileUpdated(repo, file string) (string, error) {
 	return strings.ReplaceAll(strs[0], "'", ""), nil
 }
 
+// InfoTimeFormat is how the page info shows times
+const InfoTimeFormat = "2006/01/02 15:04:05"
+
+// GetFileModTime is the commit time of the last change to file
+func GetFileModTime(repo, file string) time.Time {
+	cmd := exec.Command("git", "log", "-1", "--pretty=format:%ct", "HEAD", "--", file)
+	cmd.Dir = GetRepoPath(repo)
+	out, err := cmd.Output()
+	if err != nil {
+		return time.Time{}
+	}
+	sec, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Unix(sec, 0)
+}
+
 func GetFileInfo(repo, file string) (string, string, string) {
 	author, err := GetFileAuthor(repo, file)
 	if err != nil {
@@ -161,56 +426,80 @@ func GetFileInfo(repo, file string) (string, string, string) {
 }
 
 func GetFile(repo, file string) ([]byte, error) {
-	path := GetGitPath(repo)
-	filePath := fmt.Sprint(path, "/", file)
+	filePath, err := ResolveFile(repo, file)
+	if err != nil {
+		return nil, err
+	}
 
 	return ioutil.ReadFile(filePath)
 }
 
-func UpdateGit(path string) error {
-	_, err := os.Stat(GetGitPath(path))
+// SyncRepo pulls the pushed changes into the checkout and reindexes it,
+// syncs of a repo run one at a time
+func SyncRepo(name string) {
+	lock, _ := syncLocks.LoadOrStore(name, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
 
-	if os.IsNotExist(err) {
-		_, err := git.PlainClone(GetGitPath(path), false, &git.CloneOptions{
-			URL:      GetGitUrl(path),
-			Progress: os.Stdout,
-		})
-		return err
-	} else {
-		repo, err := git.PlainOpen(GetGitPath(path))
-		if err != nil {
-			return err
-		}
-
-		tree, err := repo.Worktree()
-		if err != nil {
-			return err
-		}
-
-		err = tree.Pull(&git.PullOptions{RemoteName: "origin"})
-		if err != nil {
-			return err
-		}
+	if err := UpdateGit(name); err != nil && err != git.NoErrAlreadyUpToDate {
+		log.Println("sync failed:", name, err)
+		return
+	}
+	UpdateIndex(name)
+	WarmCache(name)
+}
 
-		ref, err := repo.Head()
-		if err != nil {
-			return err
-		}
+// SyncRepoLater syncs a repo in the background, commits made for a
+// request don't wait for the repo to be indexed and rendered again
+func SyncRepoLater(name string) {
+	syncs.Add(1)
+	go func() {
+		defer syncs.Done()
+		SyncRepo(name)
+	}()
+}
 
-		commit, err := repo.CommitObject(ref.Hash())
-		if err != nil {
-			return err
-		}
+// UpdateGit clones or pulls the checkout of a repo from its bare repo on
+// disk
+func UpdateGit(name string) error {
+	source, err := filepath.Abs(GetRepoPath(name))
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(GetGitPath(name)); os.IsNotExist(err) {
+		_, err := git.PlainClone(GetGitPath(name), false, &git.CloneOptions{URL: source})
+		return err
+	}
 
-		file, err := commit.Files()
-		if err != nil {
-			return err
-		}
+	repo, err := git.PlainOpen(GetGitPath(name))
+	if err != nil {
+		return err
+	}
+	if err := setOrigin(repo, source); err != nil {
+		return err
+	}
+	tree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	return tree.Pull(&git.PullOptions{RemoteName: "origin"})
+}
 
-		file.ForEach(func(f *object.File) error {
-			log.Println(f.Name)
-			return nil
-		})
+// setOrigin points the origin of a checkout at url, older checkouts were
+// cloned over http
+func setOrigin(repo *git.Repository, url string) error {
+	cfg, err := repo.Config()
+	if err != nil {
 		return err
 	}
+	origin, ok := cfg.Remotes["origin"]
+	if !ok {
+		_, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{url}})
+		return err
+	}
+	if len(origin.URLs) == 1 && origin.URLs[0] == url {
+		return nil
+	}
+	origin.URLs = []string{url}
+	return repo.SetConfig(cfg)
 }
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderPageAtRef(t *testing.T) {
+	testRepos(t, "pages")
+	old := testCommit(t, "pages", map[string]string{"a.md": "# Old A\n\nText.\n"})
+	testCommit(t, "pages", map[string]string{
+		"a.md":   "# New A\n\nText.\n",
+		"new.md": "# Newer\n\n[[a]]\n",
+	})
+	SyncRepo("pages")
+	templateDir := TemplateDir
+	TemplateDir = "../static/"
+	defer func() { TemplateDir = templateDir }()
+
+	page := ServerPage("pages", "alice", "", "")
+	html, err := RenderPage("pages", "a.md", []byte("# New A\n\nText.\n"), page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(html, `class="backlinks"`) || !strings.Contains(html, `class="sidebar"`) ||
+		!strings.Contains(html, "- New A</title>") {
+		t.Errorf("page at head lacks the sidebar or backlinks: %s", html)
+	}
+
+	content, commit, _, err := ReadRefFile("pages", old, "a.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page.Ref, page.Commit = old[:7], commit
+	html, err = RenderPage("pages", "a.md", content, page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// new.md doesn't exist at the old commit
+	if strings.Contains(html, `class="backlinks"`) || strings.Contains(html, `class="sidebar"`) || strings.Contains(html, "Newer") {
+		t.Errorf("page at %s shows the index of head: %s", old, html)
+	}
+	if !strings.Contains(html, "- Old A</title>") {
+		t.Errorf("page at %s lacks its own title: %s", old, html)
+	}
+}
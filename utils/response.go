@@ -2,8 +2,12 @@ package utils
 
 import (
 	"log"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/scnon/md-doc/model"
 )
 
 func Resp404(c echo.Context) error {
@@ -14,3 +18,22 @@ func Resp500(c echo.Context, err error) error {
 	log.Println("500:", err)
 	return c.HTML(500, "500 Internal Server Error")
 }
+
+// RespCached sends html with ETag and Last-Modified, answering 304 when
+// the client copy is still fresh. Pages differ by reader, they are only
+// kept by the browser and tagged by the signed in user.
+func RespCached(c echo.Context, html string, modtime time.Time) error {
+	user, _ := CurrentUser(c)
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
+	header.Set(echo.HeaderCacheControl, "private, no-cache")
+	header.Set("ETag", `"`+hashStrings(html, user.Name)+`"`)
+
+	http.ServeContent(c.Response(), c.Request(), "", modtime, strings.NewReader(html))
+	return nil
+}
+
+// RespError sends a json error in the response envelope
+func RespError(c echo.Context, code int, msg string) error {
+	return c.JSON(code, model.Response{Code: code, Msg: msg})
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestRespCached(t *testing.T) {
+	UserHeader = "X-User"
+	defer func() { UserHeader = "" }()
+	e := echo.New()
+	page := "<p>the same page</p>"
+	get := func(user, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/doc/demo/a.md", nil)
+		if user != "" {
+			req.Header.Set("X-User", user)
+		}
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		if err := RespCached(e.NewContext(req, rec), page, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+
+	rec := get("alice", "")
+	etag := rec.Header().Get("ETag")
+	if rec.Code != 200 || etag == "" || rec.Header().Get(echo.HeaderCacheControl) != "private, no-cache" {
+		t.Fatalf("first response %d, headers %v", rec.Code, rec.Header())
+	}
+	if rec := get("alice", etag); rec.Code != http.StatusNotModified {
+		t.Errorf("same user got %d, want 304", rec.Code)
+	}
+	for _, user := range []string{"bob", ""} {
+		if rec := get(user, etag); rec.Code != 200 || rec.Header().Get("ETag") == etag {
+			t.Errorf("user %q got %d with etag %s of alice", user, rec.Code, rec.Header().Get("ETag"))
+		}
+	}
+}
@@ -0,0 +1,585 @@
+package utils
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/scnon/md-doc/internal"
+	"github.com/scnon/md-doc/model"
+)
+
+const (
+	SnippetWidth = 160
+
+	// weights of a term found in the title and in a section heading,
+	// against the log of its count in the text
+	titleWeight   = 3
+	headingWeight = 2
+)
+
+var (
+	searchIndexes = map[string]*searchIndex{}
+	// searchLock guards searchIndexes, an index is built under the lock
+	// of its repo so other repos stay searchable
+	searchLock  sync.Mutex
+	searchBuild sync.Map
+
+	ErrRefNotIndexed = errors.New("ref is not searchable")
+)
+
+type searchSection struct {
+	heading, id, text string
+	foldedHeading     []rune
+	folded            []rune
+}
+
+// searchDoc is a version of a document in the search index of a repo,
+// shared by the refs it is in
+type searchDoc struct {
+	path, blob, title string
+	foldedTitle       []rune
+	// tags and authors are lower case, authors are the names and emails of
+	// everyone who changed the document up to this version and the front
+	// matter authors
+	tags, authors []string
+	updated       time.Time
+	sections      []searchSection
+}
+
+type searchIndex struct {
+	// key names the commits of the refs the index was built at
+	key string
+	// head is the default branch, searched when no ref is asked for
+	head string
+	refs map[string][]*searchDoc
+	// versions are the documents by path, blob and expanded source
+	versions map[string]*searchDoc
+}
+
+// fileChange is a commit that wrote a blob to a file
+type fileChange struct {
+	blob   string
+	when   time.Time
+	author []string
+}
+
+// readHistory walks the history back from the tips and collects the
+// changes of every file, merge commits add nothing of their own
+func readHistory(r *git.Repository, tips []*object.Commit) (map[string][]fileChange, error) {
+	history := map[string][]fileChange{}
+	seen := map[plumbing.Hash]bool{}
+	for _, tip := range tips {
+		iter, err := r.Log(&git.LogOptions{From: tip.Hash, Order: git.LogOrderCommitterTime})
+		if err != nil {
+			return nil, err
+		}
+		err = iter.ForEach(func(c *object.Commit) error {
+			if seen[c.Hash] || c.NumParents() > 1 {
+				return nil
+			}
+			seen[c.Hash] = true
+			tree, err := c.Tree()
+			if err != nil {
+				return err
+			}
+			parentTree := &object.Tree{}
+			if c.NumParents() == 1 {
+				parent, err := c.Parent(0)
+				if err != nil {
+					return err
+				}
+				if parentTree, err = parent.Tree(); err != nil {
+					return err
+				}
+			}
+			changes, err := object.DiffTree(parentTree, tree)
+			if err != nil {
+				return err
+			}
+			author := []string{strings.ToLower(c.Author.Name), strings.ToLower(c.Author.Email)}
+			for _, change := range changes {
+				if change.To.Name != "" {
+					history[change.To.Name] = append(history[change.To.Name],
+						fileChange{blob: change.To.TreeEntry.Hash.String(), when: c.Author.When, author: author})
+				}
+			}
+			return nil
+		})
+		iter.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return history, nil
+}
+
+// versionHistory finds when a version of a file was made and who changed
+// the file up to then. A blob no commit wrote, as of a merge, counts as
+// made by the last change before it.
+func versionHistory(changes []fileChange, blob string) (time.Time, []string) {
+	var made time.Time
+	for _, ch := range changes {
+		if ch.blob == blob && (made.IsZero() || ch.when.Before(made)) {
+			made = ch.when
+		}
+	}
+	if made.IsZero() {
+		for _, ch := range changes {
+			if ch.when.After(made) {
+				made = ch.when
+			}
+		}
+	}
+	var authors []string
+	for _, ch := range changes {
+		if !ch.when.After(made) {
+			authors = appendUnique(authors, ch.author...)
+		}
+	}
+	return made, authors
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		found := v == ""
+		for _, have := range list {
+			if have == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// metaStrings reads a front matter value given as a list or a comma
+// separated string, lower case
+func metaStrings(value interface{}) []string {
+	var values []string
+	switch v := value.(type) {
+	case string:
+		for _, s := range strings.Split(v, ",") {
+			values = appendUnique(values, strings.ToLower(strings.TrimSpace(s)))
+		}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = appendUnique(values, strings.ToLower(strings.TrimSpace(s)))
+			}
+		}
+	}
+	return values
+}
+
+// newSearchDoc indexes a version of a document of commit
+func newSearchDoc(repo string, commit *object.Commit, f *object.File, changes []fileChange) (*searchDoc, error) {
+	content, err := f.Contents()
+	if err != nil {
+		return nil, err
+	}
+	meta, body := internal.SplitFrontMatter(f.Name, []byte(content))
+	doc := &searchDoc{
+		path:    f.Name,
+		blob:    f.Hash.String(),
+		title:   docTitle(f.Name, body),
+		tags:    append(metaStrings(meta["tags"]), metaStrings(meta["tag"])...),
+		authors: append(metaStrings(meta["author"]), metaStrings(meta["authors"])...),
+	}
+	if title, ok := meta["title"].(string); ok && title != "" {
+		doc.title = title
+	}
+	doc.foldedTitle = internal.FoldRunes([]rune(doc.title))
+	updated, authors := versionHistory(changes, doc.blob)
+	doc.updated = updated
+	doc.authors = appendUnique(doc.authors, authors...)
+	for _, s := range internal.HTMLSections(RenderDocAt(repo, commit, f.Name, body)) {
+		doc.sections = append(doc.sections, searchSection{
+			heading:       s.Heading,
+			id:            s.ID,
+			text:          s.Text,
+			foldedHeading: internal.FoldRunes([]rune(s.Heading)),
+			folded:        internal.FoldRunes([]rune(s.Text)),
+		})
+	}
+	return doc, nil
+}
+
+// searchRefs lists the refs the search index of a repo covers, the
+// default branch and the tags matching the search_tags pattern of the
+// repo config. An empty repo has none.
+func searchRefs(repo string) (string, map[string]*object.Commit, error) {
+	refs := map[string]*object.Commit{}
+	head, err := DefaultBranch(repo)
+	if err != nil {
+		return "", nil, err
+	}
+	commit, err := ResolveRef(repo, "")
+	if errors.Is(err, ErrUnknownRef) {
+		return head, refs, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	refs[head] = commit
+
+	pattern := GetRepoConfig(repo).SearchTags
+	if pattern == "" {
+		return head, refs, nil
+	}
+	r, err := git.PlainOpen(GetRepoPath(repo))
+	if err != nil {
+		return "", nil, err
+	}
+	tags, err := r.Tags()
+	if err != nil {
+		return "", nil, err
+	}
+	err = tags.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name().Short()
+		if ok, _ := path.Match(pattern, name); !ok {
+			return nil
+		}
+		if commit, err := ResolveRef(repo, ref.Name().String()); err == nil {
+			refs[name] = commit
+		}
+		return nil
+	})
+	return head, refs, err
+}
+
+// buildSearchIndex indexes the documents of refs, the versions of old
+// reuses the documents it indexed before
+func buildSearchIndex(repo, head string, refs map[string]*object.Commit, key string, old *searchIndex) (*searchIndex, error) {
+	r, err := git.PlainOpen(GetRepoPath(repo))
+	if err != nil {
+		return nil, err
+	}
+	var tips []*object.Commit
+	for _, commit := range refs {
+		tips = append(tips, commit)
+	}
+	history, err := readHistory(r, tips)
+	if err != nil {
+		return nil, err
+	}
+
+	index := &searchIndex{key: key, head: head, refs: map[string][]*searchDoc{}, versions: map[string]*searchDoc{}}
+	for name, commit := range refs {
+		tree, err := commit.Tree()
+		if err != nil {
+			return nil, err
+		}
+		var docs []*searchDoc
+		err = tree.Files().ForEach(func(f *object.File) error {
+			if !IsDocFile(f.Name) || strings.HasPrefix(f.Name, ConfigDir+"/") {
+				return nil
+			}
+			// a version is the blob with the files it includes at the ref
+			content, err := f.Contents()
+			if err != nil {
+				return err
+			}
+			expanded := expandDocAt(repo, commit, f.Name, []byte(content))
+			version := f.Name + "\x00" + f.Hash.String() + "\x00" + BlobHash(expanded)
+			doc, ok := index.versions[version]
+			if !ok && old != nil {
+				doc, ok = old.versions[version]
+			}
+			if !ok {
+				if doc, err = newSearchDoc(repo, commit, f, history[f.Name]); err != nil {
+					return err
+				}
+			}
+			index.versions[version] = doc
+			docs = append(docs, doc)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		index.refs[name] = docs
+	}
+	return index, nil
+}
+
+// getSearchIndex returns the search index of a repo, built again when a
+// ref it covers moves
+func getSearchIndex(repo string) (*searchIndex, error) {
+	head, refs, err := searchRefs(repo)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for name, commit := range refs {
+		names = append(names, name+"="+commit.Hash.String())
+	}
+	sort.Strings(names)
+	key := strings.Join(names, " ")
+
+	lock, _ := searchBuild.LoadOrStore(repo, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	searchLock.Lock()
+	old, ok := searchIndexes[repo]
+	searchLock.Unlock()
+	if ok && old.key == key && old.head == head {
+		return old, nil
+	}
+	index, err := buildSearchIndex(repo, head, refs, key, old)
+	if err != nil {
+		return nil, err
+	}
+	searchLock.Lock()
+	searchIndexes[repo] = index
+	searchLock.Unlock()
+	return index, nil
+}
+
+func hasValue(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// match scores doc for terms, the best section is the one whose heading
+// and text match most. ok is false unless every term is in the document.
+func (doc *searchDoc) match(terms []string, idf map[string]float64) (score float64, best int, ok bool) {
+	sectionScores := make([]float64, len(doc.sections))
+	for _, term := range terms {
+		found := false
+		if len(internal.TermOffsets(doc.foldedTitle, term)) > 0 {
+			score += idf[term] * titleWeight
+			found = true
+		}
+		count := 0
+		for i, s := range doc.sections {
+			n := len(internal.TermOffsets(s.folded, term))
+			weight := idf[term] * math.Log1p(float64(n))
+			if len(internal.TermOffsets(s.foldedHeading, term)) > 0 {
+				weight += idf[term] * headingWeight
+				found = true
+			}
+			sectionScores[i] += weight
+			count += n
+		}
+		if count == 0 && !found {
+			return 0, 0, false
+		}
+		score += idf[term] * math.Log1p(float64(count))
+	}
+	for i, s := range sectionScores {
+		if s > sectionScores[best] {
+			best = i
+		}
+	}
+	if len(sectionScores) > 0 {
+		score += sectionScores[best]
+	}
+	return score, best, true
+}
+
+// contains reports whether any title, heading or text of doc has term
+func (doc *searchDoc) contains(term string) bool {
+	if len(internal.TermOffsets(doc.foldedTitle, term)) > 0 {
+		return true
+	}
+	for _, s := range doc.sections {
+		if len(internal.TermOffsets(s.folded, term)) > 0 || len(internal.TermOffsets(s.foldedHeading, term)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// searchRepo lists the documents of a repo matching the words of
+// req.Key and the filters of req at req.Ref, the default branch when it
+// is empty. Terms are weighted by how rare they are at the ref, scores
+// are divided by the summed weights of the terms so that they compare
+// across repos.
+func searchRepo(repo string, req model.SearchReq) ([]model.SearchResult, error) {
+	index, err := getSearchIndex(repo)
+	if err != nil {
+		return nil, err
+	}
+	ref := req.Ref
+	for _, prefix := range []string{"refs/heads/", "refs/tags/"} {
+		ref = strings.TrimPrefix(ref, prefix)
+	}
+	if ref == "" || ref == "HEAD" {
+		ref = index.head
+	}
+	all, ok := index.refs[ref]
+	if !ok {
+		return nil, ErrRefNotIndexed
+	}
+	terms := internal.SearchTerms(req.Key)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	prefix := strings.TrimPrefix(req.Path, "/")
+	tag, author := strings.ToLower(req.Tag), strings.ToLower(req.Author)
+	var docs []*searchDoc
+	for _, doc := range all {
+		if !strings.HasPrefix(doc.path, prefix) ||
+			(tag != "" && !hasValue(doc.tags, tag)) ||
+			(author != "" && !hasValue(doc.authors, author)) {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+
+	idf := map[string]float64{}
+	for _, term := range terms {
+		df := 0
+		for _, doc := range all {
+			if doc.contains(term) {
+				df++
+			}
+		}
+		idf[term] = math.Log1p(float64(len(all)) / float64(df+1))
+	}
+	norm := 0.0
+	for _, w := range idf {
+		norm += w
+	}
+
+	var results []model.SearchResult
+	for _, doc := range docs {
+		score, best, ok := doc.match(terms, idf)
+		if !ok {
+			continue
+		}
+		if norm > 0 {
+			score /= norm
+		}
+		res := model.SearchResult{
+			Repo:       repo,
+			Ref:        ref,
+			Path:       doc.path,
+			Title:      doc.title,
+			URL:        GetDocUrl(repo, doc.path),
+			Score:      math.Round(score*1000) / 1000,
+			Updated:    doc.updated,
+			Highlights: []model.Span{},
+		}
+		if ref != index.head {
+			res.URL += "?ref=" + url.QueryEscape(ref)
+		}
+		if len(doc.sections) > 0 {
+			s := doc.sections[best]
+			res.Heading, res.Anchor = s.heading, s.id
+			if s.id != "" {
+				res.URL += "#" + s.id
+			}
+			snippet, spans := internal.Snippet(s.text, terms, SnippetWidth)
+			res.Snippet = snippet
+			for _, span := range spans {
+				res.Highlights = append(res.Highlights, model.Span{Start: span.Start, End: span.End})
+			}
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// ListRepos lists the names of the bare repos
+func ListRepos() ([]string, error) {
+	entries, err := os.ReadDir(GetRepoBase())
+	if err != nil {
+		return nil, err
+	}
+	var repos []string
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			repos = append(repos, e.Name())
+		}
+	}
+	return repos, nil
+}
+
+// Search finds the documents matching req in req.Repo, or in every repo
+// user can read when it is empty, best first. ErrRefNotIndexed is returned
+// when req.Repo doesn't index req.Ref.
+func Search(req model.SearchReq, user model.User) (*model.SearchResults, error) {
+	repos := []string{req.Repo}
+	if req.Repo == "" {
+		all, err := ListRepos()
+		if err != nil {
+			return nil, err
+		}
+		repos = nil
+		for _, repo := range all {
+			if CanRead(repo, user) {
+				repos = append(repos, repo)
+			}
+		}
+	}
+
+	var results []model.SearchResult
+	for _, repo := range repos {
+		found, err := searchRepo(repo, req)
+		if err != nil && req.Repo == "" {
+			// only the repos with the ref are searched for it, a broken
+			// repo leaves the others searchable
+			if !errors.Is(err, ErrRefNotIndexed) {
+				log.Println("search failed:", repo, err)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, found...)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if results[i].Repo != results[j].Repo {
+			return results[i].Repo < results[j].Repo
+		}
+		return results[i].Path < results[j].Path
+	})
+
+	res := &model.SearchResults{Key: req.Key, Total: len(results), Results: []model.SearchResult{},
+		Repos: []model.SearchRepo{}, Page: model.Page{Offset: req.Offset, Limit: req.Limit}}
+	counts := map[string]int{}
+	for _, r := range results {
+		if counts[r.Repo] == 0 {
+			res.Repos = append(res.Repos, model.SearchRepo{Repo: r.Repo})
+		}
+		counts[r.Repo]++
+	}
+	for i := range res.Repos {
+		res.Repos[i].Total = counts[res.Repos[i].Repo]
+	}
+	if req.Offset < len(results) {
+		end := req.Offset + req.Limit
+		if end < len(results) {
+			res.More = true
+		} else {
+			end = len(results)
+		}
+		res.Results = results[req.Offset:end]
+	}
+	return res, nil
+}
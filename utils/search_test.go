@@ -0,0 +1,194 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/scnon/md-doc/model"
+)
+
+func TestSearchNormalizesScores(t *testing.T) {
+	testRepos(t, "small", "large")
+	doc := "# Deploy\n\nHow to deploy the service.\n"
+	testCommit(t, "small", map[string]string{"deploy.md": doc})
+	large := map[string]string{"deploy.md": doc}
+	for i := 0; i < 30; i++ {
+		large[fmt.Sprintf("other%d.md", i)] = fmt.Sprintf("# Other %d\n\nNothing to see.\n", i)
+	}
+	testCommit(t, "large", large)
+
+	// the term is much rarer in the large repo, its weight cancels out
+	res, err := Search(model.SearchReq{Key: "deploy", Limit: 10}, model.User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Results) != 2 {
+		t.Fatalf("results: %+v", res.Results)
+	}
+	if a, b := res.Results[0], res.Results[1]; a.Score != b.Score || a.Score <= 0 {
+		t.Errorf("same document scored %v in %s and %v in %s", a.Score, a.Repo, b.Score, b.Repo)
+	}
+
+	// a better match ranks first whatever its repo
+	testCommit(t, "large", map[string]string{"guide.md": "# Deploy guide\n\n## Deploy\n\nDeploy, deploy and deploy again.\n"})
+	res, err = Search(model.SearchReq{Key: "deploy", Limit: 10}, model.User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Results) != 3 || res.Results[0].Path != "guide.md" {
+		t.Errorf("results: %+v", res.Results)
+	}
+	for i := 1; i < len(res.Results); i++ {
+		if res.Results[i].Score > res.Results[i-1].Score {
+			t.Errorf("results not sorted by score: %+v", res.Results)
+		}
+	}
+}
+
+func TestSearchGroupsByRepo(t *testing.T) {
+	testRepos(t, "alpha", "beta", "hidden")
+	testCommit(t, "alpha", map[string]string{"a.md": "# Cache\n\ncache cache cache\n", "b.md": "# B\n\nthe cache\n"})
+	testCommit(t, "beta", map[string]string{"c.md": "# C\n\nsome cache\n"})
+	testCommit(t, "hidden", map[string]string{"d.md": "# Cache\n\ncache cache cache cache\n"})
+	if err := SetRepoSetting("hidden", SettingRead, "carol"); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Search(model.SearchReq{Key: "cache", Limit: 10}, model.User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []model.SearchRepo{{Repo: "alpha", Total: 2}, {Repo: "beta", Total: 1}}
+	if fmt.Sprint(res.Repos) != fmt.Sprint(want) {
+		t.Errorf("repos %v, want %v", res.Repos, want)
+	}
+	groups := groupResults(res)
+	if len(groups) != 2 || groups[0].Repo != "alpha" || len(groups[0].Items) != 2 || groups[0].Total != 2 ||
+		groups[1].Repo != "beta" || len(groups[1].Items) != 1 {
+		t.Errorf("groups %+v", groups)
+	}
+
+	// a page keeps the totals of all results
+	res, err = Search(model.SearchReq{Key: "cache", Limit: 1}, model.User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups = groupResults(res)
+	if !res.More || len(groups) != 1 || groups[0].Total != 2 || len(groups[0].Items) != 1 {
+		t.Errorf("first page: %+v, groups %+v", res, groups)
+	}
+
+	// readers of the hidden repo find it too
+	res, err = Search(model.SearchReq{Key: "cache", Limit: 10}, model.User{Name: "carol"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 4 || res.Results[0].Repo != "hidden" {
+		t.Errorf("results for carol: %+v", res.Results)
+	}
+}
+
+func TestSearchIndexSharesVersions(t *testing.T) {
+	testRepos(t, "versions")
+	old := testCommit(t, "versions", map[string]string{
+		"a.md":    "# A\n\n{{< include \"part.md\" >}}\n",
+		"b.md":    "# B\n\nunchanged\n",
+		"part.md": "old part\n",
+	})
+	head := testCommit(t, "versions", map[string]string{"part.md": "new part\n"})
+	refs := map[string]*object.Commit{}
+	for name, hash := range map[string]string{"master": head, "v1": old} {
+		commit, err := ResolveRef("versions", hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		refs[name] = commit
+	}
+
+	index, err := buildSearchIndex("versions", "master", refs, "key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := func(index *searchIndex, ref string) map[string]*searchDoc {
+		byPath := map[string]*searchDoc{}
+		for _, doc := range index.refs[ref] {
+			byPath[doc.path] = doc
+		}
+		return byPath
+	}
+	master, v1 := docs(index, "master"), docs(index, "v1")
+
+	// the same blob is indexed once for both refs, unless what it
+	// includes changed between them
+	if master["b.md"] == nil || master["b.md"] != v1["b.md"] {
+		t.Errorf("b.md indexed twice: %p %p", master["b.md"], v1["b.md"])
+	}
+	if master["a.md"] == v1["a.md"] {
+		t.Fatal("a.md shared although its include changed")
+	}
+	if text := fmt.Sprint(v1["a.md"].sections); !strings.Contains(text, "old part") {
+		t.Errorf("v1 a.md indexed without its include of v1: %s", text)
+	}
+	if text := fmt.Sprint(master["a.md"].sections); !strings.Contains(text, "new part") {
+		t.Errorf("master a.md indexed without its include: %s", text)
+	}
+
+	// a rebuild reuses the versions of the old index
+	again, err := buildSearchIndex("versions", "master", refs, "key", index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if docs(again, "v1")["b.md"] != v1["b.md"] || docs(again, "v1")["a.md"] != v1["a.md"] {
+		t.Error("rebuild indexed unchanged versions again")
+	}
+}
+
+func TestSearchSkipsBrokenRepos(t *testing.T) {
+	testRepos(t, "good")
+	testCommit(t, "good", map[string]string{"a.md": "# Cache\n\ncache\n"})
+	// a repo dir that is no git repo
+	if err := os.MkdirAll(GetRepoPath("broken"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Search(model.SearchReq{Key: "cache", Limit: 10}, model.User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Results) != 1 || res.Results[0].Repo != "good" {
+		t.Errorf("results %+v", res.Results)
+	}
+	if _, err := Search(model.SearchReq{Repo: "broken", Key: "cache", Limit: 10}, model.User{}); err == nil {
+		t.Error("search of the broken repo did not fail")
+	}
+}
+
+func TestSearchIndexLocksPerRepo(t *testing.T) {
+	testRepos(t, "busy", "free")
+	testCommit(t, "busy", map[string]string{"a.md": "# A\n"})
+	testCommit(t, "free", map[string]string{"b.md": "# B\n"})
+
+	// an index of busy being built holds its lock
+	lock, _ := searchBuild.LoadOrStore("busy", &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	done := make(chan error)
+	go func() {
+		_, err := getSearchIndex("free")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("index of free waited for the build of busy")
+	}
+}
@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// SidebarItem is an entry of the navigation, items without Path group
+// their children
+type SidebarItem struct {
+	Title    string         `json:"title"`
+	Path     string         `json:"path"`
+	Children []*SidebarItem `json:"children"`
+}
+
+// SidebarLink is a sidebar item as shown on one page
+type SidebarLink struct {
+	Title    string
+	URL      string
+	Active   bool
+	Children []*SidebarLink
+}
+
+// GetSidebar reads the manifest .md-doc/sidebar.json, without one the
+// documents are listed by directory
+func GetSidebar(repo string) []*SidebarItem {
+	index := GetIndex(repo)
+
+	data, err := os.ReadFile(fmt.Sprint(GetConfigPath(repo), "sidebar.json"))
+	if err == nil {
+		var items []*SidebarItem
+		if err := json.Unmarshal(data, &items); err == nil {
+			fillSidebarTitles(index, items)
+			return items
+		}
+	}
+
+	var files []string
+	for file := range index.Docs {
+		if !strings.HasPrefix(file, ConfigDir+"/") {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+
+	var root []*SidebarItem
+	dirs := map[string]*SidebarItem{}
+	for _, file := range files {
+		items := &root
+		dir := ""
+		for _, part := range strings.Split(path.Dir(file), "/") {
+			if part == "." {
+				break
+			}
+			dir = path.Join(dir, part)
+			group, ok := dirs[dir]
+			if !ok {
+				group = &SidebarItem{Title: part}
+				dirs[dir] = group
+				*items = append(*items, group)
+			}
+			items = &group.Children
+		}
+		*items = append(*items, &SidebarItem{Title: index.Docs[file].Title, Path: file})
+	}
+	return root
+}
+
+func fillSidebarTitles(index *RepoIndex, items []*SidebarItem) {
+	for _, item := range items {
+		if doc, ok := index.Docs[item.Path]; ok && item.Title == "" {
+			item.Title = doc.Title
+		}
+		fillSidebarTitles(index, item.Children)
+	}
+}
+
+// SidebarOrder lists the documents in sidebar order
+func SidebarOrder(repo string) []string {
+	var files []string
+	var walk func(items []*SidebarItem)
+	walk = func(items []*SidebarItem) {
+		for _, item := range items {
+			if item.Path != "" {
+				files = append(files, item.Path)
+			}
+			walk(item.Children)
+		}
+	}
+	walk(GetSidebar(repo))
+	return files
+}
+
+// SidebarLinks turns the sidebar into links for the page of current
+func SidebarLinks(items []*SidebarItem, current string, url func(file string) string) []*SidebarLink {
+	var links []*SidebarLink
+	for _, item := range items {
+		link := &SidebarLink{
+			Title:    item.Title,
+			Active:   item.Path != "" && item.Path == current,
+			Children: SidebarLinks(item.Children, current, url),
+		}
+		if item.Path != "" {
+			link.URL = url(item.Path)
+		}
+		links = append(links, link)
+	}
+	return links
+}
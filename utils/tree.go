@@ -0,0 +1,224 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/scnon/md-doc/internal"
+	"github.com/scnon/md-doc/model"
+)
+
+var (
+	ErrNotDir     = errors.New("not a directory")
+	ErrUnknownRef = errors.New("unknown ref")
+)
+
+// ResolveRef finds the commit of a branch, tag or commit hash of a repo,
+// an empty ref is HEAD
+func ResolveRef(repo, ref string) (*object.Commit, error) {
+	r, err := git.PlainOpen(GetRepoPath(repo))
+	if err != nil {
+		return nil, err
+	}
+	if ref == "" {
+		ref = "HEAD"
+	}
+	hash, err := r.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return nil, ErrUnknownRef
+	}
+	return r.CommitObject(*hash)
+}
+
+// ReadTree lists the entries of a directory at ref, limit entries from
+// offset
+func ReadTree(repo, ref, dir string, offset, limit int) (*model.Tree, error) {
+	commit, err := ResolveRef(repo, ref)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		entry, err := tree.FindEntry(dir)
+		if err != nil {
+			return nil, os.ErrNotExist
+		}
+		if entry.Mode != filemode.Dir {
+			return nil, ErrNotDir
+		}
+		if tree, err = tree.Tree(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	res := &model.Tree{Repo: repo, Ref: ref, Commit: commit.Hash.String(), Path: dir,
+		Entries: []model.TreeEntry{}, Page: model.Page{Offset: offset, Limit: limit}}
+	for i, e := range tree.Entries {
+		if i < offset {
+			continue
+		}
+		if len(res.Entries) == limit {
+			res.More = true
+			break
+		}
+		entry := model.TreeEntry{Name: e.Name, Path: path.Join(dir, e.Name), Hash: e.Hash.String()}
+		switch e.Mode {
+		case filemode.Dir:
+			entry.Type = "dir"
+		case filemode.Submodule:
+			entry.Type = "submodule"
+		default:
+			entry.Type = "file"
+			entry.Doc = IsDocFile(e.Name)
+			if entry.Size, err = tree.Size(e.Name); err != nil {
+				return nil, err
+			}
+		}
+		res.Entries = append(res.Entries, entry)
+	}
+	return res, nil
+}
+
+func commitInfo(c *object.Commit) model.CommitInfo {
+	info := model.CommitInfo{
+		Hash:      c.Hash.String(),
+		Subject:   strings.SplitN(strings.TrimSpace(c.Message), "\n", 2)[0],
+		Message:   c.Message,
+		Author:    model.User{Name: c.Author.Name, Email: c.Author.Email},
+		Date:      c.Author.When,
+		Committer: model.User{Name: c.Committer.Name, Email: c.Committer.Email},
+		Parents:   []string{},
+	}
+	for _, p := range c.ParentHashes {
+		info.Parents = append(info.Parents, p.String())
+	}
+	return info
+}
+
+// ListCommits lists the history of ref, newest first, or only the commits
+// changing file when it is set
+func ListCommits(repo, ref, file string, offset, limit int) (*model.CommitList, error) {
+	r, err := git.PlainOpen(GetRepoPath(repo))
+	if err != nil {
+		return nil, err
+	}
+	commit, err := ResolveRef(repo, ref)
+	if err != nil {
+		return nil, err
+	}
+	opts := &git.LogOptions{From: commit.Hash, Order: git.LogOrderCommitterTime}
+	if file != "" {
+		opts.FileName = &file
+	}
+	iter, err := r.Log(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	res := &model.CommitList{Repo: repo, Ref: ref, Path: file,
+		Commits: []model.CommitInfo{}, Page: model.Page{Offset: offset, Limit: limit}}
+	skipped := 0
+	err = iter.ForEach(func(c *object.Commit) error {
+		if skipped < offset {
+			skipped++
+			return nil
+		}
+		if len(res.Commits) == limit {
+			res.More = true
+			return io.EOF
+		}
+		res.Commits = append(res.Commits, commitInfo(c))
+		return nil
+	})
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ReadRefFile reads a file at ref, with the commit ref resolves to and
+// the blob hash of the file
+func ReadRefFile(repo, ref, file string) ([]byte, *object.Commit, string, error) {
+	commit, err := ResolveRef(repo, ref)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	f, err := commit.File(file)
+	if err != nil {
+		return nil, nil, "", os.ErrNotExist
+	}
+	content, err := f.Contents()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return []byte(content), commit, f.Hash.String(), nil
+}
+
+// FileHistory finds the commits that added and last changed a file in
+// the history of commit
+func FileHistory(repo string, commit *object.Commit, file string) (created, updated *model.CommitInfo, err error) {
+	r, err := git.PlainOpen(GetRepoPath(repo))
+	if err != nil {
+		return nil, nil, err
+	}
+	iter, err := r.Log(&git.LogOptions{From: commit.Hash, Order: git.LogOrderCommitterTime, FileName: &file})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer iter.Close()
+	err = iter.ForEach(func(c *object.Commit) error {
+		info := commitInfo(c)
+		if updated == nil {
+			updated = &info
+		}
+		created = &info
+		return nil
+	})
+	return created, updated, err
+}
+
+// ReadDoc reads a document at ref with its front matter, rendering,
+// headings and the commits that added and last changed it. Includes are
+// read from the same commit.
+func ReadDoc(repo, ref, file string) (*model.Doc, error) {
+	content, commit, blob, err := ReadRefFile(repo, ref, file)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, body := internal.SplitFrontMatter(file, content)
+	doc := &model.Doc{
+		Repo:        repo,
+		Path:        file,
+		Ref:         ref,
+		Commit:      commit.Hash.String(),
+		Blob:        blob,
+		Title:       docTitle(file, body),
+		Raw:         string(content),
+		HTML:        RenderDocAt(repo, commit, file, body),
+		FrontMatter: meta,
+		Headings:    []model.Heading{},
+	}
+	if title, ok := meta["title"].(string); ok && title != "" {
+		doc.Title = title
+	}
+	for _, h := range internal.Headings(file, expandDocAt(repo, commit, file, body)) {
+		doc.Headings = append(doc.Headings, model.Heading{Level: h.Level, Text: h.Text, ID: h.ID})
+	}
+
+	if doc.Created, doc.Updated, err = FileHistory(repo, commit, file); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
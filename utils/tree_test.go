@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadDocIncludesAtRef(t *testing.T) {
+	testRepos(t, "history")
+	old := testCommit(t, "history", map[string]string{
+		"a.md":    "# A\n\n{{< include \"part.md\" >}}\n",
+		"part.md": "## Old part\n",
+	})
+	testCommit(t, "history", map[string]string{"part.md": "## New part\n"})
+	SyncRepo("history")
+
+	doc, err := ReadDoc("history", old, "a.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(doc.HTML, "Old part") || strings.Contains(doc.HTML, "New part") {
+		t.Errorf("old version rendered with the includes of the checkout: %s", doc.HTML)
+	}
+	if len(doc.Headings) != 2 || doc.Headings[1].Text != "Old part" {
+		t.Errorf("headings %+v", doc.Headings)
+	}
+
+	doc, err = ReadDoc("history", "", "a.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(doc.HTML, "New part") {
+		t.Errorf("head rendered without its include: %s", doc.HTML)
+	}
+}